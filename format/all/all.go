@@ -17,6 +17,7 @@ import (
 	_ "github.com/wader/fq/format/flac"
 	_ "github.com/wader/fq/format/gif"
 	_ "github.com/wader/fq/format/gzip"
+	_ "github.com/wader/fq/format/http"
 	_ "github.com/wader/fq/format/icc"
 	_ "github.com/wader/fq/format/id3"
 	_ "github.com/wader/fq/format/inet"
@@ -34,8 +35,10 @@ import (
 	_ "github.com/wader/fq/format/png"
 	_ "github.com/wader/fq/format/protobuf"
 	_ "github.com/wader/fq/format/raw"
+	_ "github.com/wader/fq/format/rtp"
 	_ "github.com/wader/fq/format/tar"
 	_ "github.com/wader/fq/format/tiff"
+	_ "github.com/wader/fq/format/tls"
 	_ "github.com/wader/fq/format/vorbis"
 	_ "github.com/wader/fq/format/vpx"
 	_ "github.com/wader/fq/format/wav"
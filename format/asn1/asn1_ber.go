@@ -28,7 +28,7 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
-//go:embed *.jq
+//go:embed asn1_ber.jq
 var asn1FS embed.FS
 
 func init() {
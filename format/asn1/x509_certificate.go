@@ -0,0 +1,635 @@
+package asn1
+
+// https://www.rfc-editor.org/rfc/rfc5280 X.509 certificate profile
+// https://www.rfc-editor.org/rfc/rfc4514 distinguished name string representation
+// TODO: CRLs and CSRs
+// TODO: more extensions, policies, CRL distribution points, authority info access etc
+
+import (
+	"embed"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed x509_certificate.jq
+var x509FS embed.FS
+
+var x509ASN1BERFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.X509_CERTIFICATE,
+		Description: "X.509 certificate",
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.ASN1_BER}, Group: &x509ASN1BERFormat},
+		},
+		DecodeFn: decodeX509Certificate,
+		Files:    x509FS,
+		ToRepr:   "_x509_certificate_torepr",
+	})
+}
+
+const universalTypeBMPString = 0x1e
+
+const (
+	x509OIDRSAEncryption = "1.2.840.113549.1.1.1"
+
+	x509OIDSubjectKeyIdentifier   = "2.5.29.14"
+	x509OIDKeyUsage               = "2.5.29.15"
+	x509OIDSubjectAltName         = "2.5.29.17"
+	x509OIDIssuerAltName          = "2.5.29.18"
+	x509OIDBasicConstraints       = "2.5.29.19"
+	x509OIDAuthorityKeyIdentifier = "2.5.29.35"
+	x509OIDCRLDistributionPoints  = "2.5.29.31"
+	x509OIDExtKeyUsage            = "2.5.29.37"
+	x509OIDAuthorityInfoAccess    = "1.3.6.1.5.5.7.1.1"
+)
+
+var x509OIDMap = scalar.StrToSymStr{
+	// attribute types
+	"2.5.4.3":                    "common_name",
+	"2.5.4.4":                    "surname",
+	"2.5.4.5":                    "serial_number",
+	"2.5.4.6":                    "country_name",
+	"2.5.4.7":                    "locality_name",
+	"2.5.4.8":                    "state_or_province_name",
+	"2.5.4.9":                    "street_address",
+	"2.5.4.10":                   "organization_name",
+	"2.5.4.11":                   "organizational_unit_name",
+	"2.5.4.12":                   "title",
+	"2.5.4.42":                   "given_name",
+	"1.2.840.113549.1.9.1":       "email_address",
+	"0.9.2342.19200300.100.1.1":  "user_id",
+	"0.9.2342.19200300.100.1.25": "domain_component",
+
+	// extensions
+	x509OIDSubjectKeyIdentifier:   "subject_key_identifier",
+	x509OIDKeyUsage:               "key_usage",
+	x509OIDSubjectAltName:         "subject_alt_name",
+	x509OIDIssuerAltName:          "issuer_alt_name",
+	x509OIDBasicConstraints:       "basic_constraints",
+	"2.5.29.30":                   "name_constraints",
+	x509OIDCRLDistributionPoints:  "crl_distribution_points",
+	"2.5.29.32":                   "certificate_policies",
+	x509OIDAuthorityKeyIdentifier: "authority_key_identifier",
+	x509OIDExtKeyUsage:            "ext_key_usage",
+	x509OIDAuthorityInfoAccess:    "authority_info_access",
+	"1.3.6.1.5.5.7.1.24":          "tls_feature",
+	"1.3.6.1.4.1.11129.2.4.2":     "signed_certificate_timestamp_list",
+
+	// algorithms
+	x509OIDRSAEncryption:    "rsa_encryption",
+	"1.2.840.113549.1.1.4":  "md5_with_rsa_encryption",
+	"1.2.840.113549.1.1.5":  "sha1_with_rsa_encryption",
+	"1.2.840.113549.1.1.10": "rsassa_pss",
+	"1.2.840.113549.1.1.11": "sha256_with_rsa_encryption",
+	"1.2.840.113549.1.1.12": "sha384_with_rsa_encryption",
+	"1.2.840.113549.1.1.13": "sha512_with_rsa_encryption",
+	"1.2.840.10045.2.1":     "ec_public_key",
+	"1.2.840.10045.4.3.2":   "ecdsa_with_sha256",
+	"1.2.840.10045.4.3.3":   "ecdsa_with_sha384",
+	"1.2.840.10045.4.3.4":   "ecdsa_with_sha512",
+	"1.2.840.10045.3.1.7":   "prime256v1",
+	"1.3.132.0.34":          "secp384r1",
+	"1.3.132.0.35":          "secp521r1",
+	"1.3.101.110":           "x25519",
+	"1.3.101.112":           "ed25519",
+	"1.3.101.113":           "ed448",
+
+	// extended key usages
+	"1.3.6.1.5.5.7.3.1": "server_auth",
+	"1.3.6.1.5.5.7.3.2": "client_auth",
+	"1.3.6.1.5.5.7.3.3": "code_signing",
+	"1.3.6.1.5.5.7.3.4": "email_protection",
+	"1.3.6.1.5.5.7.3.8": "time_stamping",
+	"1.3.6.1.5.5.7.3.9": "ocsp_signing",
+
+	// access methods and policies
+	"1.3.6.1.5.5.7.48.1": "ocsp",
+	"1.3.6.1.5.5.7.48.2": "ca_issuers",
+	"2.23.140.1.1":       "extended_validation",
+	"2.23.140.1.2.1":     "domain_validated",
+	"2.23.140.1.2.2":     "organization_validated",
+}
+
+// https://www.rfc-editor.org/rfc/rfc4514#section-3
+var x509AttributeShortNames = map[string]string{
+	"2.5.4.3":                    "CN",
+	"2.5.4.6":                    "C",
+	"2.5.4.7":                    "L",
+	"2.5.4.8":                    "ST",
+	"2.5.4.9":                    "STREET",
+	"2.5.4.10":                   "O",
+	"2.5.4.11":                   "OU",
+	"0.9.2342.19200300.100.1.1":  "UID",
+	"0.9.2342.19200300.100.1.25": "DC",
+}
+
+var x509VersionMap = scalar.SToSymStr{
+	0: "v1",
+	1: "v2",
+	2: "v3",
+}
+
+// bit 0 is most significant bit
+var x509KeyUsageNames = []string{
+	"digital_signature",
+	"content_commitment",
+	"key_encipherment",
+	"data_encipherment",
+	"key_agreement",
+	"key_cert_sign",
+	"crl_sign",
+	"encipher_only",
+	"decipher_only",
+}
+
+// https://www.rfc-editor.org/rfc/rfc5280#section-4.2.1.6
+const (
+	x509GeneralNameOtherName     = 0
+	x509GeneralNameRFC822Name    = 1
+	x509GeneralNameDNSName       = 2
+	x509GeneralNameDirectoryName = 4
+	x509GeneralNameURI           = 6
+	x509GeneralNameIPAddress     = 7
+)
+
+var x509GeneralNameMap = scalar.UToSymStr{
+	x509GeneralNameOtherName:     "other_name",
+	x509GeneralNameRFC822Name:    "rfc822_name",
+	x509GeneralNameDNSName:       "dns_name",
+	3:                            "x400_address",
+	x509GeneralNameDirectoryName: "directory_name",
+	5:                            "edi_party_name",
+	x509GeneralNameURI:           "uniform_resource_identifier",
+	x509GeneralNameIPAddress:     "ip_address",
+	8:                            "registered_id",
+}
+
+// only low tag numbers, enough for certificates
+func peekDERTag(d *decode.D) (class uint64, form uint64, tag uint64) {
+	if d.BitsLeft() < 8 {
+		return 0, 0, 0
+	}
+	b := d.PeekBits(8)
+	return b >> 6, (b >> 5) & 1, b & 0b1_1111
+}
+
+// decodes DER object header, checks class and tag and calls fn framed to the content
+func decodeDERObject(d *decode.D, class uint64, tag uint64, tagMap scalar.Mapper, fn func(d *decode.D, length int64)) {
+	actualClass := d.FieldU2("class", tagClassMap)
+	d.FieldU1("form", constructedPrimitiveMap)
+	var actualTag uint64
+	if actualClass == classUniversal {
+		actualTag = d.FieldUFn("tag", decodeTagNumber, universalTypeMap, scalar.Hex)
+	} else if tagMap != nil {
+		actualTag = d.FieldUFn("tag", decodeTagNumber, tagMap)
+	} else {
+		actualTag = d.FieldUFn("tag", decodeTagNumber)
+	}
+	if actualClass != class || actualTag != tag {
+		d.Fatalf("expected class %d tag %d found class %d tag %d", class, tag, actualClass, actualTag)
+	}
+	if d.PeekBits(8) == 0x80 {
+		d.Fatalf("indefinite length not allowed in DER")
+	}
+	length := int64(d.FieldUFn("length", decodeLength))
+	d.FramedFn(length*8, func(d *decode.D) { fn(d, length) })
+}
+
+func fieldDERObject(d *decode.D, name string, class uint64, tag uint64, fn func(d *decode.D, length int64)) {
+	d.FieldStruct(name, func(d *decode.D) { decodeDERObject(d, class, tag, nil, fn) })
+}
+
+func fieldDERSequence(d *decode.D, name string, fn func(d *decode.D)) {
+	fieldDERObject(d, name, classUniversal, universalTypeSequence, func(d *decode.D, _ int64) { fn(d) })
+}
+
+// SEQUENCE OF or SET OF as constructed array
+func fieldDERSequenceOf(d *decode.D, name string, tag uint64, fn func(d *decode.D)) {
+	fieldDERObject(d, name, classUniversal, tag, func(d *decode.D, _ int64) {
+		d.FieldArray("constructed", func(d *decode.D) {
+			for !d.End() {
+				fn(d)
+			}
+		})
+	})
+}
+
+// generic object decoded as asn1_ber
+func fieldDERAny(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		decodeASN1BERValue(d, nil, nil, formConstructed, universalTypeSequence)
+	})
+}
+
+func fieldDERInteger(d *decode.D, name string, sms ...scalar.Mapper) {
+	fieldDERObject(d, name, classUniversal, universalTypeInteger, func(d *decode.D, length int64) {
+		if length > 8 {
+			d.FieldSBigInt("value", int(length)*8)
+		} else {
+			d.FieldS("value", int(length)*8, sms...)
+		}
+	})
+}
+
+func fieldDERBoolean(d *decode.D, name string) bool {
+	var v bool
+	fieldDERObject(d, name, classUniversal, universalTypeBoolean, func(d *decode.D, _ int64) {
+		v = d.FieldU8("value", scalar.URangeToScalar{
+			{Range: [2]uint64{0, 0}, S: scalar.S{Sym: false}},
+			{Range: [2]uint64{0x01, 0xff}, S: scalar.S{Sym: true}},
+		}) != 0
+	})
+	return v
+}
+
+func decodeOID(d *decode.D) string {
+	var parts []string
+	first := true
+	for !d.End() {
+		var n uint64
+		for {
+			b := d.U8()
+			n = n<<7 | b&0b0111_1111
+			if b&0b1000_0000 == 0 {
+				break
+			}
+		}
+		if first {
+			// first value is oid0*40 + oid1
+			oid0 := n / 40
+			if oid0 > 2 {
+				oid0 = 2
+			}
+			parts = append(parts, fmt.Sprintf("%d", oid0), fmt.Sprintf("%d", n-oid0*40))
+			first = false
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%d", n))
+	}
+	return strings.Join(parts, ".")
+}
+
+func fieldDEROID(d *decode.D, name string) string {
+	var oid string
+	fieldDERObject(d, name, classUniversal, universalTypeObjectIdentifier, func(d *decode.D, _ int64) {
+		oid = d.FieldStrFn("value", decodeOID, x509OIDMap)
+	})
+	return oid
+}
+
+// string types used in names, BMP string is UTF-16BE
+func fieldDERString(d *decode.D, name string) string {
+	var s string
+	d.FieldStruct(name, func(d *decode.D) {
+		_, _, tag := peekDERTag(d)
+		decodeDERObject(d, classUniversal, tag, nil, func(d *decode.D, length int64) {
+			switch tag {
+			case universalTypeBMPString:
+				s = d.FieldUTF16BE("value", int(length))
+			case universalTypeUTF8string,
+				universalTypeNumericString,
+				universalTypePrintableString,
+				universalTypeTeletexString,
+				universalTypeVideotexString,
+				universalTypeIA5String,
+				universalTypeVisibleString,
+				universalTypeGeneralString:
+				s = d.FieldUTF8("value", int(length))
+			default:
+				d.Fatalf("unknown string type %d", tag)
+			}
+		})
+	})
+	return s
+}
+
+func mapTimeToSym(layout string) scalar.Mapper {
+	return scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		str, ok := s.Actual.(string)
+		if !ok {
+			return s, nil
+		}
+		t, err := time.Parse(layout, str)
+		if err != nil {
+			return s, nil
+		}
+		// UTCTime two digit year is 1950-2049
+		if layout == "060102150405Z0700" && t.Year() >= 2050 {
+			t = t.AddDate(-100, 0, 0)
+		}
+		s.Sym = t.UTC().Format(time.RFC3339)
+		return s, nil
+	})
+}
+
+func fieldDERTime(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		_, _, tag := peekDERTag(d)
+		decodeDERObject(d, classUniversal, tag, nil, func(d *decode.D, length int64) {
+			switch tag {
+			case universalTypeUTCTime:
+				d.FieldUTF8("value", int(length), mapTimeToSym("060102150405Z0700"))
+			case universalTypeGeneralizedtime:
+				d.FieldUTF8("value", int(length), mapTimeToSym("20060102150405Z0700"))
+			default:
+				d.Fatalf("unknown time type %d", tag)
+			}
+		})
+	})
+}
+
+func fieldDERBitString(d *decode.D, name string, fn func(d *decode.D, nBits int64)) {
+	fieldDERObject(d, name, classUniversal, universalTypeBitString, func(d *decode.D, length int64) {
+		unusedBitsCount := int64(d.FieldU8("unused_bits_count"))
+		if unusedBitsCount > 7 || (length == 1 && unusedBitsCount > 0) {
+			d.Fatalf("invalid unused bits count %d", unusedBitsCount)
+		}
+		nBits := (length-1)*8 - unusedBitsCount
+		if fn != nil {
+			d.FramedFn(nBits, func(d *decode.D) { fn(d, nBits) })
+		} else {
+			d.FieldRawLen("value", nBits)
+		}
+		if unusedBitsCount > 0 {
+			d.FieldRawLen("unused_bits", unusedBitsCount)
+		}
+	})
+}
+
+func fieldDEROctetString(d *decode.D, name string, fn func(d *decode.D)) {
+	fieldDERObject(d, name, classUniversal, universalTypeOctetString, func(d *decode.D, length int64) {
+		if fn != nil {
+			fn(d)
+			return
+		}
+		d.FieldRawLen("value", length*8)
+	})
+}
+
+func fieldX509AlgorithmIdentifier(d *decode.D, name string) string {
+	var oid string
+	fieldDERSequence(d, name, func(d *decode.D) {
+		oid = fieldDEROID(d, "algorithm")
+		if !d.End() {
+			fieldDERAny(d, "parameters")
+		}
+	})
+	return oid
+}
+
+// https://www.rfc-editor.org/rfc/rfc4514#section-2.4
+func escapeDNValue(s string) string {
+	var sb strings.Builder
+	for i, c := range s {
+		switch {
+		case strings.ContainsRune(",+\"\\<>;", c),
+			i == 0 && (c == ' ' || c == '#'),
+			i == len(s)-1 && c == ' ':
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// Name as RDN sequence, value is the RFC 4514 string representation
+func fieldX509Name(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		var rdns []string
+		decodeDERObject(d, classUniversal, universalTypeSequence, nil, func(d *decode.D, _ int64) {
+			d.FieldArray("constructed", func(d *decode.D) {
+				for !d.End() {
+					var attrs []string
+					fieldDERSequenceOf(d, "relative_distinguished_name", universalTypeSet, func(d *decode.D) {
+						fieldDERSequence(d, "attribute", func(d *decode.D) {
+							oid := fieldDEROID(d, "type")
+							var v string
+							if _, _, tag := peekDERTag(d); tag == universalTypeSequence || tag == universalTypeSet {
+								fieldDERAny(d, "value")
+							} else {
+								v = fieldDERString(d, "value")
+							}
+							k, ok := x509AttributeShortNames[oid]
+							if !ok {
+								k = oid
+							}
+							attrs = append(attrs, k+"="+escapeDNValue(v))
+						})
+					})
+					rdns = append(rdns, strings.Join(attrs, "+"))
+				}
+			})
+		})
+		// string representation has reverse order
+		for i, j := 0, len(rdns)-1; i < j; i, j = i+1, j-1 {
+			rdns[i], rdns[j] = rdns[j], rdns[i]
+		}
+		d.FieldValueStr("value", strings.Join(rdns, ","))
+	})
+}
+
+func fieldX509GeneralName(d *decode.D, name string) {
+	class, form, tag := peekDERTag(d)
+	if class != classContext {
+		fieldDERAny(d, name)
+		return
+	}
+	d.FieldStruct(name, func(d *decode.D) {
+		decodeDERObject(d, classContext, tag, x509GeneralNameMap, func(d *decode.D, length int64) {
+			switch {
+			case form == formPrimitive && (tag == x509GeneralNameRFC822Name || tag == x509GeneralNameDNSName || tag == x509GeneralNameURI):
+				d.FieldUTF8("value", int(length))
+			case form == formPrimitive && tag == x509GeneralNameIPAddress && (length == net.IPv4len || length == net.IPv6len):
+				ip := net.IP(d.PeekBytes(int(length)))
+				d.FieldRawLen("value", length*8, scalar.Sym(ip.String()))
+			case form == formConstructed && tag == x509GeneralNameDirectoryName:
+				fieldX509Name(d, "value")
+			default:
+				d.FieldRawLen("value", length*8)
+			}
+		})
+	})
+}
+
+func fieldX509GeneralNames(d *decode.D, name string) {
+	fieldDERSequenceOf(d, name, universalTypeSequence, func(d *decode.D) {
+		fieldX509GeneralName(d, "general_name")
+	})
+}
+
+// implicitly tagged GeneralNames
+func fieldX509ContextGeneralNames(d *decode.D, name string, tag uint64) {
+	fieldDERObject(d, name, classContext, tag, func(d *decode.D, _ int64) {
+		d.FieldArray("constructed", func(d *decode.D) {
+			for !d.End() {
+				fieldX509GeneralName(d, "general_name")
+			}
+		})
+	})
+}
+
+func fieldX509DistributionPoint(d *decode.D, name string) {
+	fieldDERSequence(d, name, func(d *decode.D) {
+		for !d.End() {
+			class, _, tag := peekDERTag(d)
+			switch {
+			case class == classContext && tag == 0:
+				fieldDERObject(d, "distribution_point", classContext, 0, func(d *decode.D, _ int64) {
+					if class, _, tag := peekDERTag(d); class == classContext && tag == 0 {
+						fieldX509ContextGeneralNames(d, "full_name", 0)
+					} else {
+						fieldDERAny(d, "name_relative_to_crl_issuer")
+					}
+				})
+			case class == classContext && tag == 1:
+				fieldDERAny(d, "reasons")
+			case class == classContext && tag == 2:
+				fieldX509ContextGeneralNames(d, "crl_issuer", 2)
+			default:
+				fieldDERAny(d, "unknown")
+			}
+		}
+	})
+}
+
+func decodeX509Extension(d *decode.D) {
+	oid := fieldDEROID(d, "extn_id")
+	if _, _, tag := peekDERTag(d); tag == universalTypeBoolean {
+		fieldDERBoolean(d, "critical")
+	}
+	fieldDEROctetString(d, "extn_value", func(d *decode.D) {
+		switch oid {
+		case x509OIDSubjectAltName, x509OIDIssuerAltName:
+			fieldX509GeneralNames(d, "value")
+		case x509OIDKeyUsage:
+			fieldDERBitString(d, "value", func(d *decode.D, nBits int64) {
+				for i := int64(0); i < nBits; i++ {
+					if i < int64(len(x509KeyUsageNames)) {
+						d.FieldBool(x509KeyUsageNames[i])
+					} else {
+						d.FieldRawLen("unknown", nBits-i)
+						break
+					}
+				}
+			})
+		case x509OIDBasicConstraints:
+			fieldDERSequence(d, "value", func(d *decode.D) {
+				if _, _, tag := peekDERTag(d); tag == universalTypeBoolean {
+					fieldDERBoolean(d, "ca")
+				}
+				if !d.End() {
+					fieldDERInteger(d, "path_len_constraint")
+				}
+			})
+		case x509OIDExtKeyUsage:
+			fieldDERSequenceOf(d, "value", universalTypeSequence, func(d *decode.D) {
+				fieldDEROID(d, "key_purpose_id")
+			})
+		case x509OIDSubjectKeyIdentifier:
+			fieldDEROctetString(d, "value", nil)
+		case x509OIDAuthorityKeyIdentifier:
+			fieldDERSequence(d, "value", func(d *decode.D) {
+				for !d.End() {
+					class, _, tag := peekDERTag(d)
+					switch {
+					case class == classContext && tag == 0:
+						fieldDERObject(d, "key_identifier", classContext, 0, func(d *decode.D, length int64) {
+							d.FieldRawLen("value", length*8)
+						})
+					case class == classContext && tag == 1:
+						fieldX509ContextGeneralNames(d, "authority_cert_issuer", 1)
+					case class == classContext && tag == 2:
+						fieldDERObject(d, "authority_cert_serial_number", classContext, 2, func(d *decode.D, length int64) {
+							d.FieldRawLen("value", length*8)
+						})
+					default:
+						fieldDERAny(d, "unknown")
+					}
+				}
+			})
+		case x509OIDAuthorityInfoAccess:
+			fieldDERSequenceOf(d, "value", universalTypeSequence, func(d *decode.D) {
+				fieldDERSequence(d, "access_description", func(d *decode.D) {
+					fieldDEROID(d, "access_method")
+					fieldX509GeneralName(d, "access_location")
+				})
+			})
+		case x509OIDCRLDistributionPoints:
+			fieldDERSequenceOf(d, "value", universalTypeSequence, func(d *decode.D) {
+				fieldX509DistributionPoint(d, "distribution_point")
+			})
+		default:
+			if dv, _, _ := d.TryFieldFormatLen("value", d.BitsLeft(), x509ASN1BERFormat, nil); dv == nil {
+				d.FieldRawLen("value", d.BitsLeft())
+			}
+		}
+	})
+}
+
+func decodeX509TBSCertificate(d *decode.D) {
+	if class, _, tag := peekDERTag(d); class == classContext && tag == 0 {
+		fieldDERObject(d, "version", classContext, 0, func(d *decode.D, _ int64) {
+			fieldDERInteger(d, "value", x509VersionMap)
+		})
+	}
+	fieldDERInteger(d, "serial_number")
+	fieldX509AlgorithmIdentifier(d, "signature")
+	fieldX509Name(d, "issuer")
+	fieldDERSequence(d, "validity", func(d *decode.D) {
+		fieldDERTime(d, "not_before")
+		fieldDERTime(d, "not_after")
+	})
+	fieldX509Name(d, "subject")
+	fieldDERSequence(d, "subject_public_key_info", func(d *decode.D) {
+		algorithm := fieldX509AlgorithmIdentifier(d, "algorithm")
+		fieldDERBitString(d, "subject_public_key", func(d *decode.D, nBits int64) {
+			// RSA public key is a DER sequence with modulus and exponent
+			if algorithm == x509OIDRSAEncryption {
+				if dv, _, _ := d.TryFieldFormatLen("value", nBits, x509ASN1BERFormat, nil); dv != nil {
+					return
+				}
+			}
+			d.FieldRawLen("value", nBits)
+		})
+	})
+	for !d.End() {
+		class, _, tag := peekDERTag(d)
+		switch {
+		case class == classContext && tag == 1:
+			fieldDERObject(d, "issuer_unique_id", classContext, 1, func(d *decode.D, length int64) {
+				d.FieldRawLen("value", length*8)
+			})
+		case class == classContext && tag == 2:
+			fieldDERObject(d, "subject_unique_id", classContext, 2, func(d *decode.D, length int64) {
+				d.FieldRawLen("value", length*8)
+			})
+		case class == classContext && tag == 3:
+			fieldDERObject(d, "extensions", classContext, 3, func(d *decode.D, _ int64) {
+				fieldDERSequenceOf(d, "value", universalTypeSequence, func(d *decode.D) {
+					fieldDERSequence(d, "extension", decodeX509Extension)
+				})
+			})
+		default:
+			fieldDERAny(d, "unknown")
+		}
+	}
+}
+
+func decodeX509Certificate(d *decode.D, in interface{}) interface{} {
+	decodeDERObject(d, classUniversal, universalTypeSequence, nil, func(d *decode.D, _ int64) {
+		fieldDERSequence(d, "tbs_certificate", decodeX509TBSCertificate)
+		fieldX509AlgorithmIdentifier(d, "signature_algorithm")
+		fieldDERBitString(d, "signature_value", nil)
+	})
+
+	return nil
+}
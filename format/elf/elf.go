@@ -8,6 +8,7 @@ package elf
 // TODO: dwarf
 
 import (
+	"embed"
 	"strings"
 
 	"github.com/wader/fq/format"
@@ -16,12 +17,17 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
+//go:embed *.jq
+var elfFS embed.FS
+
 func init() {
 	registry.MustRegister(decode.Format{
 		Name:        format.ELF,
 		Description: "Executable and Linkable Format",
 		Groups:      []string{format.PROBE},
 		DecodeFn:    elfDecode,
+		Files:       elfFS,
+		Summary:     "_elf_summary",
 	})
 }
 
@@ -15,6 +15,7 @@ const (
 	ADTS_FRAME          = "adts_frame"
 	APEV2               = "apev2"
 	AR                  = "ar"
+	ARP                 = "arp"
 	ASN1_BER            = "asn1_ber"
 	AV1_CCR             = "av1_ccr"
 	AV1_FRAME           = "av1_frame"
@@ -45,17 +46,23 @@ const (
 	FLAC_STREAMINFO     = "flac_streaminfo"
 	FLV                 = "flv" // TODO:
 	GIF                 = "gif"
+	GRE                 = "gre"
+	GRPC                = "grpc"
 	GZIP                = "gzip"
 	HEVC_ANNEXB         = "hevc_annexb"
 	HEVC_AU             = "hevc_au"
 	HEVC_DCR            = "hevc_dcr"
 	HEVC_NALU           = "hevc_nalu"
+	HTTP                = "http"
+	HTTP2               = "http2"
 	ICC_PROFILE         = "icc_profile"
 	ICMP                = "icmp"
+	ICMPV6              = "icmpv6"
 	ID3V1               = "id3v1"
 	ID3V11              = "id3v11"
 	ID3V2               = "id3v2"
 	IPV4_PACKET         = "ipv4_packet"
+	IPV6_PACKET         = "ipv6_packet"
 	JPEG                = "jpeg"
 	JSON                = "json"
 	MACHO               = "macho"
@@ -69,6 +76,7 @@ const (
 	MPEG_PES_PACKET     = "mpeg_pes_packet"
 	MPEG_SPU            = "mpeg_spu"
 	MPEG_TS             = "mpeg_ts"
+	MPLS                = "mpls"
 	MSGPACK             = "msgpack"
 	OGG                 = "ogg"
 	OGG_PAGE            = "ogg_page"
@@ -79,21 +87,27 @@ const (
 	PROTOBUF            = "protobuf"
 	PROTOBUF_WIDEVINE   = "protobuf_widevine"
 	PSSH_PLAYREADY      = "pssh_playready"
+	QUIC                = "quic"
 	RAW                 = "raw"
+	RTCP                = "rtcp"
+	RTP                 = "rtp"
 	SLL_PACKET          = "sll_packet"
 	SLL2_PACKET         = "sll2_packet"
 	TAR                 = "tar"
 	TCP_SEGMENT         = "tcp_segment"
 	TIFF                = "tiff"
+	TLS                 = "tls"
 	UDP_DATAGRAM        = "udp_datagram"
 	VORBIS_COMMENT      = "vorbis_comment"
 	VORBIS_PACKET       = "vorbis_packet"
+	VXLAN               = "vxlan"
 	VP8_FRAME           = "vp8_frame"
 	VP9_CFM             = "vp9_cfm"
 	VP9_FRAME           = "vp9_frame"
 	VPX_CCR             = "vpx_ccr"
 	WAV                 = "wav"
 	WEBP                = "webp"
+	X509_CERTIFICATE    = "x509_certificate"
 	XING                = "xing"
 	ZIP                 = "zip"
 )
@@ -208,11 +222,16 @@ type LinkFrameIn struct {
 type UDPPayloadIn struct {
 	SourcePort      int
 	DestinationPort int
+	ClientPayloads  [][]byte // datagrams sent by flow client, only set when decoding flows
+	Payloads        [][]byte // datagrams sent in the same direction, only set when decoding flows
+	PayloadIndex    int      // index of this datagram in Payloads
 }
 
 type TCPStreamIn struct {
 	SourcePort      int
 	DestinationPort int
+	PeerStream      []byte // other direction of the connection
+	TLSKeyLog       []byte // NSS key log, ex from pcapng decryption secrets block
 }
 
 type X86_64In struct {
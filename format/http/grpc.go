@@ -0,0 +1,73 @@
+package http
+
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+// TODO: message encodings other than gzip, grpc-encoding header is not known here
+
+import (
+	"bytes"
+	"compress/gzip"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var grpcProtobufFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.GRPC,
+		Description: "gRPC length-prefixed messages",
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.PROTOBUF}, Group: &grpcProtobufFormat},
+		},
+		DecodeFn: decodeGRPC,
+	})
+}
+
+var grpcCompressedFlagMap = scalar.UToSymStr{
+	0: "uncompressed",
+	1: "compressed",
+}
+
+func decodeGRPC(d *decode.D, in interface{}) interface{} {
+	d.FieldArray("messages", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("message", func(d *decode.D) {
+				compressed := d.FieldU8("compressed_flag", grpcCompressedFlagMap)
+				length := int64(d.FieldU32("length"))
+				if length*8 > d.BitsLeft() {
+					d.Fatalf("message length %d larger than data", length)
+				}
+				if compressed == 0 {
+					if dv, _, _ := d.TryFieldFormatLen("message", length*8, grpcProtobufFormat, nil); dv == nil {
+						d.FieldRawLen("message", length*8)
+					}
+					return
+				}
+
+				bs := d.BytesRange(d.Pos(), int(length))
+				d.FieldRawLen("message", length*8)
+				zr, err := gzip.NewReader(bytes.NewReader(bs))
+				if err != nil {
+					return
+				}
+				ub, truncated, err := readUncompressed(zr)
+				if err != nil && len(ub) == 0 {
+					return
+				}
+				br := bitio.NewBitReader(ub, -1)
+				if dv, _, _ := d.TryFieldFormatBitBuf("uncompressed", br, grpcProtobufFormat, nil); dv == nil {
+					d.FieldRootBitBuf("uncompressed", br)
+				}
+				if truncated {
+					d.FieldValueBool("uncompressed_truncated", true)
+				}
+			})
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,291 @@
+package http
+
+// https://www.rfc-editor.org/rfc/rfc7541 HPACK header compression for HTTP/2
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	hpackDefaultTableSize = 4096
+	// size of a entry is name and value length plus 32
+	hpackEntryOverhead = 32
+)
+
+type hpackHeaderField struct {
+	name  string
+	value string
+}
+
+// https://www.rfc-editor.org/rfc/rfc7541#appendix-A index 1-61
+var hpackStaticTable = []hpackHeaderField{
+	{":authority", ""},
+	{":method", "GET"},
+	{":method", "POST"},
+	{":path", "/"},
+	{":path", "/index.html"},
+	{":scheme", "http"},
+	{":scheme", "https"},
+	{":status", "200"},
+	{":status", "204"},
+	{":status", "206"},
+	{":status", "304"},
+	{":status", "400"},
+	{":status", "404"},
+	{":status", "500"},
+	{"accept-charset", ""},
+	{"accept-encoding", "gzip, deflate"},
+	{"accept-language", ""},
+	{"accept-ranges", ""},
+	{"accept", ""},
+	{"access-control-allow-origin", ""},
+	{"age", ""},
+	{"allow", ""},
+	{"authorization", ""},
+	{"cache-control", ""},
+	{"content-disposition", ""},
+	{"content-encoding", ""},
+	{"content-language", ""},
+	{"content-length", ""},
+	{"content-location", ""},
+	{"content-range", ""},
+	{"content-type", ""},
+	{"cookie", ""},
+	{"date", ""},
+	{"etag", ""},
+	{"expect", ""},
+	{"expires", ""},
+	{"from", ""},
+	{"host", ""},
+	{"if-match", ""},
+	{"if-modified-since", ""},
+	{"if-none-match", ""},
+	{"if-range", ""},
+	{"if-unmodified-since", ""},
+	{"last-modified", ""},
+	{"link", ""},
+	{"location", ""},
+	{"max-forwards", ""},
+	{"proxy-authenticate", ""},
+	{"proxy-authorization", ""},
+	{"range", ""},
+	{"referer", ""},
+	{"refresh", ""},
+	{"retry-after", ""},
+	{"server", ""},
+	{"set-cookie", ""},
+	{"strict-transport-security", ""},
+	{"transfer-encoding", ""},
+	{"user-agent", ""},
+	{"vary", ""},
+	{"via", ""},
+	{"www-authenticate", ""},
+}
+
+type hpackHuffmanNode struct {
+	children [2]*hpackHuffmanNode
+	leaf     bool
+	sym      byte
+}
+
+var hpackHuffmanRoot = func() *hpackHuffmanNode {
+	root := &hpackHuffmanNode{}
+	for sym, c := range hpackHuffmanCodes {
+		n := root
+		for i := int(c.len) - 1; i >= 0; i-- {
+			bit := (c.code >> i) & 1
+			if n.children[bit] == nil {
+				n.children[bit] = &hpackHuffmanNode{}
+			}
+			n = n.children[bit]
+		}
+		n.leaf = true
+		n.sym = byte(sym)
+	}
+	return root
+}()
+
+func hpackHuffmanDecode(bs []byte) (string, error) {
+	var sb strings.Builder
+	n := hpackHuffmanRoot
+	// bits since last symbol and if they are all ones, used to validate padding
+	padLen := 0
+	padOnes := true
+	for _, b := range bs {
+		for i := 7; i >= 0; i-- {
+			bit := (b >> i) & 1
+			n = n.children[bit]
+			if n == nil {
+				return "", errors.New("invalid huffman code")
+			}
+			if n.leaf {
+				sb.WriteByte(n.sym)
+				n = hpackHuffmanRoot
+				padLen = 0
+				padOnes = true
+				continue
+			}
+			padLen++
+			if bit == 0 {
+				padOnes = false
+			}
+		}
+	}
+	if padLen > 7 || !padOnes {
+		return "", errors.New("invalid huffman padding")
+	}
+
+	return sb.String(), nil
+}
+
+// dynamic table for one direction of a connection
+type hpackDecoder struct {
+	entries []hpackHeaderField // newest first
+	size    int
+	maxSize int
+}
+
+func newHPACKDecoder() *hpackDecoder {
+	return &hpackDecoder{maxSize: hpackDefaultTableSize}
+}
+
+func (h *hpackDecoder) evict() {
+	for h.size > h.maxSize && len(h.entries) > 0 {
+		e := h.entries[len(h.entries)-1]
+		h.size -= len(e.name) + len(e.value) + hpackEntryOverhead
+		h.entries = h.entries[:len(h.entries)-1]
+	}
+}
+
+func (h *hpackDecoder) add(f hpackHeaderField) {
+	h.entries = append([]hpackHeaderField{f}, h.entries...)
+	h.size += len(f.name) + len(f.value) + hpackEntryOverhead
+	h.evict()
+}
+
+func (h *hpackDecoder) setMaxSize(n int) {
+	h.maxSize = n
+	h.evict()
+}
+
+func (h *hpackDecoder) lookup(index uint64) (hpackHeaderField, bool) {
+	switch {
+	case index == 0:
+		return hpackHeaderField{}, false
+	case index <= uint64(len(hpackStaticTable)):
+		return hpackStaticTable[index-1], true
+	case index-uint64(len(hpackStaticTable)) <= uint64(len(h.entries)):
+		return h.entries[index-uint64(len(hpackStaticTable))-1], true
+	default:
+		return hpackHeaderField{}, false
+	}
+}
+
+// https://www.rfc-editor.org/rfc/rfc7541#section-5.1
+func fieldHPACKInt(d *decode.D, name string, prefixLen int, sms ...scalar.Mapper) uint64 {
+	return d.FieldUFn(name, func(d *decode.D) uint64 {
+		v := d.U(prefixLen)
+		if v < 1<<prefixLen-1 {
+			return v
+		}
+		for m := 0; ; m += 7 {
+			if m > 56 {
+				d.Fatalf("integer too large")
+			}
+			b := d.U8()
+			v += (b & 0x7f) << m
+			if b&0x80 == 0 {
+				break
+			}
+		}
+		return v
+	}, sms...)
+}
+
+// https://www.rfc-editor.org/rfc/rfc7541#section-5.2
+func fieldHPACKString(d *decode.D, name string) string {
+	huffman := d.FieldBool(name + "_huffman")
+	length := fieldHPACKInt(d, name+"_length", 7)
+	if length > uint64(d.BitsLeft()/8) {
+		d.Fatalf("%s: length %d beyond end of header block", name, length)
+	}
+	return d.FieldStrFn(name, func(d *decode.D) string {
+		bs := d.BytesLen(int(length))
+		if !huffman {
+			return string(bs)
+		}
+		s, err := hpackHuffmanDecode(bs)
+		if err != nil {
+			d.Fatalf("%s: %s", name, err)
+		}
+		return s
+	})
+}
+
+// https://www.rfc-editor.org/rfc/rfc7541#section-6
+func (h *hpackDecoder) decodeBlock(d *decode.D) []hpackHeaderField {
+	var fs []hpackHeaderField
+
+	fieldIndexed := func(d *decode.D, name string, prefixLen int) hpackHeaderField {
+		var f hpackHeaderField
+		fieldHPACKInt(d, name, prefixLen, scalar.Fn(func(s scalar.S) (scalar.S, error) {
+			var ok bool
+			f, ok = h.lookup(s.ActualU())
+			if !ok {
+				return s, errors.New("index not found")
+			}
+			if s.ActualU() <= uint64(len(hpackStaticTable)) {
+				s.Description = "static"
+			} else {
+				s.Description = "dynamic"
+			}
+			return s, nil
+		}))
+		return f
+	}
+	fieldLiteral := func(d *decode.D, prefixLen int) hpackHeaderField {
+		var f hpackHeaderField
+		if d.PeekBits(prefixLen) == 0 {
+			d.FieldU("name_index", prefixLen)
+			f.name = fieldHPACKString(d, "name")
+		} else {
+			f.name = fieldIndexed(d, "name_index", prefixLen).name
+			d.FieldValueStr("name", f.name)
+		}
+		f.value = fieldHPACKString(d, "value")
+		return f
+	}
+
+	for !d.End() {
+		d.FieldStruct("field", func(d *decode.D) {
+			switch {
+			case d.PeekBits(1) == 1:
+				d.FieldU1("representation", scalar.Sym("indexed"))
+				f := fieldIndexed(d, "index", 7)
+				d.FieldValueStr("name", f.name)
+				d.FieldValueStr("value", f.value)
+				fs = append(fs, f)
+			case d.PeekBits(2) == 0b01:
+				d.FieldU2("representation", scalar.Sym("literal_incremental_indexing"))
+				f := fieldLiteral(d, 6)
+				h.add(f)
+				fs = append(fs, f)
+			case d.PeekBits(3) == 0b001:
+				d.FieldU3("representation", scalar.Sym("dynamic_table_size_update"))
+				h.setMaxSize(int(fieldHPACKInt(d, "max_size", 5)))
+			case d.PeekBits(4) == 0b0000:
+				d.FieldU4("representation", scalar.Sym("literal_without_indexing"))
+				fs = append(fs, fieldLiteral(d, 4))
+			default:
+				d.FieldU4("representation", scalar.Sym("literal_never_indexed"))
+				fs = append(fs, fieldLiteral(d, 4))
+			}
+		})
+	}
+
+	return fs
+}
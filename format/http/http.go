@@ -0,0 +1,395 @@
+package http
+
+// https://www.rfc-editor.org/rfc/rfc9112 HTTP/1.1
+// https://www.rfc-editor.org/rfc/rfc9110 HTTP semantics
+// TODO: multipart bodies
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"embed"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed *.jq
+var httpFS embed.FS
+
+// formats used to decode bodies, each format using bodies has its own dependencies
+type bodyFormats struct {
+	probe    decode.Group
+	json     decode.Group
+	protobuf decode.Group
+	grpc     decode.Group
+}
+
+var httpBodyFormats bodyFormats
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.HTTP,
+		Description: "Hypertext Transfer Protocol 1.x",
+		Groups:      []string{format.TCP_STREAM},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.PROBE}, Group: &httpBodyFormats.probe},
+			{Names: []string{format.JSON}, Group: &httpBodyFormats.json},
+			{Names: []string{format.PROTOBUF}, Group: &httpBodyFormats.protobuf},
+		},
+		DecodeFn: decodeHTTP,
+		Files:    httpFS,
+	})
+}
+
+const maxLineLen = 64 * 1024
+
+var knownMethods = []string{
+	"GET",
+	"HEAD",
+	"POST",
+	"PUT",
+	"DELETE",
+	"CONNECT",
+	"OPTIONS",
+	"TRACE",
+	"PATCH",
+}
+
+// length of line including line ending, -1 if none found
+func lineLen(d *decode.D) int64 {
+	n, _, err := d.TryPeekFind(8, 8, maxLineLen*8, func(v uint64) bool { return v == '\n' })
+	if err != nil || n == -1 {
+		return -1
+	}
+	return n/8 + 1
+}
+
+func peekLine(d *decode.D) (string, bool) {
+	n := lineLen(d)
+	if n == -1 {
+		return "", false
+	}
+	return string(d.PeekBytes(int(n))), true
+}
+
+func isResponseLine(line string) bool {
+	return strings.HasPrefix(line, "HTTP/")
+}
+
+// anyMethod allows unknown methods, used when port is a known HTTP port
+func isRequestLine(line string, anyMethod bool) bool {
+	parts := strings.SplitN(strings.TrimRight(line, "\r\n"), " ", 3)
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "HTTP/") {
+		return false
+	}
+	// HTTP/2 connection preface
+	if parts[0] == "PRI" {
+		return false
+	}
+	for _, m := range knownMethods {
+		if parts[0] == m {
+			return true
+		}
+	}
+	if !anyMethod || parts[0] == "" {
+		return false
+	}
+	for _, c := range parts[0] {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// field including trailing space
+func fieldToken(d *decode.D, name string, line string, sms ...scalar.Mapper) (string, string) {
+	n := strings.IndexByte(line, ' ')
+	if n == -1 {
+		n = len(line)
+	} else {
+		n++
+	}
+	v := d.FieldUTF8(name, n, append([]scalar.Mapper{scalar.TrimSpace}, sms...)...)
+	return v, line[n:]
+}
+
+type headers map[string]string
+
+func (h headers) has(name string, token string) bool {
+	for _, v := range strings.Split(h[name], ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeHeaders(d *decode.D, name string) headers {
+	hs := headers{}
+	d.FieldArray(name, func(d *decode.D) {
+		for {
+			line, ok := peekLine(d)
+			if !ok {
+				d.Fatalf("header line not found")
+			}
+			if strings.TrimRight(line, "\r\n") == "" {
+				break
+			}
+			d.FieldStruct("header", func(d *decode.D) {
+				n := strings.IndexByte(line, ':')
+				if n == -1 {
+					d.Fatalf("header without colon")
+				}
+				name := d.FieldUTF8("name", n+1, scalar.Trim(":"), scalar.TrimSpace)
+				value := d.FieldUTF8("value", len(line)-n-1, scalar.TrimSpace)
+				name = strings.ToLower(strings.TrimSpace(name))
+				if v, ok := hs[name]; ok {
+					hs[name] = v + ", " + value
+				} else {
+					hs[name] = value
+				}
+			})
+		}
+	})
+	line, _ := peekLine(d)
+	d.FieldUTF8(name+"_end", len(line))
+
+	return hs
+}
+
+// limit uncompressed bodies to not end up using lots of memory for something like a zip bomb
+const maxUncompressedSize = 64 * 1024 * 1024
+
+// read at most maxUncompressedSize bytes, truncated is true if there were more
+func readUncompressed(r io.Reader) (bs []byte, truncated bool, err error) {
+	bs, err = ioutil.ReadAll(io.LimitReader(r, maxUncompressedSize+1))
+	if len(bs) > maxUncompressedSize {
+		return bs[0:maxUncompressedSize], true, err
+	}
+	return bs, false, err
+}
+
+var contentEncodingReaders = map[string]func(bs []byte) (io.Reader, error){
+	"gzip":   func(bs []byte) (io.Reader, error) { return gzip.NewReader(bytes.NewReader(bs)) },
+	"x-gzip": func(bs []byte) (io.Reader, error) { return gzip.NewReader(bytes.NewReader(bs)) },
+	// should be zlib but some servers send raw deflate
+	"deflate": func(bs []byte) (io.Reader, error) {
+		if zr, err := zlib.NewReader(bytes.NewReader(bs)); err == nil {
+			return zr, nil
+		}
+		return flate.NewReader(bytes.NewReader(bs)), nil
+	},
+	"br": func(bs []byte) (io.Reader, error) { return brotli.NewReader(bytes.NewReader(bs)), nil },
+}
+
+// format for content type, nil for raw
+func (bf *bodyFormats) format(contentType string) *decode.Group {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	switch {
+	case mediaType == "application/json",
+		strings.HasSuffix(mediaType, "+json"):
+		return &bf.json
+	case mediaType == "application/grpc",
+		strings.HasPrefix(mediaType, "application/grpc+"):
+		if len(bf.grpc) == 0 {
+			return nil
+		}
+		return &bf.grpc
+	case mediaType == "application/protobuf",
+		mediaType == "application/x-protobuf",
+		mediaType == "application/vnd.google.protobuf":
+		return &bf.protobuf
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/x-www-form-urlencoded":
+		// probing text can end up as something weird
+		return nil
+	default:
+		return &bf.probe
+	}
+}
+
+func fieldBody(d *decode.D, name string, br bitio.ReaderAtSeeker, g *decode.Group) {
+	if g != nil {
+		if dv, _, _ := d.TryFieldFormatBitBuf(name, br, *g, nil); dv != nil {
+			return
+		}
+	}
+	d.FieldRootBitBuf(name, br)
+}
+
+// bodyFn adds body field with format or raw if nil, bs is body bytes with transfer encoding removed
+func decodeBody(d *decode.D, hs headers, bf *bodyFormats, bodyFn func(g *decode.Group), bs func() []byte) {
+	g := bf.format(hs["content-type"])
+	contentEncoding := strings.ToLower(strings.TrimSpace(hs["content-encoding"]))
+	if contentEncoding == "" || contentEncoding == "identity" {
+		bodyFn(g)
+		return
+	}
+
+	bodyFn(nil)
+	newReader, ok := contentEncodingReaders[contentEncoding]
+	if !ok {
+		return
+	}
+	r, err := newReader(bs())
+	if err != nil {
+		return
+	}
+	ub, truncated, err := readUncompressed(r)
+	if err != nil && len(ub) == 0 {
+		return
+	}
+	fieldBody(d, "uncompressed", bitio.NewBitReader(ub, -1), g)
+	if truncated {
+		d.FieldValueBool("uncompressed_truncated", true)
+	}
+}
+
+func decodeMessage(d *decode.D, isResponse bool) {
+	line, _ := peekLine(d)
+
+	statusCode := 0
+	if isResponse {
+		_, line = fieldToken(d, "version", line)
+		var status string
+		status, line = fieldToken(d, "status_code", line, scalar.StrUintToSym(10))
+		statusCode, _ = strconv.Atoi(status)
+		d.FieldUTF8("reason", len(line), scalar.TrimSpace)
+	} else {
+		_, line = fieldToken(d, "method", line)
+		_, line = fieldToken(d, "target", line)
+		d.FieldUTF8("version", len(line), scalar.TrimSpace)
+	}
+
+	hs := decodeHeaders(d, "headers")
+
+	bodyLen := int64(-1)
+	switch {
+	case isResponse && (statusCode/100 == 1 || statusCode == 204 || statusCode == 304):
+		bodyLen = 0
+	case hs.has("transfer-encoding", "chunked"):
+		var body bytes.Buffer
+		d.FieldArray("chunks", func(d *decode.D) {
+			for {
+				line, ok := peekLine(d)
+				if !ok {
+					d.Fatalf("chunk size not found")
+				}
+				var size uint64
+				d.FieldStruct("chunk", func(d *decode.D) {
+					sizeStr := strings.TrimSpace(strings.SplitN(line, ";", 2)[0])
+					var err error
+					size, err = strconv.ParseUint(sizeStr, 16, 64)
+					if err != nil {
+						d.Fatalf("invalid chunk size %q", sizeStr)
+					}
+					d.FieldUTF8("size", len(line), scalar.Sym(size))
+					if size == 0 {
+						return
+					}
+					if int64(size)*8 > d.BitsLeft() {
+						d.Fatalf("chunk size %d larger than stream", size)
+					}
+					d.FieldRawLen("data", int64(size)*8)
+					body.Write(d.BytesRange(d.Pos()-int64(size)*8, int(size)))
+					line, _ = peekLine(d)
+					d.FieldUTF8("data_end", len(line))
+				})
+				if size == 0 {
+					break
+				}
+			}
+		})
+		decodeHeaders(d, "trailers")
+		decodeBody(d, hs, &httpBodyFormats, func(g *decode.Group) {
+			fieldBody(d, "body", bitio.NewBitReader(body.Bytes(), -1), g)
+		}, body.Bytes)
+		return
+	case hs["content-length"] != "":
+		n, err := strconv.ParseInt(strings.TrimSpace(strings.SplitN(hs["content-length"], ",", 2)[0]), 10, 64)
+		if err != nil || n < 0 {
+			d.Fatalf("invalid content-length %q", hs["content-length"])
+		}
+		bodyLen = n
+		// response to HEAD request has content-length but no body, request is not known so guess
+		if isResponse && n > 0 {
+			if l, ok := peekLine(d); ok && isResponseLine(l) {
+				bodyLen = 0
+			}
+		}
+	case isResponse:
+		// body until connection is closed
+		bodyLen = d.BitsLeft() / 8
+	default:
+		bodyLen = 0
+	}
+
+	if bodyLen > 0 {
+		// truncated capture
+		if bodyLen*8 > d.BitsLeft() {
+			bodyLen = d.BitsLeft() / 8
+		}
+		bodyStart := d.Pos()
+		decodeBody(d, hs, &httpBodyFormats, func(g *decode.Group) {
+			if g != nil {
+				if dv, _, _ := d.TryFieldFormatLen("body", bodyLen*8, *g, nil); dv != nil {
+					return
+				}
+			}
+			d.FieldRawLen("body", bodyLen*8)
+		}, func() []byte {
+			return d.BytesRange(bodyStart, int(bodyLen))
+		})
+	}
+}
+
+func decodeHTTP(d *decode.D, in interface{}) interface{} {
+	anyMethod := false
+	if tsi, ok := in.(format.TCPStreamIn); ok {
+		for _, p := range []int{format.TCPPortHTTP, format.TCPPortHTTPAlt} {
+			if tsi.SourcePort == p || tsi.DestinationPort == p {
+				anyMethod = true
+			}
+		}
+	}
+
+	line, ok := peekLine(d)
+	if !ok {
+		d.Fatalf("no start line found")
+	}
+	isResponse := isResponseLine(line)
+	if !isResponse && !isRequestLine(line, anyMethod) {
+		d.Fatalf("not a HTTP request or response")
+	}
+
+	name, structName := "requests", "request"
+	if isResponse {
+		name, structName = "responses", "response"
+	}
+	d.FieldArray(name, func(d *decode.D) {
+		for !d.End() {
+			line, ok := peekLine(d)
+			if !ok || (isResponse && !isResponseLine(line)) || (!isResponse && !isRequestLine(line, true)) {
+				break
+			}
+			d.FieldStruct(structName, func(d *decode.D) { decodeMessage(d, isResponse) })
+		}
+	})
+	if !d.End() {
+		// gap in stream or unknown data
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -0,0 +1,376 @@
+package http
+
+// https://www.rfc-editor.org/rfc/rfc9113 HTTP/2
+// TODO: server push promised streams only has request headers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var http2BodyFormats bodyFormats
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.HTTP2,
+		Description: "Hypertext Transfer Protocol 2",
+		Groups:      []string{format.TCP_STREAM},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.PROBE}, Group: &http2BodyFormats.probe},
+			{Names: []string{format.JSON}, Group: &http2BodyFormats.json},
+			{Names: []string{format.PROTOBUF}, Group: &http2BodyFormats.protobuf},
+			{Names: []string{format.GRPC}, Group: &http2BodyFormats.grpc},
+		},
+		DecodeFn: decodeHTTP2,
+	})
+}
+
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+const http2FrameHeaderLen = 9
+
+const (
+	http2FrameTypeData         = 0x0
+	http2FrameTypeHeaders      = 0x1
+	http2FrameTypePriority     = 0x2
+	http2FrameTypeRSTStream    = 0x3
+	http2FrameTypeSettings     = 0x4
+	http2FrameTypePushPromise  = 0x5
+	http2FrameTypePing         = 0x6
+	http2FrameTypeGoAway       = 0x7
+	http2FrameTypeWindowUpdate = 0x8
+	http2FrameTypeContinuation = 0x9
+)
+
+var http2FrameTypeMap = scalar.UToScalar{
+	http2FrameTypeData:         {Sym: "data", Description: "Data"},
+	http2FrameTypeHeaders:      {Sym: "headers", Description: "Headers"},
+	http2FrameTypePriority:     {Sym: "priority", Description: "Priority"},
+	http2FrameTypeRSTStream:    {Sym: "rst_stream", Description: "Reset stream"},
+	http2FrameTypeSettings:     {Sym: "settings", Description: "Settings"},
+	http2FrameTypePushPromise:  {Sym: "push_promise", Description: "Push promise"},
+	http2FrameTypePing:         {Sym: "ping", Description: "Ping"},
+	http2FrameTypeGoAway:       {Sym: "goaway", Description: "Go away"},
+	http2FrameTypeWindowUpdate: {Sym: "window_update", Description: "Window update"},
+	http2FrameTypeContinuation: {Sym: "continuation", Description: "Continuation"},
+	0xa:                        {Sym: "altsvc", Description: "Alternative service"},
+	0xc:                        {Sym: "origin", Description: "Origin"},
+	0x10:                       {Sym: "priority_update", Description: "Priority update"},
+}
+
+const (
+	http2FlagEndStream  = 0x01
+	http2FlagAck        = 0x01
+	http2FlagEndHeaders = 0x04
+	http2FlagPadded     = 0x08
+	http2FlagPriority   = 0x20
+)
+
+// flag names for bit 7 to 0, empty string is unused
+var http2FrameFlags = map[uint64][8]string{
+	http2FrameTypeData:         {"", "", "", "", "padded", "", "", "end_stream"},
+	http2FrameTypeHeaders:      {"", "", "priority", "", "padded", "end_headers", "", "end_stream"},
+	http2FrameTypeSettings:     {"", "", "", "", "", "", "", "ack"},
+	http2FrameTypePushPromise:  {"", "", "", "", "padded", "end_headers", "", ""},
+	http2FrameTypePing:         {"", "", "", "", "", "", "", "ack"},
+	http2FrameTypeContinuation: {"", "", "", "", "", "end_headers", "", ""},
+}
+
+var http2ErrorCodeMap = scalar.UToScalar{
+	0x0: {Sym: "no_error", Description: "Graceful shutdown"},
+	0x1: {Sym: "protocol_error", Description: "Protocol error detected"},
+	0x2: {Sym: "internal_error", Description: "Implementation fault"},
+	0x3: {Sym: "flow_control_error", Description: "Flow-control limits exceeded"},
+	0x4: {Sym: "settings_timeout", Description: "Settings not acknowledged"},
+	0x5: {Sym: "stream_closed", Description: "Frame received for closed stream"},
+	0x6: {Sym: "frame_size_error", Description: "Frame size incorrect"},
+	0x7: {Sym: "refused_stream", Description: "Stream not processed"},
+	0x8: {Sym: "cancel", Description: "Stream cancelled"},
+	0x9: {Sym: "compression_error", Description: "Compression state not updated"},
+	0xa: {Sym: "connect_error", Description: "TCP connection error for CONNECT method"},
+	0xb: {Sym: "enhance_your_calm", Description: "Processing capacity exceeded"},
+	0xc: {Sym: "inadequate_security", Description: "Negotiated TLS parameters not acceptable"},
+	0xd: {Sym: "http_1_1_required", Description: "Use HTTP/1.1 for the request"},
+}
+
+var http2SettingsMap = scalar.UToScalar{
+	0x1: {Sym: "header_table_size"},
+	0x2: {Sym: "enable_push"},
+	0x3: {Sym: "max_concurrent_streams"},
+	0x4: {Sym: "initial_window_size"},
+	0x5: {Sym: "max_frame_size"},
+	0x6: {Sym: "max_header_list_size"},
+	0x8: {Sym: "enable_connect_protocol"},
+}
+
+type http2Stream struct {
+	id              uint64
+	promisedHeaders []hpackHeaderField
+	headers         []hpackHeaderField
+	trailers        []hpackHeaderField
+	data            bytes.Buffer
+	hasData         bool
+}
+
+type http2Decoder struct {
+	hpack   *hpackDecoder
+	streams map[uint64]*http2Stream
+	order   []uint64
+	// header block fragments waiting for END_HEADERS
+	blockFn   func(fs []hpackHeaderField)
+	blockFrag bytes.Buffer
+}
+
+func (hd *http2Decoder) stream(id uint64) *http2Stream {
+	if s, ok := hd.streams[id]; ok {
+		return s
+	}
+	s := &http2Stream{id: id}
+	hd.streams[id] = s
+	hd.order = append(hd.order, id)
+	return s
+}
+
+// looks like a SETTINGS frame on stream 0, server connection preface
+func isHTTP2SettingsFrame(d *decode.D) bool {
+	if d.BitsLeft() < http2FrameHeaderLen*8 {
+		return false
+	}
+	length := d.PeekBits(24)
+	bs := d.PeekBytes(http2FrameHeaderLen)
+	typ := bs[3]
+	flags := bs[4]
+	streamID := uint64(bs[5]&0x7f)<<24 | uint64(bs[6])<<16 | uint64(bs[7])<<8 | uint64(bs[8])
+	return typ == http2FrameTypeSettings && flags&^http2FlagAck == 0 && streamID == 0 && length%6 == 0
+}
+
+func fieldHTTP2Flags(d *decode.D, typ uint64) uint64 {
+	flags := d.PeekBits(8)
+	names, ok := http2FrameFlags[typ]
+	if !ok {
+		d.FieldU8("flags", scalar.Hex)
+		return flags
+	}
+	d.FieldStruct("flags", func(d *decode.D) {
+		unused := 0
+		unusedLen := 0
+		for i, name := range names {
+			if name == "" {
+				unusedLen++
+				if i < len(names)-1 && names[i+1] == "" {
+					continue
+				}
+				d.FieldU(fmt.Sprintf("unused%d", unused), unusedLen)
+				unused++
+				unusedLen = 0
+				continue
+			}
+			d.FieldBool(name)
+		}
+	})
+	return flags
+}
+
+func fieldHTTP2Headers(d *decode.D, name string, fs []hpackHeaderField) {
+	d.FieldArray(name, func(d *decode.D) {
+		for _, f := range fs {
+			d.FieldStruct("header", func(d *decode.D) {
+				d.FieldValueStr("name", f.name)
+				d.FieldValueStr("value", f.value)
+			})
+		}
+	})
+}
+
+// decodes header block fragment, when END_HEADERS is set decode header block
+// in place or if it has been split into CONTINUATION frames concatenated as a new buffer
+func (hd *http2Decoder) headerBlockFragment(d *decode.D, nBits int64, endHeaders bool, fn func(fs []hpackHeaderField)) {
+	if fn != nil {
+		hd.blockFn = fn
+		hd.blockFrag.Reset()
+	}
+	if endHeaders && fn != nil {
+		var fs []hpackHeaderField
+		d.FramedFn(nBits, func(d *decode.D) {
+			d.FieldArray("header_block", func(d *decode.D) { fs = hd.hpack.decodeBlock(d) })
+		})
+		hd.blockFn(fs)
+		hd.blockFn = nil
+		return
+	}
+
+	d.FieldRawLen("header_block_fragment", nBits)
+	hd.blockFrag.Write(d.BytesRange(d.Pos()-nBits, int(nBits/8)))
+	if endHeaders && hd.blockFn != nil {
+		var fs []hpackHeaderField
+		d.FieldArrayRootBitBufFn("header_block", bitio.NewBitReader(hd.blockFrag.Bytes(), -1), func(d *decode.D) {
+			fs = hd.hpack.decodeBlock(d)
+		})
+		hd.blockFn(fs)
+		hd.blockFn = nil
+	}
+}
+
+func (hd *http2Decoder) decodeFrame(d *decode.D) {
+	length := d.FieldU24("length")
+	typ := d.FieldU8("type", http2FrameTypeMap, scalar.Hex)
+	flags := fieldHTTP2Flags(d, typ)
+	d.FieldU1("reserved")
+	streamID := d.FieldU31("stream_identifier")
+
+	padded := flags&http2FlagPadded != 0
+	endHeaders := flags&http2FlagEndHeaders != 0
+
+	d.FramedFn(int64(length)*8, func(d *decode.D) {
+		padLength := int64(0)
+		fieldPadLength := func() {
+			if padded {
+				padLength = int64(d.FieldU8("pad_length")) * 8
+			}
+		}
+		fieldPadding := func() {
+			if padded {
+				d.FieldRawLen("padding", padLength)
+			}
+		}
+		fieldPriority := func() {
+			d.FieldBool("exclusive")
+			d.FieldU31("stream_dependency")
+			d.FieldU8("weight", scalar.UAdd(1))
+		}
+
+		switch typ {
+		case http2FrameTypeData:
+			fieldPadLength()
+			dataLen := d.BitsLeft() - padLength
+			d.FieldRawLen("data", dataLen)
+			s := hd.stream(streamID)
+			s.hasData = true
+			s.data.Write(d.BytesRange(d.Pos()-dataLen, int(dataLen/8)))
+			fieldPadding()
+		case http2FrameTypeHeaders:
+			fieldPadLength()
+			if flags&http2FlagPriority != 0 {
+				fieldPriority()
+			}
+			s := hd.stream(streamID)
+			hd.headerBlockFragment(d, d.BitsLeft()-padLength, endHeaders, func(fs []hpackHeaderField) {
+				if s.headers == nil {
+					s.headers = fs
+				} else {
+					s.trailers = fs
+				}
+			})
+			fieldPadding()
+		case http2FrameTypePriority:
+			fieldPriority()
+		case http2FrameTypeRSTStream:
+			d.FieldU32("error_code", http2ErrorCodeMap)
+		case http2FrameTypeSettings:
+			d.FieldArray("settings", func(d *decode.D) {
+				for !d.End() {
+					d.FieldStruct("setting", func(d *decode.D) {
+						d.FieldU16("identifier", http2SettingsMap, scalar.Hex)
+						d.FieldU32("value")
+					})
+				}
+			})
+		case http2FrameTypePushPromise:
+			fieldPadLength()
+			d.FieldU1("reserved1")
+			promisedID := d.FieldU31("promised_stream_id")
+			s := hd.stream(promisedID)
+			hd.headerBlockFragment(d, d.BitsLeft()-padLength, endHeaders, func(fs []hpackHeaderField) {
+				s.promisedHeaders = fs
+			})
+			fieldPadding()
+		case http2FrameTypePing:
+			d.FieldRawLen("opaque_data", d.BitsLeft())
+		case http2FrameTypeGoAway:
+			d.FieldU1("reserved1")
+			d.FieldU31("last_stream_id")
+			d.FieldU32("error_code", http2ErrorCodeMap)
+			d.FieldUTF8("additional_debug_data", int(d.BitsLeft()/8))
+		case http2FrameTypeWindowUpdate:
+			d.FieldU1("reserved1")
+			d.FieldU31("window_size_increment")
+		case http2FrameTypeContinuation:
+			hd.headerBlockFragment(d, d.BitsLeft(), endHeaders, nil)
+		default:
+			d.FieldRawLen("payload", d.BitsLeft())
+		}
+	})
+}
+
+func decodeHTTP2(d *decode.D, in interface{}) interface{} {
+	if _, ok := in.(format.TCPStreamIn); !ok {
+		d.Fatalf("no tcp stream input")
+	}
+
+	isClient := d.BitsLeft() >= int64(len(http2Preface))*8 &&
+		string(d.PeekBytes(len(http2Preface))) == http2Preface
+	if !isClient && !isHTTP2SettingsFrame(d) {
+		d.Fatalf("no HTTP/2 connection preface")
+	}
+	if isClient {
+		d.FieldUTF8("preface", len(http2Preface))
+	}
+
+	hd := &http2Decoder{
+		hpack:   newHPACKDecoder(),
+		streams: map[uint64]*http2Stream{},
+	}
+	d.FieldArray("frames", func(d *decode.D) {
+		for d.BitsLeft() >= http2FrameHeaderLen*8 {
+			length := int64(d.PeekBits(24))
+			if (http2FrameHeaderLen+length)*8 > d.BitsLeft() {
+				break
+			}
+			d.FieldStruct("frame", hd.decodeFrame)
+		}
+	})
+	if !d.End() {
+		// truncated frame or gap in stream
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	d.FieldArray("streams", func(d *decode.D) {
+		for _, id := range hd.order {
+			s := hd.streams[id]
+			// stream 0 is connection control
+			if id == 0 {
+				continue
+			}
+			d.FieldStruct("stream", func(d *decode.D) {
+				d.FieldValueU("stream_identifier", s.id)
+				if s.promisedHeaders != nil {
+					fieldHTTP2Headers(d, "promised_headers", s.promisedHeaders)
+				}
+				hs := headers{}
+				if s.headers != nil {
+					fieldHTTP2Headers(d, "headers", s.headers)
+					for _, f := range s.headers {
+						hs[strings.ToLower(f.name)] = f.value
+					}
+				}
+				if s.trailers != nil {
+					fieldHTTP2Headers(d, "trailers", s.trailers)
+				}
+				if s.hasData {
+					decodeBody(d, hs, &http2BodyFormats, func(g *decode.Group) {
+						fieldBody(d, "body", bitio.NewBitReader(s.data.Bytes(), -1), g)
+					}, s.data.Bytes)
+				}
+			})
+		}
+	})
+
+	return nil
+}
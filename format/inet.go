@@ -274,7 +274,15 @@ var LinkTypeMap = scalar.UToScalar{
 }
 
 const (
-	EtherTypeIPv4 = 0x0800
+	EtherTypeIPv4          = 0x0800
+	EtherTypeARP           = 0x0806
+	EtherTypeTEB           = 0x6558 // Transparent Ethernet Bridging, used by GRE
+	EtherTypeVLAN          = 0x8100
+	EtherTypeIPv6          = 0x86dd
+	EtherTypeMPLSUnicast   = 0x8847
+	EtherTypeMPLSMulticast = 0x8848
+	EtherTypeQinQ          = 0x88a8
+	EtherTypeQinQOld       = 0x9100
 )
 
 // from https://en.wikipedia.org/wiki/EtherType
@@ -289,6 +297,7 @@ var EtherTypeMap = scalar.UToScalar{
 	0x6002:        {Sym: "dec", Description: `DEC MOP RC`},
 	0x6003:        {Sym: "decnet", Description: `DECnet Phase IV, DNA Routing`},
 	0x6004:        {Sym: "declat", Description: `DEC LAT`},
+	0x6558:        {Sym: "teb", Description: `Transparent Ethernet Bridging`},
 	0x8035:        {Sym: "Reverse", Description: `Reverse Address Resolution Protocol`},
 	0x809b:        {Sym: "appletalk", Description: `AppleTalk`},
 	0x80f3:        {Sym: "appletalk_arp", Description: `AppleTalk Address Resolution Protocol`},
@@ -297,7 +306,7 @@ var EtherTypeMap = scalar.UToScalar{
 	0x8103:        {Sym: "vlacp", Description: `Virtual Link Aggregation Control Protocol`},
 	0x8137:        {Sym: "ipx", Description: `IPX`},
 	0x8204:        {Sym: "qnx", Description: `QNX Qnet`},
-	0x86dd:        {Sym: "ipv6", Description: `Internet Protocol Version 6`},
+	EtherTypeIPv6: {Sym: "ipv6", Description: `Internet Protocol Version 6`},
 	0x8808:        {Sym: "flow_control", Description: `Ethernet flow control`},
 	0x8809:        {Sym: "lacp", Description: `Ethernet Slow Protocols] such as the Link Aggregation Control Protocol`},
 	0x8819:        {Sym: "cobranet", Description: `CobraNet`},
@@ -334,6 +343,7 @@ var EtherTypeMap = scalar.UToScalar{
 	0x893a:        {Sym: "1905", Description: `1905.1 IEEE Protocol`},
 	0x892f:        {Sym: "high", Description: `High-availability Seamless Redundancy (HSR)`},
 	0x9000:        {Sym: "ethernet", Description: `Ethernet Configuration Testing Protocol[12]`},
+	0x9100:        {Sym: "qinq", Description: `VLAN double tagging (Q-in-Q), non-standard`},
 	0xf1c1:        {Sym: "redundancy", Description: `Redundancy Tag (IEEE 802.1CB Frame Replication and Elimination for Reliability)`},
 }
 
@@ -345,6 +355,20 @@ const (
 	IPv4ProtocolIGMP = 2
 	IPv4ProtocolTCP  = 6
 	IPv4ProtocolUDP  = 17
+	IPv4ProtocolGRE  = 47
+)
+
+// IPv6 next header values, same number space as IPv4 protocol
+const (
+	IPv6NextHeaderHopByHop = 0
+	IPv6NextHeaderTCP      = IPv4ProtocolTCP
+	IPv6NextHeaderUDP      = IPv4ProtocolUDP
+	IPv6NextHeaderGRE      = IPv4ProtocolGRE
+	IPv6NextHeaderRouting  = 43
+	IPv6NextHeaderFragment = 44
+	IPv6NextHeaderICMPv6   = 58
+	IPv6NextHeaderNoNext   = 59
+	IPv6NextHeaderDestOpts = 60
 )
 
 var IPv4ProtocolMap = scalar.UToScalar{
@@ -492,7 +516,9 @@ var IPv4ProtocolMap = scalar.UToScalar{
 
 const (
 	UDPPortDomain = 53
+	UDPPortHTTPS  = 443
 	UDPPortMDNS   = 5353
+	UDPPortVXLAN  = 4789
 )
 
 var UDPPortMap = scalar.UToScalar{
@@ -1175,11 +1201,16 @@ var UDPPortMap = scalar.UToScalar{
 	1000:          {Sym: "cadlock2"},
 	1010:          {Sym: "surf", Description: "surf"},
 
-	UDPPortMDNS: {Sym: "mdns", Description: "Multicast DNS"},
+	UDPPortVXLAN: {Sym: "vxlan", Description: "Virtual eXtensible Local Area Network"},
+	UDPPortMDNS:  {Sym: "mdns", Description: "Multicast DNS"},
 }
 
 const (
-	TCPPortDomain = 53
+	TCPPortDomain   = 53
+	TCPPortHTTP     = 80
+	TCPPortHTTPAlt  = 8080
+	TCPPortHTTPS    = 443
+	TCPPortHTTPSAlt = 8443
 )
 
 var TCPPortMap = scalar.UToScalar{
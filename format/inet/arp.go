@@ -0,0 +1,75 @@
+package inet
+
+// https://en.wikipedia.org/wiki/Address_Resolution_Protocol
+// https://www.rfc-editor.org/rfc/rfc826
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.ARP,
+		Description: "Address Resolution Protocol",
+		DecodeFn:    decodeARP,
+	})
+}
+
+const (
+	arpHardwareTypeEthernet = 1
+)
+
+var arpHardwareTypeMap = scalar.UToScalar{
+	arpHardwareTypeEthernet: {Sym: "ethernet", Description: "Ethernet"},
+	6:                       {Sym: "ieee802", Description: "IEEE 802 networks"},
+	15:                      {Sym: "frame_relay", Description: "Frame relay"},
+	16:                      {Sym: "atm", Description: "Asynchronous transmission mode"},
+	18:                      {Sym: "fibre_channel", Description: "Fibre channel"},
+	20:                      {Sym: "serial_line", Description: "Serial line"},
+	32:                      {Sym: "infiniband", Description: "InfiniBand"},
+}
+
+var arpOpcodeMap = scalar.UToScalar{
+	1: {Sym: "request", Description: "Request"},
+	2: {Sym: "reply", Description: "Reply"},
+	3: {Sym: "rarp_request", Description: "Reverse request"},
+	4: {Sym: "rarp_reply", Description: "Reverse reply"},
+	8: {Sym: "inarp_request", Description: "Inverse request"},
+	9: {Sym: "inarp_reply", Description: "Inverse reply"},
+}
+
+func decodeARP(d *decode.D, in interface{}) interface{} {
+	hardwareType := d.FieldU16("hardware_type", arpHardwareTypeMap)
+	protocolType := d.FieldU16("protocol_type", format.EtherTypeMap, scalar.Hex)
+	hardwareSize := d.FieldU8("hardware_size")
+	protocolSize := d.FieldU8("protocol_size")
+	d.FieldU16("opcode", arpOpcodeMap)
+
+	fieldHardwareAddress := func(name string) {
+		if hardwareType == arpHardwareTypeEthernet && hardwareSize == 6 {
+			d.FieldU(name, 48, mapUToEtherSym, scalar.Hex)
+		} else {
+			d.FieldRawLen(name, int64(hardwareSize)*8)
+		}
+	}
+	fieldProtocolAddress := func(name string) {
+		switch {
+		case protocolType == format.EtherTypeIPv4 && protocolSize == 4:
+			d.FieldU32(name, mapUToIPv4Sym, scalar.Hex)
+		case protocolType == format.EtherTypeIPv6 && protocolSize == 16:
+			fieldIPv6Address(d, name)
+		default:
+			d.FieldRawLen(name, int64(protocolSize)*8)
+		}
+	}
+
+	fieldHardwareAddress("sender_hardware_address")
+	fieldProtocolAddress("sender_protocol_address")
+	fieldHardwareAddress("target_hardware_address")
+	fieldProtocolAddress("target_protocol_address")
+
+	return nil
+}
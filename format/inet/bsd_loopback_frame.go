@@ -10,6 +10,7 @@ import (
 )
 
 var bsdLoopbackFrameIPv4Format decode.Group
+var bsdLoopbackFrameIPv6Format decode.Group
 
 func init() {
 	registry.MustRegister(decode.Format{
@@ -18,21 +19,32 @@ func init() {
 		Groups:      []string{format.LINK_FRAME},
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.IPV4_PACKET}, Group: &bsdLoopbackFrameIPv4Format},
+			{Names: []string{format.IPV6_PACKET}, Group: &bsdLoopbackFrameIPv6Format},
 		},
 		DecodeFn: decodeLoopbackFrame,
 	})
 }
 
+// IPv6 AF_INET6 value differs between BSDs
 const (
-	bsdLoopbackNetworkLayerIPv4 = 2
+	bsdLoopbackNetworkLayerIPv4        = 2
+	bsdLoopbackNetworkLayerIPv6        = 24 // NetBSD, OpenBSD, BSD/OS
+	bsdLoopbackNetworkLayerIPv6FreeBSD = 28
+	bsdLoopbackNetworkLayerIPv6Darwin  = 30
 )
 
 var bsdLoopbackFrameNetworkLayerFormat = map[uint64]*decode.Group{
-	bsdLoopbackNetworkLayerIPv4: &bsdLoopbackFrameIPv4Format,
+	bsdLoopbackNetworkLayerIPv4:        &bsdLoopbackFrameIPv4Format,
+	bsdLoopbackNetworkLayerIPv6:        &bsdLoopbackFrameIPv6Format,
+	bsdLoopbackNetworkLayerIPv6FreeBSD: &bsdLoopbackFrameIPv6Format,
+	bsdLoopbackNetworkLayerIPv6Darwin:  &bsdLoopbackFrameIPv6Format,
 }
 
 var bsdLookbackNetworkLayerMap = scalar.UToScalar{
-	bsdLoopbackNetworkLayerIPv4: {Sym: "ipv4", Description: `Internet protocol v4`},
+	bsdLoopbackNetworkLayerIPv4:        {Sym: "ipv4", Description: `Internet protocol v4`},
+	bsdLoopbackNetworkLayerIPv6:        {Sym: "ipv6", Description: `Internet protocol v6`},
+	bsdLoopbackNetworkLayerIPv6FreeBSD: {Sym: "ipv6", Description: `Internet protocol v6`},
+	bsdLoopbackNetworkLayerIPv6Darwin:  {Sym: "ipv6", Description: `Internet protocol v6`},
 }
 
 func decodeLoopbackFrame(d *decode.D, in interface{}) interface{} {
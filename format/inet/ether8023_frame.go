@@ -13,6 +13,9 @@ import (
 )
 
 var ether8023FrameIPv4Format decode.Group
+var ether8023FrameIPv6Format decode.Group
+var ether8023FrameARPFormat decode.Group
+var ether8023FrameMPLSFormat decode.Group
 
 func init() {
 	registry.MustRegister(decode.Format{
@@ -21,13 +24,30 @@ func init() {
 		Groups:      []string{format.LINK_FRAME},
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.IPV4_PACKET}, Group: &ether8023FrameIPv4Format},
+			{Names: []string{format.IPV6_PACKET}, Group: &ether8023FrameIPv6Format},
+			{Names: []string{format.ARP}, Group: &ether8023FrameARPFormat},
+			{Names: []string{format.MPLS}, Group: &ether8023FrameMPLSFormat},
 		},
 		DecodeFn: decodeEthernetFrame,
 	})
 }
 
 var ether8023FrameTypeFormat = map[uint64]*decode.Group{
-	format.EtherTypeIPv4: &ether8023FrameIPv4Format,
+	format.EtherTypeIPv4:          &ether8023FrameIPv4Format,
+	format.EtherTypeIPv6:          &ether8023FrameIPv6Format,
+	format.EtherTypeARP:           &ether8023FrameARPFormat,
+	format.EtherTypeMPLSUnicast:   &ether8023FrameMPLSFormat,
+	format.EtherTypeMPLSMulticast: &ether8023FrameMPLSFormat,
+}
+
+// 802.1Q VLAN tag and 802.1ad (Q-in-Q) service tag
+func isVLANEtherType(t uint64) bool {
+	switch t {
+	case format.EtherTypeVLAN, format.EtherTypeQinQ, format.EtherTypeQinQOld:
+		return true
+	default:
+		return false
+	}
 }
 
 // TODO: move to shared?
@@ -47,6 +67,18 @@ func decodeEthernetFrame(d *decode.D, in interface{}) interface{} {
 
 	d.FieldU("destination", 48, mapUToEtherSym, scalar.Hex)
 	d.FieldU("source", 48, mapUToEtherSym, scalar.Hex)
+	if isVLANEtherType(d.PeekBits(16)) {
+		d.FieldArray("vlan_tags", func(d *decode.D) {
+			for isVLANEtherType(d.PeekBits(16)) {
+				d.FieldStruct("vlan_tag", func(d *decode.D) {
+					d.FieldU16("tpid", format.EtherTypeMap, scalar.Hex)
+					d.FieldU3("pcp")
+					d.FieldBool("dei")
+					d.FieldU12("vid")
+				})
+			}
+		})
+	}
 	etherType := d.FieldU16("ether_type", format.EtherTypeMap, scalar.Hex)
 	if g, ok := ether8023FrameTypeFormat[etherType]; ok {
 		d.FieldFormatLen("packet", d.BitsLeft(), *g, nil)
@@ -6,6 +6,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"net"
+	"sort"
+	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/ip4defrag"
@@ -13,16 +15,77 @@ import (
 	"github.com/google/gopacket/reassembly"
 )
 
+// PacketInfo is capture metadata for a packet
+type PacketInfo struct {
+	Index     int // index of packet in capture, pcap packets or pcapng section blocks
+	Timestamp time.Time
+}
+
 type IPEndpoint struct {
 	IP   net.IP
 	Port int
 }
 
+// TCPChunk is a part of a reassembled stream and which packet it came from
+type TCPChunk struct {
+	PacketIndex  int
+	StreamOffset int
+	Length       int
+	Timestamp    time.Time
+}
+
+// TCPGap is missing bytes at offset in a reassembled stream
+type TCPGap struct {
+	StreamOffset int
+	Length       int
+}
+
+type TCPDirection struct {
+	Buffer          *bytes.Buffer
+	Chunks          []TCPChunk
+	Gaps            []TCPGap
+	Retransmissions int // segments with only already seen data
+	SYN             bool
+	FIN             bool
+	RST             bool
+}
+
+// Contiguous returns stream data up to the first gap
+func (td *TCPDirection) Contiguous() []byte {
+	b := td.Buffer.Bytes()
+	if len(td.Gaps) > 0 {
+		return b[0:td.Gaps[0].StreamOffset]
+	}
+	return b
+}
+
+type TCPHandshake int
+
+const (
+	TCPHandshakeMissing TCPHandshake = iota
+	TCPHandshakePartial
+	TCPHandshakeComplete
+)
+
+func (h TCPHandshake) String() string {
+	switch h {
+	case TCPHandshakePartial:
+		return "partial"
+	case TCPHandshakeComplete:
+		return "complete"
+	default:
+		return "missing"
+	}
+}
+
 type TCPConnection struct {
 	ClientEndpoint IPEndpoint
 	ServerEndpoint IPEndpoint
-	ClientToServer *bytes.Buffer
-	ServerToClient *bytes.Buffer
+	ClientToServer *TCPDirection
+	ServerToClient *TCPDirection
+	Handshake      TCPHandshake
+	FirstTimestamp time.Time
+	LastTimestamp  time.Time
 
 	tcpState   *reassembly.TCPSimpleFSM
 	optChecker reassembly.TCPOptionCheck
@@ -30,7 +93,43 @@ type TCPConnection struct {
 	transport  gopacket.Flow
 }
 
+// State is the state of the TCP state machine, ex: Established, CloseWait, Reset
+func (t *TCPConnection) State() string {
+	return t.tcpState.String()
+}
+
+func (t *TCPConnection) direction(dir reassembly.TCPFlowDirection) *TCPDirection {
+	if dir == reassembly.TCPDirClientToServer {
+		return t.ClientToServer
+	}
+	return t.ServerToClient
+}
+
 func (t *TCPConnection) Accept(tcp *layers.TCP, ci gopacket.CaptureInfo, dir reassembly.TCPFlowDirection, nextSeq reassembly.Sequence, start *bool, ac reassembly.AssemblerContext) bool {
+	// keep track of flags and timing for all packets even if not accepted
+	if t.FirstTimestamp.IsZero() || ci.Timestamp.Before(t.FirstTimestamp) {
+		t.FirstTimestamp = ci.Timestamp
+	}
+	if ci.Timestamp.After(t.LastTimestamp) {
+		t.LastTimestamp = ci.Timestamp
+	}
+	td := t.direction(dir)
+	td.SYN = td.SYN || tcp.SYN
+	td.FIN = td.FIN || tcp.FIN
+	td.RST = td.RST || tcp.RST
+	// negative nextSeq means not known yet
+	if len(tcp.Payload) > 0 && nextSeq >= 0 &&
+		nextSeq.Difference(reassembly.Sequence(tcp.Seq).Add(len(tcp.Payload))) <= 0 {
+		td.Retransmissions++
+	}
+	switch {
+	case tcp.SYN && t.Handshake == TCPHandshakeMissing:
+		t.Handshake = TCPHandshakePartial
+	case dir == reassembly.TCPDirClientToServer && !tcp.SYN && tcp.ACK &&
+		t.Handshake == TCPHandshakePartial && t.ClientToServer.SYN && t.ServerToClient.SYN:
+		t.Handshake = TCPHandshakeComplete
+	}
+
 	// has ok state?
 	if !t.tcpState.CheckState(tcp, dir) {
 		// TODO: handle err?
@@ -50,23 +149,44 @@ func (t *TCPConnection) Accept(tcp *layers.TCP, ci gopacket.CaptureInfo, dir rea
 func (t *TCPConnection) ReassembledSG(sg reassembly.ScatterGather, ac reassembly.AssemblerContext) {
 	dir, _, _, skip := sg.Info()
 	length, _ := sg.Lengths()
-
-	if skip == -1 {
-		// can't find where skip == -1 is documented but this is what gopacket reassemblydump does
-		// to allow missing syn/ack
-	} else if skip != 0 {
-		// stream has missing bytes
-		return
+	td := t.direction(dir)
+
+	// skip == -1 seems to mean unknown start, ex missing syn/ack, this is what gopacket reassemblydump does
+	// skip > 0 is number of missing bytes before this data
+	if skip > 0 {
+		td.Gaps = append(td.Gaps, TCPGap{
+			StreamOffset: td.Buffer.Len(),
+			Length:       skip,
+		})
 	}
 
-	data := sg.Fetch(length)
-
-	switch dir {
-	case reassembly.TCPDirClientToServer:
-		t.ClientToServer.Write(data)
-	case reassembly.TCPDirServerToClient:
-		t.ServerToClient.Write(data)
+	// sg can consist of data from multiple packets, find where each packet starts and ends.
+	// packets are in stream order so binary search for end of each one
+	packetIndex := func(offset int) int {
+		ci := sg.CaptureInfo(offset)
+		if len(ci.AncillaryData) > 0 {
+			if i, ok := ci.AncillaryData[0].(int); ok {
+				return i
+			}
+		}
+		return -1
 	}
+	for offset := 0; offset < length; {
+		index := packetIndex(offset)
+		n := sort.Search(length-offset, func(i int) bool { return packetIndex(offset+i) != index })
+		if n == 0 {
+			n = 1
+		}
+		td.Chunks = append(td.Chunks, TCPChunk{
+			PacketIndex:  index,
+			StreamOffset: td.Buffer.Len() + offset,
+			Length:       n,
+			Timestamp:    sg.CaptureInfo(offset).Timestamp,
+		})
+		offset += n
+	}
+
+	td.Buffer.Write(sg.Fetch(length))
 }
 
 func (t *TCPConnection) ReassemblyComplete(ac reassembly.AssemblerContext) bool {
@@ -74,12 +194,48 @@ func (t *TCPConnection) ReassemblyComplete(ac reassembly.AssemblerContext) bool
 	return false
 }
 
+type UDPDatagram struct {
+	PacketIndex int
+	Timestamp   time.Time
+	Payload     []byte
+}
+
+// UDPFlow is all datagrams for a 5-tuple, first seen sender is the client
+type UDPFlow struct {
+	ClientEndpoint IPEndpoint
+	ServerEndpoint IPEndpoint
+	ClientToServer []UDPDatagram
+	ServerToClient []UDPDatagram
+	FirstTimestamp time.Time
+	LastTimestamp  time.Time
+}
+
+func (f *UDPFlow) addTimestamp(ts time.Time) {
+	if ts.Before(f.FirstTimestamp) {
+		f.FirstTimestamp = ts
+	}
+	if ts.After(f.LastTimestamp) {
+		f.LastTimestamp = ts
+	}
+}
+
+type udpFlowKey struct {
+	net       gopacket.Flow
+	transport gopacket.Flow
+}
+
 type IPV4Reassembled struct {
 	SourceIP      net.IP
 	DestinationIP net.IP
 	Datagram      []byte
 }
 
+type IPV6Reassembled struct {
+	SourceIP      net.IP
+	DestinationIP net.IP
+	Datagram      []byte
+}
+
 func (fd *Decoder) New(net, transport gopacket.Flow, tcp *layers.TCP, ac reassembly.AssemblerContext) reassembly.Stream {
 	fsmOptions := reassembly.TCPSimpleFSMOptions{
 		SupportMissingEstablishment: true,
@@ -106,8 +262,8 @@ func (fd *Decoder) New(net, transport gopacket.Flow, tcp *layers.TCP, ac reassem
 			IP:   append([]byte(nil), net.Dst().Raw()...),
 			Port: serverPort,
 		},
-		ClientToServer: &bytes.Buffer{},
-		ServerToClient: &bytes.Buffer{},
+		ClientToServer: &TCPDirection{Buffer: &bytes.Buffer{}},
+		ServerToClient: &TCPDirection{Buffer: &bytes.Buffer{}},
 
 		net:        net,
 		transport:  transport,
@@ -123,8 +279,12 @@ func (fd *Decoder) New(net, transport gopacket.Flow, tcp *layers.TCP, ac reassem
 type Decoder struct {
 	TCPConnections  []*TCPConnection
 	IPV4Reassembled []IPV4Reassembled
+	IPV6Reassembled []IPV6Reassembled
+	UDPFlows        []*UDPFlow
 
+	udpFlows     map[udpFlowKey]*UDPFlow
 	ipv4Defrag   *ip4defrag.IPv4Defragmenter
+	ipv6Defrag   *ipv6Defragmenter
 	tcpAssembler *reassembly.Assembler
 }
 
@@ -134,23 +294,25 @@ func New() *Decoder {
 	tcpAssembler := reassembly.NewAssembler(streamPool)
 	flowDecoder.tcpAssembler = tcpAssembler
 	flowDecoder.ipv4Defrag = ip4defrag.NewIPv4Defragmenter()
+	flowDecoder.ipv6Defrag = newIPv6Defragmenter()
+	flowDecoder.udpFlows = map[udpFlowKey]*UDPFlow{}
 
 	return flowDecoder
 }
 
-func (fd *Decoder) SLLPacket(bs []byte) error {
-	return fd.packet(gopacket.NewPacket(bs, layers.LayerTypeLinuxSLL, gopacket.Lazy))
+func (fd *Decoder) SLLPacket(bs []byte, pi PacketInfo) error {
+	return fd.packet(gopacket.NewPacket(bs, layers.LayerTypeLinuxSLL, gopacket.Lazy), pi)
 }
 
-func (fd *Decoder) EthernetFrame(bs []byte) error {
-	return fd.packet(gopacket.NewPacket(bs, layers.LayerTypeEthernet, gopacket.Lazy))
+func (fd *Decoder) EthernetFrame(bs []byte, pi PacketInfo) error {
+	return fd.packet(gopacket.NewPacket(bs, layers.LayerTypeEthernet, gopacket.Lazy), pi)
 }
 
-func (fd *Decoder) LoopbackFrame(bs []byte) error {
-	return fd.packet(gopacket.NewPacket(bs, layers.LayerTypeLoopback, gopacket.Lazy))
+func (fd *Decoder) LoopbackFrame(bs []byte, pi PacketInfo) error {
+	return fd.packet(gopacket.NewPacket(bs, layers.LayerTypeLoopback, gopacket.Lazy), pi)
 }
 
-func (fd *Decoder) packet(p gopacket.Packet) error {
+func (fd *Decoder) packet(p gopacket.Packet, pi PacketInfo) error {
 	// TODO: linkType
 	ip4Layer := p.Layer(layers.LayerTypeIPv4)
 	if ip4Layer != nil {
@@ -191,15 +353,116 @@ func (fd *Decoder) packet(p gopacket.Packet) error {
 		}
 	}
 
-	tcp := p.Layer(layers.LayerTypeTCP)
-	if tcp != nil {
-		tcp, _ := tcp.(*layers.TCP)
-		fd.tcpAssembler.Assemble(p.NetworkLayer().NetworkFlow(), tcp)
+	ip6FragLayer := p.Layer(layers.LayerTypeIPv6Fragment)
+	if ip6FragLayer != nil {
+		ip6Frag, _ := ip6FragLayer.(*layers.IPv6Fragment)
+		ip6, _ := p.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+		if ip6 != nil {
+			newIPv6, err := fd.ipv6Defrag.DefragIPv6(ip6, ip6Frag)
+			if err != nil {
+				return err
+			} else if newIPv6 != nil {
+				sb := gopacket.NewSerializeBuffer()
+				b, _ := sb.PrependBytes(len(newIPv6.Payload))
+				copy(b, newIPv6.Payload)
+				if err := newIPv6.SerializeTo(sb, gopacket.SerializeOptions{
+					FixLengths: true,
+				}); err != nil {
+					return err
+				}
+
+				fd.IPV6Reassembled = append(fd.IPV6Reassembled, IPV6Reassembled{
+					SourceIP:      ip6.SrcIP,
+					DestinationIP: ip6.DstIP,
+					Datagram:      sb.Bytes(),
+				})
+
+				pb, ok := p.(gopacket.PacketBuilder)
+				if !ok {
+					panic("not a PacketBuilder")
+				}
+				if err := newIPv6.NextHeader.LayerType().Decode(newIPv6.Payload, pb); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// use innermost network layer before TCP or UDP, can be tunneled using GRE, VXLAN etc
+	// for UDP the last one is used as it might be a tunnel itself
+	var networkLayer gopacket.NetworkLayer
+	var udpNetworkLayer gopacket.NetworkLayer
+	var udp *layers.UDP
+	for _, l := range p.Layers() {
+		switch l := l.(type) {
+		case gopacket.NetworkLayer:
+			networkLayer = l
+		case *layers.TCP:
+			if networkLayer != nil {
+				fd.tcpAssembler.AssembleWithContext(networkLayer.NetworkFlow(), l, &assemblerContext{
+					ci: gopacket.CaptureInfo{
+						Timestamp:     pi.Timestamp,
+						AncillaryData: []interface{}{pi.Index},
+					},
+				})
+			}
+			return nil
+		case *layers.UDP:
+			udpNetworkLayer = networkLayer
+			udp = l
+		}
+	}
+	if udp != nil && udpNetworkLayer != nil {
+		fd.udpDatagram(udpNetworkLayer.NetworkFlow(), udp, pi)
 	}
 
 	return nil
 }
 
+// capture info with packet index as ancillary data so that reassembled data can be mapped back to packets
+type assemblerContext struct {
+	ci gopacket.CaptureInfo
+}
+
+func (ac *assemblerContext) GetCaptureInfo() gopacket.CaptureInfo { return ac.ci }
+
+func (fd *Decoder) udpDatagram(netFlow gopacket.Flow, udp *layers.UDP, pi PacketInfo) {
+	transportFlow := udp.TransportFlow()
+	ts := pi.Timestamp
+	dg := UDPDatagram{
+		PacketIndex: pi.Index,
+		Timestamp:   ts,
+		Payload:     append([]byte(nil), udp.Payload...),
+	}
+
+	if f, ok := fd.udpFlows[udpFlowKey{net: netFlow, transport: transportFlow}]; ok {
+		f.ClientToServer = append(f.ClientToServer, dg)
+		f.addTimestamp(ts)
+		return
+	}
+	if f, ok := fd.udpFlows[udpFlowKey{net: netFlow.Reverse(), transport: transportFlow.Reverse()}]; ok {
+		f.ServerToClient = append(f.ServerToClient, dg)
+		f.addTimestamp(ts)
+		return
+	}
+
+	f := &UDPFlow{
+		ClientEndpoint: IPEndpoint{
+			IP:   append([]byte(nil), netFlow.Src().Raw()...),
+			Port: int(udp.SrcPort),
+		},
+		ServerEndpoint: IPEndpoint{
+			IP:   append([]byte(nil), netFlow.Dst().Raw()...),
+			Port: int(udp.DstPort),
+		},
+		ClientToServer: []UDPDatagram{dg},
+		FirstTimestamp: ts,
+		LastTimestamp:  ts,
+	}
+	fd.udpFlows[udpFlowKey{net: netFlow, transport: transportFlow}] = f
+	fd.UDPFlows = append(fd.UDPFlows, f)
+}
+
 func (fd *Decoder) Flush() {
 	fd.tcpAssembler.FlushAll()
 }
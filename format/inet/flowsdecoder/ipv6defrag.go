@@ -0,0 +1,119 @@
+package flowsdecoder
+
+// gopacket has no IPv6 defragmenter so this is a simple one based on
+// https://www.rfc-editor.org/rfc/rfc8200#section-4.5
+// TODO: timeout old fragments?
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	ipv6MaximumSize            = 65535
+	ipv6MaximumFragmentListLen = 8192
+)
+
+type ipv6FragmentKey struct {
+	src, dst       [16]byte
+	identification uint32
+}
+
+type ipv6Fragment struct {
+	offset int
+	data   []byte
+}
+
+type ipv6FragmentList struct {
+	first     *layers.IPv6
+	frag      *layers.IPv6Fragment
+	fragments []ipv6Fragment
+	length    int // total length, known when last fragment has been seen
+}
+
+type ipv6Defragmenter struct {
+	lists map[ipv6FragmentKey]*ipv6FragmentList
+}
+
+func newIPv6Defragmenter() *ipv6Defragmenter {
+	return &ipv6Defragmenter{lists: map[ipv6FragmentKey]*ipv6FragmentList{}}
+}
+
+// DefragIPv6 returns a new IPv6 layer with reassembled payload when all fragments has been seen
+// otherwise nil
+func (d *ipv6Defragmenter) DefragIPv6(ip6 *layers.IPv6, frag *layers.IPv6Fragment) (*layers.IPv6, error) {
+	k := ipv6FragmentKey{identification: frag.Identification}
+	copy(k.src[:], ip6.SrcIP.To16())
+	copy(k.dst[:], ip6.DstIP.To16())
+
+	offset := int(frag.FragmentOffset) * 8
+	data := frag.Payload
+	if offset+len(data) > ipv6MaximumSize {
+		return nil, fmt.Errorf("fragment offset %d and length %d exceeds maximum size", offset, len(data))
+	}
+
+	l, ok := d.lists[k]
+	if !ok {
+		l = &ipv6FragmentList{}
+		d.lists[k] = l
+	}
+	if len(l.fragments) >= ipv6MaximumFragmentListLen {
+		delete(d.lists, k)
+		return nil, fmt.Errorf("too many fragments")
+	}
+	l.fragments = append(l.fragments, ipv6Fragment{
+		offset: offset,
+		data:   append([]byte(nil), data...),
+	})
+	if offset == 0 {
+		l.first = ip6
+		l.frag = frag
+	}
+	if !frag.MoreFragments {
+		l.length = offset + len(data)
+	}
+
+	if l.first == nil || l.length == 0 {
+		return nil, nil
+	}
+
+	sort.SliceStable(l.fragments, func(i, j int) bool {
+		return l.fragments[i].offset < l.fragments[j].offset
+	})
+	// check for holes, overlaps are allowed and later bytes are used
+	end := 0
+	for _, f := range l.fragments {
+		if f.offset > end {
+			return nil, nil
+		}
+		if e := f.offset + len(f.data); e > end {
+			end = e
+		}
+	}
+	if end < l.length {
+		return nil, nil
+	}
+
+	payload := make([]byte, l.length)
+	for _, f := range l.fragments {
+		if f.offset >= l.length {
+			continue
+		}
+		copy(payload[f.offset:], f.data)
+	}
+	delete(d.lists, k)
+
+	return &layers.IPv6{
+		Version:      l.first.Version,
+		TrafficClass: l.first.TrafficClass,
+		FlowLabel:    l.first.FlowLabel,
+		Length:       uint16(len(payload)),
+		NextHeader:   l.frag.NextHeader,
+		HopLimit:     l.first.HopLimit,
+		SrcIP:        l.first.SrcIP,
+		DstIP:        l.first.DstIP,
+		BaseLayer:    layers.BaseLayer{Payload: payload},
+	}, nil
+}
@@ -0,0 +1,98 @@
+package inet
+
+// https://en.wikipedia.org/wiki/Generic_Routing_Encapsulation
+// https://www.rfc-editor.org/rfc/rfc2784
+// https://www.rfc-editor.org/rfc/rfc2890 key and sequence number
+// https://www.rfc-editor.org/rfc/rfc2637 version 1, enhanced GRE used by PPTP
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var greIPv4Format decode.Group
+var greIPv6Format decode.Group
+var greEther8023Format decode.Group
+var greMPLSFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.GRE,
+		Description: "Generic Routing Encapsulation",
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.IPV4_PACKET}, Group: &greIPv4Format},
+			{Names: []string{format.IPV6_PACKET}, Group: &greIPv6Format},
+			{Names: []string{format.ETHER8023_FRAME}, Group: &greEther8023Format},
+			{Names: []string{format.MPLS}, Group: &greMPLSFormat},
+		},
+		DecodeFn: decodeGRE,
+	})
+}
+
+var greProtocolTypeFormat = map[uint64]*decode.Group{
+	format.EtherTypeIPv4:        &greIPv4Format,
+	format.EtherTypeIPv6:        &greIPv6Format,
+	format.EtherTypeTEB:         &greEther8023Format,
+	format.EtherTypeMPLSUnicast: &greMPLSFormat,
+}
+
+func decodeGRE(d *decode.D, in interface{}) interface{} {
+	checksumPresent := d.FieldBool("checksum_present")
+	routingPresent := d.FieldBool("routing_present")
+	keyPresent := d.FieldBool("key_present")
+	sequenceNumberPresent := d.FieldBool("sequence_number_present")
+	d.FieldBool("strict_source_route")
+	d.FieldU3("recursion_control")
+	acknowledgmentPresent := d.FieldBool("acknowledgment_present")
+	d.FieldU4("flags")
+	version := d.FieldU3("version")
+	protocolType := d.FieldU16("protocol_type", format.EtherTypeMap, scalar.Hex)
+
+	if checksumPresent || routingPresent {
+		d.FieldU16("checksum", scalar.Hex)
+		d.FieldU16("offset")
+	}
+	if keyPresent {
+		if version == 1 {
+			d.FieldU16("payload_length")
+			d.FieldU16("call_id")
+		} else {
+			d.FieldU32("key", scalar.Hex)
+		}
+	}
+	if sequenceNumberPresent {
+		d.FieldU32("sequence_number")
+	}
+	if acknowledgmentPresent {
+		d.FieldU32("acknowledgment_number")
+	}
+	if routingPresent {
+		// RFC 1701 source route entries, deprecated
+		d.FieldArray("routing", func(d *decode.D) {
+			seenEnd := false
+			for !seenEnd {
+				d.FieldStruct("sre", func(d *decode.D) {
+					af := d.FieldU16("address_family")
+					d.FieldU8("sre_offset")
+					l := d.FieldU8("sre_length")
+					if af == 0 && l == 0 {
+						seenEnd = true
+						return
+					}
+					d.FieldRawLen("routing_information", int64(l)*8)
+				})
+			}
+		})
+	}
+
+	g, ok := greProtocolTypeFormat[protocolType]
+	if !ok {
+		d.FieldRawLen("data", d.BitsLeft())
+	} else {
+		d.FieldFormatLen("data", d.BitsLeft(), *g, nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package inet
+
+// https://en.wikipedia.org/wiki/ICMPv6
+// https://www.rfc-editor.org/rfc/rfc4443
+// https://www.rfc-editor.org/rfc/rfc4861 Neighbor Discovery Protocol (NDP)
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.ICMPV6,
+		Description: "Internet Control Message Protocol for IPv6",
+		DecodeFn:    decodeICMPv6,
+	})
+}
+
+const (
+	icmpv6TypeDestinationUnreachable = 1
+	icmpv6TypePacketTooBig           = 2
+	icmpv6TypeTimeExceeded           = 3
+	icmpv6TypeParameterProblem       = 4
+	icmpv6TypeEchoRequest            = 128
+	icmpv6TypeEchoReply              = 129
+	icmpv6TypeRouterSolicitation     = 133
+	icmpv6TypeRouterAdvertisement    = 134
+	icmpv6TypeNeighborSolicitation   = 135
+	icmpv6TypeNeighborAdvertisement  = 136
+	icmpv6TypeRedirect               = 137
+)
+
+var icmpv6TypeMap = scalar.UToScalar{
+	icmpv6TypeDestinationUnreachable: {Sym: "unreachable", Description: "Destination unreachable"},
+	icmpv6TypePacketTooBig:           {Sym: "packet_too_big", Description: "Packet too big"},
+	icmpv6TypeTimeExceeded:           {Sym: "time_exceeded", Description: "Time exceeded"},
+	icmpv6TypeParameterProblem:       {Sym: "parameter_problem", Description: "Parameter problem"},
+	icmpv6TypeEchoRequest:            {Sym: "echo_request", Description: "Echo request"},
+	icmpv6TypeEchoReply:              {Sym: "echo_reply", Description: "Echo reply"},
+	130:                              {Sym: "mld_query", Description: "Multicast listener query"},
+	131:                              {Sym: "mld_report", Description: "Multicast listener report"},
+	132:                              {Sym: "mld_done", Description: "Multicast listener done"},
+	icmpv6TypeRouterSolicitation:     {Sym: "router_solicitation", Description: "Router solicitation (NDP)"},
+	icmpv6TypeRouterAdvertisement:    {Sym: "router_advertisement", Description: "Router advertisement (NDP)"},
+	icmpv6TypeNeighborSolicitation:   {Sym: "neighbor_solicitation", Description: "Neighbor solicitation (NDP)"},
+	icmpv6TypeNeighborAdvertisement:  {Sym: "neighbor_advertisement", Description: "Neighbor advertisement (NDP)"},
+	icmpv6TypeRedirect:               {Sym: "redirect", Description: "Redirect message (NDP)"},
+	138:                              {Sym: "router_renumbering", Description: "Router renumbering"},
+	139:                              {Sym: "node_information_query", Description: "ICMP node information query"},
+	140:                              {Sym: "node_information_response", Description: "ICMP node information response"},
+	141:                              {Sym: "inverse_neighbor_solicitation", Description: "Inverse neighbor discovery solicitation message"},
+	142:                              {Sym: "inverse_neighbor_advertisement", Description: "Inverse neighbor discovery advertisement message"},
+	143:                              {Sym: "mldv2_report", Description: "Multicast listener discovery (MLDv2) reports"},
+	144:                              {Sym: "home_agent_address_request", Description: "Home agent address discovery request message"},
+	145:                              {Sym: "home_agent_address_reply", Description: "Home agent address discovery reply message"},
+	146:                              {Sym: "mobile_prefix_solicitation", Description: "Mobile prefix solicitation"},
+	147:                              {Sym: "mobile_prefix_advertisement", Description: "Mobile prefix advertisement"},
+	151:                              {Sym: "multicast_router_advertisement", Description: "Multicast router advertisement"},
+	152:                              {Sym: "multicast_router_solicitation", Description: "Multicast router solicitation"},
+	153:                              {Sym: "multicast_router_termination", Description: "Multicast router termination"},
+	155:                              {Sym: "rpl_control", Description: "RPL control message"},
+}
+
+var icmpv6CodeMapMap = map[uint64]scalar.UToScalar{
+	icmpv6TypeDestinationUnreachable: {
+		0: {Description: "No route to destination"},
+		1: {Description: "Communication with destination administratively prohibited"},
+		2: {Description: "Beyond scope of source address"},
+		3: {Description: "Address unreachable"},
+		4: {Description: "Port unreachable"},
+		5: {Description: "Source address failed ingress/egress policy"},
+		6: {Description: "Reject route to destination"},
+		7: {Description: "Error in source routing header"},
+	},
+	icmpv6TypeTimeExceeded: {
+		0: {Description: "Hop limit exceeded in transit"},
+		1: {Description: "Fragment reassembly time exceeded"},
+	},
+	icmpv6TypeParameterProblem: {
+		0: {Description: "Erroneous header field encountered"},
+		1: {Description: "Unrecognized next header type encountered"},
+		2: {Description: "Unrecognized IPv6 option encountered"},
+	},
+}
+
+const (
+	ndpOptionSourceLinkLayerAddress = 1
+	ndpOptionTargetLinkLayerAddress = 2
+	ndpOptionPrefixInformation      = 3
+	ndpOptionRedirectedHeader       = 4
+	ndpOptionMTU                    = 5
+	ndpOptionRDNSS                  = 25
+)
+
+var ndpOptionTypeMap = scalar.UToScalar{
+	ndpOptionSourceLinkLayerAddress: {Sym: "source_link_layer_address", Description: "Source link-layer address"},
+	ndpOptionTargetLinkLayerAddress: {Sym: "target_link_layer_address", Description: "Target link-layer address"},
+	ndpOptionPrefixInformation:      {Sym: "prefix_information", Description: "Prefix information"},
+	ndpOptionRedirectedHeader:       {Sym: "redirected_header", Description: "Redirected header"},
+	ndpOptionMTU:                    {Sym: "mtu", Description: "MTU"},
+	14:                              {Sym: "nonce", Description: "Nonce"},
+	24:                              {Sym: "route_information", Description: "Route information"},
+	ndpOptionRDNSS:                  {Sym: "rdnss", Description: "Recursive DNS server"},
+	31:                              {Sym: "dnssl", Description: "DNS search list"},
+}
+
+var ndpRouterPreferenceMap = scalar.UToSymStr{
+	0: "medium",
+	1: "high",
+	2: "reserved",
+	3: "low",
+}
+
+func decodeNDPOptions(d *decode.D) {
+	if d.End() {
+		return
+	}
+	d.FieldArray("options", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("option", func(d *decode.D) {
+				typ := d.FieldU8("type", ndpOptionTypeMap)
+				// length in 8 octets units including type and length
+				l := d.FieldU8("length")
+				if l == 0 {
+					// invalid, can't know where next option starts
+					d.FieldRawLen("data", d.BitsLeft())
+					return
+				}
+				d.FramedFn(int64(l)*8*8-2*8, func(d *decode.D) {
+					switch typ {
+					case ndpOptionSourceLinkLayerAddress, ndpOptionTargetLinkLayerAddress:
+						if l == 1 {
+							d.FieldU("link_layer_address", 48, mapUToEtherSym, scalar.Hex)
+						} else {
+							d.FieldRawLen("link_layer_address", d.BitsLeft())
+						}
+					case ndpOptionPrefixInformation:
+						d.FieldU8("prefix_length")
+						d.FieldBool("on_link")
+						d.FieldBool("autonomous")
+						d.FieldU6("reserved0")
+						d.FieldU32("valid_lifetime")
+						d.FieldU32("preferred_lifetime")
+						d.FieldU32("reserved1")
+						fieldIPv6Address(d, "prefix")
+					case ndpOptionRedirectedHeader:
+						d.FieldU48("reserved")
+						d.FieldRawLen("data", d.BitsLeft())
+					case ndpOptionMTU:
+						d.FieldU16("reserved")
+						d.FieldU32("mtu")
+					case ndpOptionRDNSS:
+						d.FieldU16("reserved")
+						d.FieldU32("lifetime")
+						d.FieldArray("addresses", func(d *decode.D) {
+							for !d.End() {
+								fieldIPv6Address(d, "address")
+							}
+						})
+					default:
+						d.FieldRawLen("data", d.BitsLeft())
+					}
+				})
+			})
+		}
+	})
+}
+
+func decodeICMPv6(d *decode.D, in interface{}) interface{} {
+	typ := d.FieldU8("type", icmpv6TypeMap)
+	d.FieldU8("code", icmpv6CodeMapMap[typ])
+	// TODO: validate, needs IPv6 pseudo header
+	d.FieldU16("checksum", scalar.Hex)
+
+	switch typ {
+	case icmpv6TypeDestinationUnreachable, icmpv6TypeTimeExceeded:
+		d.FieldU32("unused")
+		d.FieldRawLen("invoking_packet", d.BitsLeft())
+	case icmpv6TypePacketTooBig:
+		d.FieldU32("mtu")
+		d.FieldRawLen("invoking_packet", d.BitsLeft())
+	case icmpv6TypeParameterProblem:
+		d.FieldU32("pointer")
+		d.FieldRawLen("invoking_packet", d.BitsLeft())
+	case icmpv6TypeEchoRequest, icmpv6TypeEchoReply:
+		d.FieldU16("identifier")
+		d.FieldU16("sequence_number")
+		d.FieldRawLen("data", d.BitsLeft())
+	case icmpv6TypeRouterSolicitation:
+		d.FieldU32("reserved")
+		decodeNDPOptions(d)
+	case icmpv6TypeRouterAdvertisement:
+		d.FieldU8("cur_hop_limit")
+		d.FieldBool("managed")
+		d.FieldBool("other")
+		d.FieldBool("home_agent")
+		d.FieldU2("preference", ndpRouterPreferenceMap)
+		d.FieldBool("proxy")
+		d.FieldU2("reserved")
+		d.FieldU16("router_lifetime")
+		d.FieldU32("reachable_time")
+		d.FieldU32("retrans_timer")
+		decodeNDPOptions(d)
+	case icmpv6TypeNeighborSolicitation:
+		d.FieldU32("reserved")
+		fieldIPv6Address(d, "target_address")
+		decodeNDPOptions(d)
+	case icmpv6TypeNeighborAdvertisement:
+		d.FieldBool("router")
+		d.FieldBool("solicited")
+		d.FieldBool("override")
+		d.FieldU29("reserved")
+		fieldIPv6Address(d, "target_address")
+		decodeNDPOptions(d)
+	case icmpv6TypeRedirect:
+		d.FieldU32("reserved")
+		fieldIPv6Address(d, "target_address")
+		fieldIPv6Address(d, "destination_address")
+		decodeNDPOptions(d)
+	default:
+		d.FieldRawLen("content", d.BitsLeft())
+	}
+
+	return nil
+}
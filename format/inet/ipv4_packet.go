@@ -15,6 +15,7 @@ import (
 var udpPacketFormat decode.Group
 var tcpPacketFormat decode.Group
 var icmpFormat decode.Group
+var ipv4GREFormat decode.Group
 
 func init() {
 	registry.MustRegister(decode.Format{
@@ -24,6 +25,7 @@ func init() {
 			{Names: []string{format.UDP_DATAGRAM}, Group: &udpPacketFormat},
 			{Names: []string{format.TCP_SEGMENT}, Group: &tcpPacketFormat},
 			{Names: []string{format.ICMP}, Group: &icmpFormat},
+			{Names: []string{format.GRE}, Group: &ipv4GREFormat},
 		},
 		DecodeFn: decodeIPv4,
 	})
@@ -49,6 +51,7 @@ var ipv4ProtocolFormat = map[uint64]*decode.Group{
 	format.IPv4ProtocolUDP:  &udpPacketFormat,
 	format.IPv4ProtocolTCP:  &tcpPacketFormat,
 	format.IPv4ProtocolICMP: &icmpFormat,
+	format.IPv4ProtocolGRE:  &ipv4GREFormat,
 }
 
 var mapUToIPv4Sym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
@@ -0,0 +1,186 @@
+package inet
+
+// https://en.wikipedia.org/wiki/IPv6_packet
+// https://www.rfc-editor.org/rfc/rfc8200
+
+import (
+	"net"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var ipv6UDPPacketFormat decode.Group
+var ipv6TCPPacketFormat decode.Group
+var ipv6ICMPv6Format decode.Group
+var ipv6GREFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.IPV6_PACKET,
+		Description: "Internet protocol v6 packet",
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.UDP_DATAGRAM}, Group: &ipv6UDPPacketFormat},
+			{Names: []string{format.TCP_SEGMENT}, Group: &ipv6TCPPacketFormat},
+			{Names: []string{format.ICMPV6}, Group: &ipv6ICMPv6Format},
+			{Names: []string{format.GRE}, Group: &ipv6GREFormat},
+		},
+		DecodeFn: decodeIPv6,
+	})
+}
+
+var ipv6NextHeaderFormat = map[uint64]*decode.Group{
+	format.IPv6NextHeaderUDP:    &ipv6UDPPacketFormat,
+	format.IPv6NextHeaderTCP:    &ipv6TCPPacketFormat,
+	format.IPv6NextHeaderICMPv6: &ipv6ICMPv6Format,
+	format.IPv6NextHeaderGRE:    &ipv6GREFormat,
+}
+
+// IPv4 protocol map but 0 is hop-by-hop options for IPv6
+var ipv6NextHeaderMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	if s.ActualU() == format.IPv6NextHeaderHopByHop {
+		s.Sym = "hopopt"
+		s.Description = "IPv6 hop-by-hop option"
+		return s, nil
+	}
+	return format.IPv4ProtocolMap.MapScalar(s)
+})
+
+const (
+	ipv6OptionPad1 = 0
+	ipv6OptionPadN = 1
+)
+
+var ipv6OptionTypeMap = scalar.UToScalar{
+	ipv6OptionPad1: {Sym: "pad1", Description: "Pad1"},
+	ipv6OptionPadN: {Sym: "padn", Description: "PadN"},
+	0x04:           {Sym: "tunnel_encapsulation_limit", Description: "Tunnel encapsulation limit"},
+	0x05:           {Sym: "router_alert", Description: "Router alert"},
+	0x07:           {Sym: "calipso", Description: "Common architecture label IPv6 security option"},
+	0x08:           {Sym: "smf_dpd", Description: "Simplified multicast forwarding duplicate packet detection"},
+	0x26:           {Sym: "quick_start", Description: "Quick-Start"},
+	0x31:           {Sym: "ioam", Description: "In-situ OAM"},
+	0x63:           {Sym: "rpl", Description: "RPL option"},
+	0x6d:           {Sym: "mpl", Description: "Multicast protocol for low-power and lossy networks"},
+	0x8b:           {Sym: "ilnp_nonce", Description: "ILNP nonce"},
+	0x8c:           {Sym: "line_identification", Description: "Line-identification option"},
+	0xc2:           {Sym: "jumbo_payload", Description: "Jumbo payload"},
+	0xc9:           {Sym: "home_address", Description: "Home address"},
+	0xee:           {Sym: "ip_dff", Description: "Depth-first forwarding"},
+}
+
+var ipv6RoutingTypeMap = scalar.UToScalar{
+	0: {Sym: "source_route", Description: "Source route (deprecated)"},
+	2: {Sym: "type2", Description: "Type 2 routing header, mobility"},
+	3: {Sym: "rpl", Description: "RPL source route header"},
+	4: {Sym: "segment_routing", Description: "Segment routing header"},
+}
+
+var mapRawToIPv6Sym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	br, ok := s.Actual.(bitio.ReaderAt)
+	if !ok {
+		return s, nil
+	}
+	b := make([]byte, net.IPv6len)
+	if _, err := br.ReadBitsAt(b, net.IPv6len*8, 0); err != nil {
+		return s, err
+	}
+	s.Sym = net.IP(b).String()
+	return s, nil
+})
+
+func fieldIPv6Address(d *decode.D, name string) {
+	d.FieldRawLen(name, net.IPv6len*8, mapRawToIPv6Sym)
+}
+
+func decodeIPv6Options(d *decode.D) {
+	d.FieldArray("options", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("option", func(d *decode.D) {
+				typ := d.FieldU8("type", ipv6OptionTypeMap, scalar.Hex)
+				if typ == ipv6OptionPad1 {
+					return
+				}
+				l := d.FieldU8("length")
+				d.FieldRawLen("data", int64(l)*8)
+			})
+		}
+	})
+}
+
+func decodeIPv6(d *decode.D, in interface{}) interface{} {
+	d.FieldU4("version")
+	d.FieldU6("dscp")
+	d.FieldU2("ecn")
+	d.FieldU20("flow_label", scalar.Hex)
+	payloadLength := d.FieldU16("payload_length")
+	nextHeader := d.FieldU8("next_header", ipv6NextHeaderMap)
+	d.FieldU8("hop_limit")
+	fieldIPv6Address(d, "source_ip")
+	fieldIPv6Address(d, "destination_ip")
+
+	payloadStart := d.Pos()
+	// zero payload length means jumbo payload, length is in a hop-by-hop option
+	payloadLen := int64(payloadLength) * 8
+	if payloadLength == 0 {
+		payloadLen = d.BitsLeft()
+	}
+
+	fragmented := false
+	isExtensionHeader := func(n uint64) bool {
+		switch n {
+		case format.IPv6NextHeaderHopByHop,
+			format.IPv6NextHeaderRouting,
+			format.IPv6NextHeaderFragment,
+			format.IPv6NextHeaderDestOpts:
+			return true
+		default:
+			return false
+		}
+	}
+	if isExtensionHeader(nextHeader) {
+		d.FieldArray("extension_headers", func(d *decode.D) {
+			for isExtensionHeader(nextHeader) {
+				d.FieldStruct("extension_header", func(d *decode.D) {
+					d.FieldValueU("type", nextHeader, ipv6NextHeaderMap)
+					headerType := nextHeader
+					nextHeader = d.FieldU8("next_header", ipv6NextHeaderMap)
+
+					switch headerType {
+					case format.IPv6NextHeaderFragment:
+						d.FieldU8("reserved0")
+						fragmentOffset := d.FieldU13("fragment_offset")
+						d.FieldU2("reserved1")
+						moreFragments := d.FieldBool("more_fragments")
+						d.FieldU32("identification", scalar.Hex)
+						if moreFragments || fragmentOffset > 0 {
+							fragmented = true
+						}
+					case format.IPv6NextHeaderRouting:
+						// length in 8 octets units not including first 8 octets
+						l := d.FieldU8("length")
+						d.FieldU8("routing_type", ipv6RoutingTypeMap)
+						d.FieldU8("segments_left")
+						d.FieldRawLen("data", int64(l)*8*8+4*8)
+					default:
+						l := d.FieldU8("length")
+						d.FramedFn(int64(l)*8*8+6*8, decodeIPv6Options)
+					}
+				})
+			}
+		})
+	}
+
+	dataLen := payloadLen - (d.Pos() - payloadStart)
+	g, ok := ipv6NextHeaderFormat[nextHeader]
+	if !ok || fragmented {
+		d.FieldRawLen("data", dataLen)
+	} else {
+		d.FieldFormatLen("data", dataLen, *g, nil)
+	}
+
+	return nil
+}
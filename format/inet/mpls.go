@@ -0,0 +1,78 @@
+package inet
+
+// https://en.wikipedia.org/wiki/Multiprotocol_Label_Switching
+// https://www.rfc-editor.org/rfc/rfc3032
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var mplsIPv4Format decode.Group
+var mplsIPv6Format decode.Group
+var mplsEther8023Format decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.MPLS,
+		Description: "Multiprotocol Label Switching",
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.IPV4_PACKET}, Group: &mplsIPv4Format},
+			{Names: []string{format.IPV6_PACKET}, Group: &mplsIPv6Format},
+			{Names: []string{format.ETHER8023_FRAME}, Group: &mplsEther8023Format},
+		},
+		DecodeFn: decodeMPLS,
+	})
+}
+
+var mplsLabelMap = scalar.UToScalar{
+	0:  {Sym: "ipv4_explicit_null", Description: "IPv4 explicit null"},
+	1:  {Sym: "router_alert", Description: "Router alert"},
+	2:  {Sym: "ipv6_explicit_null", Description: "IPv6 explicit null"},
+	3:  {Sym: "implicit_null", Description: "Implicit null"},
+	7:  {Sym: "eli", Description: "Entropy label indicator"},
+	13: {Sym: "gal", Description: "Generic associated channel label"},
+	14: {Sym: "oam_alert", Description: "OAM alert"},
+	15: {Sym: "xl", Description: "Extension label"},
+}
+
+func decodeMPLS(d *decode.D, in interface{}) interface{} {
+	d.FieldArray("labels", func(d *decode.D) {
+		bottomOfStack := false
+		for !bottomOfStack {
+			d.FieldStruct("label", func(d *decode.D) {
+				d.FieldU20("label", mplsLabelMap)
+				d.FieldU3("traffic_class")
+				bottomOfStack = d.FieldBool("bottom_of_stack")
+				d.FieldU8("ttl")
+			})
+		}
+	})
+
+	if d.BitsLeft() < 32 {
+		d.FieldRawLen("data", d.BitsLeft())
+		return nil
+	}
+
+	// payload type is not signaled, guess based on first nibble like most decoders do
+	var g *decode.Group
+	switch d.PeekBits(4) {
+	case 4:
+		g = &mplsIPv4Format
+	case 6:
+		g = &mplsIPv6Format
+	case 0:
+		// pseudowire with control word followed by ethernet frame
+		d.FieldU32("control_word", scalar.Hex)
+		g = &mplsEther8023Format
+	}
+	if g == nil {
+		d.FieldRawLen("data", d.BitsLeft())
+	} else if dv, _, _ := d.TryFieldFormatLen("data", d.BitsLeft(), *g, nil); dv == nil {
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -26,6 +26,7 @@ func init() {
 
 var sllPacket2FrameTypeFormat = map[uint64]*decode.Group{
 	format.EtherTypeIPv4: &ether8023FrameIPv4Format,
+	format.EtherTypeIPv6: &ether8023FrameIPv6Format,
 }
 
 func decodeSLL2(d *decode.D, in interface{}) interface{} {
@@ -26,6 +26,7 @@ func init() {
 
 var sllPacketFrameTypeFormat = map[uint64]*decode.Group{
 	format.EtherTypeIPv4: &ether8023FrameIPv4Format,
+	format.EtherTypeIPv6: &ether8023FrameIPv6Format,
 }
 
 var sllPacketTypeMap = scalar.UToScalar{
@@ -0,0 +1,43 @@
+package inet
+
+// https://en.wikipedia.org/wiki/Virtual_Extensible_LAN
+// https://www.rfc-editor.org/rfc/rfc7348
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var vxlanEther8023Format decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.VXLAN,
+		Description: "Virtual eXtensible Local Area Network",
+		Groups:      []string{format.UDP_PAYLOAD},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.ETHER8023_FRAME}, Group: &vxlanEther8023Format},
+		},
+		DecodeFn: decodeVXLAN,
+	})
+}
+
+func decodeVXLAN(d *decode.D, in interface{}) interface{} {
+	if upi, ok := in.(format.UDPPayloadIn); ok {
+		if upi.DestinationPort != format.UDPPortVXLAN {
+			d.Fatalf("wrong port")
+		}
+	}
+
+	d.FieldU4("reserved0")
+	d.FieldBool("vni_valid")
+	d.FieldU3("reserved1")
+	d.FieldU24("reserved2")
+	d.FieldU24("vni", scalar.Hex)
+	d.FieldU8("reserved3")
+	d.FieldFormatLen("frame", d.BitsLeft(), vxlanEther8023Format, nil)
+
+	return nil
+}
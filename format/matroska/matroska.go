@@ -78,7 +78,8 @@ func init() {
 			{Names: []string{format.VP9_CFM}, Group: &vp9CFMFormat},
 			{Names: []string{format.VP9_FRAME}, Group: &vp9FrameFormat},
 		},
-		Files: matroskaFS,
+		Files:   matroskaFS,
+		Summary: "_matroska_summary",
 	})
 
 	codecToFormat = map[string]*decode.Group{
@@ -84,7 +84,8 @@ func init() {
 			{Names: []string{format.VPX_CCR}, Group: &vpxCCRFormat},
 			{Names: []string{format.ICC_PROFILE}, Group: &iccProfileFormat},
 		},
-		Files: mp4FS,
+		Files:   mp4FS,
+		Summary: "_mp4_summary",
 	})
 }
 
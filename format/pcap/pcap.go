@@ -4,6 +4,9 @@ package pcap
 // TODO: tshark seems to not support sll2 in pcap, confusing
 
 import (
+	"embed"
+	"time"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/inet/flowsdecoder"
 	"github.com/wader/fq/format/registry"
@@ -11,9 +14,14 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
+//go:embed *.jq
+var pcapFS embed.FS
+
 var pcapLinkFrameFormat decode.Group
 var pcapTCPStreamFormat decode.Group
+var pcapUDPPayloadFormat decode.Group
 var pcapIPv4PacketFormat decode.Group
+var pcapIPv6PacketFormat decode.Group
 
 const (
 	bigEndian    = 0xa1b2c3d4
@@ -33,9 +41,13 @@ func init() {
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.LINK_FRAME}, Group: &pcapLinkFrameFormat},
 			{Names: []string{format.TCP_STREAM}, Group: &pcapTCPStreamFormat},
+			{Names: []string{format.UDP_PAYLOAD}, Group: &pcapUDPPayloadFormat},
 			{Names: []string{format.IPV4_PACKET}, Group: &pcapIPv4PacketFormat},
+			{Names: []string{format.IPV6_PACKET}, Group: &pcapIPv6PacketFormat},
 		},
 		DecodeFn: decodePcap,
+		Files:    pcapFS,
+		Summary:  "_pcap_summary",
 	})
 }
 
@@ -59,10 +71,10 @@ func decodePcap(d *decode.D, in interface{}) interface{} {
 	fd := flowsdecoder.New()
 
 	d.FieldArray("packets", func(d *decode.D) {
-		for !d.End() {
+		for i := 0; !d.End(); i++ {
 			d.FieldStruct("packet", func(d *decode.D) {
-				d.FieldU32("ts_sec")
-				d.FieldU32("ts_usec")
+				tsSec := d.FieldU32("ts_sec")
+				tsUsec := d.FieldU32("ts_usec")
 				inclLen := d.FieldU32("incl_len")
 				origLen := d.FieldU32("orig_len")
 
@@ -82,7 +94,10 @@ func decodePcap(d *decode.D, in interface{}) interface{} {
 
 				if fn, ok := linkToDecodeFn[linkType]; ok {
 					// TODO: report decode errors
-					_ = fn(fd, bs)
+					_ = fn(fd, bs, flowsdecoder.PacketInfo{
+						Index:     i,
+						Timestamp: time.Unix(int64(tsSec), int64(tsUsec)*1000),
+					})
 				}
 
 				if dv, _, _ := d.TryFieldFormatLen("packet", int64(inclLen)*8, pcapLinkFrameFormat, format.LinkFrameIn{
@@ -96,7 +111,7 @@ func decodePcap(d *decode.D, in interface{}) interface{} {
 	})
 	fd.Flush()
 
-	fieldFlows(d, fd, pcapTCPStreamFormat, pcapIPv4PacketFormat)
+	fieldFlows(d, fd, pcapTCPStreamFormat, pcapUDPPayloadFormat, pcapIPv4PacketFormat, pcapIPv6PacketFormat, nil)
 
 	return nil
 }
@@ -4,7 +4,10 @@ package pcap
 
 import (
 	"encoding/binary"
+	"fmt"
+	"math"
 	"net"
+	"time"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/inet/flowsdecoder"
@@ -15,7 +18,9 @@ import (
 
 var pcapngLinkFrameFormat decode.Group
 var pcapngTCPStreamFormat decode.Group
+var pcapngUDPPayloadFormat decode.Group
 var pcapngIPvPacket4Format decode.Group
+var pcapngIPv6PacketFormat decode.Group
 
 func init() {
 	registry.MustRegister(decode.Format{
@@ -26,9 +31,12 @@ func init() {
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.LINK_FRAME}, Group: &pcapngLinkFrameFormat},
 			{Names: []string{format.TCP_STREAM}, Group: &pcapngTCPStreamFormat},
+			{Names: []string{format.UDP_PAYLOAD}, Group: &pcapngUDPPayloadFormat},
 			{Names: []string{format.IPV4_PACKET}, Group: &pcapngIPvPacket4Format},
+			{Names: []string{format.IPV6_PACKET}, Group: &pcapngIPv6PacketFormat},
 		},
 		DecodeFn: decodePcapng,
+		Summary:  "_pcapng_summary",
 	})
 }
 
@@ -48,6 +56,7 @@ const (
 	blockTypeNameResolution       = 0x00000004
 	blockTypeInterfaceStatistics  = 0x00000005
 	blockTypeEnhancedPacketBlock  = 0x00000006
+	blockTypeDecryptionSecrets    = 0x0000000a
 )
 
 // from https://pcapng.github.io/pcapng/draft-ietf-opsawg-pcapng.html#section_block_code_registry
@@ -61,7 +70,7 @@ var blockTypeMap = scalar.UToScalar{
 	0x00000007:                    {Description: "IRIG Timestamp Block"},
 	0x00000008:                    {Description: "ARINC 429 in AFDX Encapsulation Information Block"},
 	0x00000009:                    {Description: "systemd Journal Export Block"},
-	0x0000000a:                    {Description: "Decryption Secrets Block"},
+	blockTypeDecryptionSecrets:    {Sym: "decryption_secrets", Description: "Decryption Secrets Block"},
 	0x00000101:                    {Description: "Hone Project Machine Info Block"},
 	0x00000102:                    {Description: "Hone Project Connection Event Block"},
 	0x00000201:                    {Description: "Sysdig Machine Info Block"},
@@ -82,6 +91,20 @@ var blockTypeMap = scalar.UToScalar{
 	blockTypeSectionHeader:        {Sym: "section_header", Description: "Section Header Block"},
 }
 
+const (
+	secretsTypeTLSKeyLog       = 0x544c534b
+	secretsTypeWireGuardKeyLog = 0x57474b4c
+	secretsTypeZigBeeNWKKey    = 0x5a4e574b
+	secretsTypeZigBeeAPSKey    = 0x5a415053
+)
+
+var secretsTypeMap = scalar.UToScalar{
+	secretsTypeTLSKeyLog:       {Sym: "tls_key_log", Description: "TLS Key Log"},
+	secretsTypeWireGuardKeyLog: {Sym: "wireguard_key_log", Description: "WireGuard Key Log"},
+	secretsTypeZigBeeNWKKey:    {Sym: "zigbee_nwk_key", Description: "ZigBee NWK Key"},
+	secretsTypeZigBeeAPSKey:    {Sym: "zigbee_aps_key", Description: "ZigBee APS Key"},
+}
+
 const (
 	optionEnd     = 0
 	optionComment = 1
@@ -161,6 +184,11 @@ var nameResolutionOptionsMap = scalar.UToScalar{
 	nameResolutionDNSIP6addr: {Sym: "dnsip6addr"},
 }
 
+var decryptionSecretsOptionsMap = scalar.UToScalar{
+	optionEnd:     {Sym: "end", Description: "End of options"},
+	optionComment: {Sym: "comment", Description: "Comment"},
+}
+
 var interfaceStatisticsOptionsMap = scalar.UToScalar{
 	optionEnd:                       {Sym: "end", Description: "End of options"},
 	optionComment:                   {Sym: "comment", Description: "Comment"},
@@ -185,7 +213,8 @@ var nameResolutionRecordMap = scalar.UToSymStr{
 	nameResolutionRecordIpv6: "ipv6",
 }
 
-func decoodeOptions(d *decode.D, opts scalar.UToScalar) {
+// valueFns decodes value for specific option codes, other values are decoded as strings
+func decoodeOptions(d *decode.D, opts scalar.UToScalar, valueFns map[uint64]func(d *decode.D)) {
 	if d.BitsLeft() < 32 {
 		return
 	}
@@ -198,12 +227,56 @@ func decoodeOptions(d *decode.D, opts scalar.UToScalar) {
 				seenEnd = true
 				return
 			}
-			d.FieldUTF8NullFixedLen("value", int(length))
+			if fn, ok := valueFns[code]; ok {
+				d.FramedFn(int64(length)*8, fn)
+			} else {
+				d.FieldUTF8NullFixedLen("value", int(length))
+			}
 			d.FieldRawLen("padding", int64(d.AlignBits(32)))
 		})
 	}
 }
 
+// if_tsresol default is microseconds
+const defaultTsresol = 6
+
+// if_tsresol most significant bit set means negative power of 2 otherwise of 10
+var tsresolMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	n := s.ActualU() & 0x7f
+	if s.ActualU()&0x80 != 0 {
+		s.Description = fmt.Sprintf("2^-%d seconds", n)
+	} else {
+		s.Description = fmt.Sprintf("10^-%d seconds", n)
+	}
+	return s, nil
+})
+
+// tsresolTime returns time for timestamp ts in units of tsresol
+func tsresolTime(ts uint64, tsresol uint64) time.Time {
+	n := tsresol & 0x7f
+	if tsresol&0x80 != 0 {
+		if n >= 64 {
+			return time.Unix(0, 0)
+		}
+		frac := ts & (1<<n - 1)
+		return time.Unix(int64(ts>>n), int64(float64(frac)/float64(uint64(1)<<n)*1e9))
+	}
+
+	if n <= 9 {
+		var perSecond uint64 = 1
+		for i := uint64(0); i < n; i++ {
+			perSecond *= 10
+		}
+		return time.Unix(int64(ts/perSecond), int64(ts%perSecond*(1e9/perSecond)))
+	}
+	// more than nanosecond resolution
+	var perNanosecond uint64 = 1
+	for i := uint64(9); i < n && perNanosecond <= math.MaxUint64/10; i++ {
+		perNanosecond *= 10
+	}
+	return time.Unix(0, int64(ts/perNanosecond))
+}
+
 // TODO: share
 var mapUToIPv4Sym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
 	var b [4]byte
@@ -219,14 +292,26 @@ var blockFns = map[uint64]func(d *decode.D, dc *decodeContext){
 		typ := d.FieldU16("link_type", format.LinkTypeMap)
 		d.FieldU16("reserved")
 		d.FieldU32("snap_len")
-		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, interfaceDescriptionOptionsMap) })
+		tsresol := uint64(defaultTsresol)
+		d.FieldArray("options", func(d *decode.D) {
+			decoodeOptions(d, interfaceDescriptionOptionsMap, map[uint64]func(d *decode.D){
+				interfaceDescriptionTsresol: func(d *decode.D) { tsresol = d.FieldU8("value", tsresolMap) },
+			})
+		})
 
 		dc.interfaceTypes[len(dc.interfaceTypes)] = int(typ)
+		dc.interfaceTsresols[len(dc.interfaceTsresols)] = tsresol
 	},
 	blockTypeEnhancedPacketBlock: func(d *decode.D, dc *decodeContext) {
 		interfaceID := d.FieldU32("interface_id")
-		d.FieldU32("timestamp_high")
-		d.FieldU32("timestamp_low")
+		timestampHigh := d.FieldU32("timestamp_high")
+		timestampLow := d.FieldU32("timestamp_low")
+		tsresol, ok := dc.interfaceTsresols[int(interfaceID)]
+		if !ok {
+			tsresol = defaultTsresol
+		}
+		timestamp := tsresolTime(timestampHigh<<32|timestampLow, tsresol)
+		fieldTimestamp(d, "timestamp", timestamp)
 		capturedLength := d.FieldU32("capture_packet_length")
 		d.FieldU32("original_packet_length")
 
@@ -236,7 +321,10 @@ var blockFns = map[uint64]func(d *decode.D, dc *decodeContext){
 
 		if fn, ok := linkToDecodeFn[linkType]; ok {
 			// TODO: report decode errors
-			_ = fn(dc.flowDecoder, bs)
+			_ = fn(dc.flowDecoder, bs, flowsdecoder.PacketInfo{
+				Index:     dc.blockIndex,
+				Timestamp: timestamp,
+			})
 		}
 
 		if dv, _, _ := d.TryFieldFormatLen("packet", int64(capturedLength)*8, pcapngLinkFrameFormat, format.LinkFrameIn{
@@ -247,7 +335,7 @@ var blockFns = map[uint64]func(d *decode.D, dc *decodeContext){
 		}
 
 		d.FieldRawLen("padding", int64(d.AlignBits(32)))
-		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, enhancedPacketOptionsMap) })
+		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, enhancedPacketOptionsMap, nil) })
 	},
 	blockTypeNameResolution: func(d *decode.D, _ *decodeContext) {
 		seenEnd := false
@@ -277,14 +365,27 @@ var blockFns = map[uint64]func(d *decode.D, dc *decodeContext){
 				})
 			}
 		})
-		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, nameResolutionOptionsMap) })
+		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, nameResolutionOptionsMap, nil) })
+	},
+	blockTypeDecryptionSecrets: func(d *decode.D, dc *decodeContext) {
+		typ := d.FieldU32("secrets_type", secretsTypeMap, scalar.Hex)
+		length := d.FieldU32("secrets_length")
+		if typ == secretsTypeTLSKeyLog {
+			dc.tlsKeyLog = append(dc.tlsKeyLog, d.PeekBytes(int(length))...)
+			dc.tlsKeyLog = append(dc.tlsKeyLog, '\n')
+			d.FieldUTF8("secrets_data", int(length))
+		} else {
+			d.FieldRawLen("secrets_data", int64(length)*8)
+		}
+		d.FieldRawLen("padding", int64(d.AlignBits(32)))
+		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, decryptionSecretsOptionsMap, nil) })
 	},
 	blockTypeInterfaceStatistics: func(d *decode.D, _ *decodeContext) {
 		d.FieldU32("interface_id")
 		d.FieldU32("timestamp_high")
 		d.FieldU32("timestamp_low")
 		d.FieldRawLen("padding", int64(d.AlignBits(32)))
-		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, interfaceStatisticsOptionsMap) })
+		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, interfaceStatisticsOptionsMap, nil) })
 	},
 }
 
@@ -337,7 +438,7 @@ func decodeSection(d *decode.D, dc *decodeContext) {
 				d.FieldU16("minor_version")
 				sectionLength = d.FieldS64("section_length")
 				d.FramedFn(d.BitsLeft()-32, func(d *decode.D) {
-					d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, sectionHeaderOptionsMap) })
+					d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, sectionHeaderOptionsMap, nil) })
 				})
 				d.FieldU32("footer_total_length")
 			})
@@ -345,17 +446,23 @@ func decodeSection(d *decode.D, dc *decodeContext) {
 			dc.sectionHeaderFound = true
 		})
 
+		// index of block in section, header block is 0
+		dc.blockIndex = 1
 		for (sectionLength == -1 && !d.End()) ||
 			(sectionLength != -1 && d.Pos()-sectionStart < sectionLength*8) {
 			d.FieldStruct("block", func(d *decode.D) { decodeBlock(d, dc) })
+			dc.blockIndex++
 		}
 	})
 }
 
 type decodeContext struct {
 	sectionHeaderFound bool
+	blockIndex         int
 	interfaceTypes     map[int]int
+	interfaceTsresols  map[int]uint64
 	flowDecoder        *flowsdecoder.Decoder
+	tlsKeyLog          []byte
 }
 
 func decodePcapng(d *decode.D, in interface{}) interface{} {
@@ -363,14 +470,15 @@ func decodePcapng(d *decode.D, in interface{}) interface{} {
 	for !d.End() {
 		fd := flowsdecoder.New()
 		dc := decodeContext{
-			interfaceTypes: map[int]int{},
-			flowDecoder:    fd,
+			interfaceTypes:    map[int]int{},
+			interfaceTsresols: map[int]uint64{},
+			flowDecoder:       fd,
 		}
 
 		d.FieldStruct("section", func(d *decode.D) {
 			decodeSection(d, &dc)
 			fd.Flush()
-			fieldFlows(d, dc.flowDecoder, pcapngTCPStreamFormat, pcapngIPvPacket4Format)
+			fieldFlows(d, dc.flowDecoder, pcapngTCPStreamFormat, pcapngUDPPayloadFormat, pcapngIPvPacket4Format, pcapngIPv6PacketFormat, dc.tlsKeyLog)
 		})
 		if dc.sectionHeaderFound {
 			sectionHeaders++
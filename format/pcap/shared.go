@@ -2,18 +2,20 @@ package pcap
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/inet/flowsdecoder"
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
 )
 
-var linkToDecodeFn = map[int]func(fd *flowsdecoder.Decoder, bs []byte) error{
+var linkToDecodeFn = map[int]func(fd *flowsdecoder.Decoder, bs []byte, pi flowsdecoder.PacketInfo) error{
 	format.LinkTypeNULL:      (*flowsdecoder.Decoder).LoopbackFrame,
 	format.LinkTypeETHERNET:  (*flowsdecoder.Decoder).EthernetFrame,
 	format.LinkTypeLINUX_SLL: (*flowsdecoder.Decoder).SLLPacket,
-	format.LinkTypeLINUX_SLL2: func(fd *flowsdecoder.Decoder, bs []byte) error {
+	format.LinkTypeLINUX_SLL2: func(fd *flowsdecoder.Decoder, bs []byte, pi flowsdecoder.PacketInfo) error {
 		if len(bs) < 20 {
 			// TODO: too short sll packet, error somehow?
 			return fmt.Errorf("packet too short %d", len(bs))
@@ -29,11 +31,87 @@ var linkToDecodeFn = map[int]func(fd *flowsdecoder.Decoder, bs []byte) error{
 		}
 		nbs = append(nbs, bs[20:]...)
 
-		return fd.SLLPacket(nbs)
+		return fd.SLLPacket(nbs, pi)
 	},
 }
 
-func fieldFlows(d *decode.D, fd *flowsdecoder.Decoder, tcpStreamFormat decode.Group, ipv4PacketFormat decode.Group) {
+// timestamp as float seconds since epoch with UTC time as description
+func fieldTimestamp(d *decode.D, name string, t time.Time) {
+	d.FieldValueFloat(name, float64(t.Unix())+float64(t.Nanosecond())/1e9, scalar.Description(t.UTC().Format(time.RFC3339Nano)))
+}
+
+func fieldUDPDatagrams(d *decode.D, name string, dgs []flowsdecoder.UDPDatagram, udpPayloadFormat decode.Group, src, dst flowsdecoder.IPEndpoint, clientPayloads [][]byte) {
+	d.FieldArray(name, func(d *decode.D) {
+		var payloads [][]byte
+		for _, dg := range dgs {
+			payloads = append(payloads, dg.Payload)
+		}
+		for i, dg := range dgs {
+			d.FieldStruct("datagram", func(d *decode.D) {
+				d.FieldValueU("packet_index", uint64(dg.PacketIndex))
+				fieldTimestamp(d, "timestamp", dg.Timestamp)
+				br := bitio.NewBitReader(dg.Payload, -1)
+				if dv, _, _ := d.TryFieldFormatBitBuf(
+					"payload",
+					br,
+					udpPayloadFormat,
+					format.UDPPayloadIn{
+						SourcePort:      src.Port,
+						DestinationPort: dst.Port,
+						ClientPayloads:  clientPayloads,
+						Payloads:        payloads,
+						PayloadIndex:    i,
+					},
+				); dv == nil {
+					d.FieldRootBitBuf("payload", br)
+				}
+			})
+		}
+	})
+}
+
+// data after a gap is not contiguous with data before it so the stream is only decoded
+// up to the first gap and the rest is unknown
+func fieldTCPStream(d *decode.D, name string, td *flowsdecoder.TCPDirection, tcpStreamFormat decode.Group, in format.TCPStreamIn) {
+	// only decode up to first gap, data after it is not contiguous
+	contiguous := td.Contiguous()
+	br := bitio.NewBitReader(contiguous, -1)
+	if dv, _, _ := d.TryFieldFormatBitBuf(name, br, tcpStreamFormat, in); dv == nil {
+		d.FieldRootBitBuf(name, br)
+	}
+	if len(td.Gaps) > 0 {
+		d.FieldRootBitBuf(name+"_unknown", bitio.NewBitReader(td.Buffer.Bytes()[len(contiguous):], -1))
+	}
+}
+
+// which packet and when each part of a reassembled stream was seen
+func fieldTCPChunks(d *decode.D, name string, chunks []flowsdecoder.TCPChunk) {
+	d.FieldArray(name, func(d *decode.D) {
+		for _, c := range chunks {
+			d.FieldStruct("chunk", func(d *decode.D) {
+				d.FieldValueS("packet_index", int64(c.PacketIndex))
+				d.FieldValueU("stream_offset", uint64(c.StreamOffset))
+				d.FieldValueU("length", uint64(c.Length))
+				fieldTimestamp(d, "timestamp", c.Timestamp)
+			})
+		}
+	})
+}
+
+// missing bytes, stream_offset is where in the reassembled stream they should have been
+func fieldTCPGaps(d *decode.D, name string, gaps []flowsdecoder.TCPGap) {
+	d.FieldArray(name, func(d *decode.D) {
+		for _, g := range gaps {
+			d.FieldStruct("gap", func(d *decode.D) {
+				d.FieldValueU("stream_offset", uint64(g.StreamOffset))
+				d.FieldValueU("length", uint64(g.Length))
+			})
+		}
+	})
+}
+
+// tlsKeyLog is passed to tcp stream decoders, can be nil
+func fieldFlows(d *decode.D, fd *flowsdecoder.Decoder, tcpStreamFormat decode.Group, udpPayloadFormat decode.Group, ipv4PacketFormat decode.Group, ipv6PacketFormat decode.Group, tlsKeyLog []byte) {
 	d.FieldArray("ipv4_reassembled", func(d *decode.D) {
 		for _, p := range fd.IPV4Reassembled {
 			br := bitio.NewBitReader(p.Datagram, -1)
@@ -48,6 +126,20 @@ func fieldFlows(d *decode.D, fd *flowsdecoder.Decoder, tcpStreamFormat decode.Gr
 		}
 	})
 
+	d.FieldArray("ipv6_reassembled", func(d *decode.D) {
+		for _, p := range fd.IPV6Reassembled {
+			br := bitio.NewBitReader(p.Datagram, -1)
+			if dv, _, _ := d.TryFieldFormatBitBuf(
+				"ipv6_packet",
+				br,
+				ipv6PacketFormat,
+				nil,
+			); dv == nil {
+				d.FieldRootBitBuf("ipv6_packet", br)
+			}
+		}
+	})
+
 	d.FieldArray("tcp_connections", func(d *decode.D) {
 		for _, s := range fd.TCPConnections {
 			d.FieldStruct("flow", func(d *decode.D) {
@@ -55,31 +147,62 @@ func fieldFlows(d *decode.D, fd *flowsdecoder.Decoder, tcpStreamFormat decode.Gr
 				d.FieldValueU("source_port", uint64(s.ClientEndpoint.Port), format.TCPPortMap)
 				d.FieldValueStr("destination_ip", s.ServerEndpoint.IP.String())
 				d.FieldValueU("destination_port", uint64(s.ServerEndpoint.Port), format.TCPPortMap)
-				csBR := bitio.NewBitReader(s.ClientToServer.Bytes(), -1)
-				if dv, _, _ := d.TryFieldFormatBitBuf(
-					"client_stream",
-					csBR,
-					tcpStreamFormat,
-					format.TCPStreamIn{
-						SourcePort:      s.ClientEndpoint.Port,
-						DestinationPort: s.ServerEndpoint.Port,
-					},
-				); dv == nil {
-					d.FieldRootBitBuf("client_stream", csBR)
+				d.FieldValueStr("state", s.State())
+				d.FieldValueStr("handshake", s.Handshake.String())
+				d.FieldValueBool("client_fin", s.ClientToServer.FIN)
+				d.FieldValueBool("client_rst", s.ClientToServer.RST)
+				d.FieldValueBool("server_fin", s.ServerToClient.FIN)
+				d.FieldValueBool("server_rst", s.ServerToClient.RST)
+				fieldTimestamp(d, "first_timestamp", s.FirstTimestamp)
+				fieldTimestamp(d, "last_timestamp", s.LastTimestamp)
+
+				fieldTCPStream(d, "client_stream", s.ClientToServer, tcpStreamFormat, format.TCPStreamIn{
+					SourcePort:      s.ClientEndpoint.Port,
+					DestinationPort: s.ServerEndpoint.Port,
+					PeerStream:      s.ServerToClient.Contiguous(),
+					TLSKeyLog:       tlsKeyLog,
+				})
+				fieldTCPStream(d, "server_stream", s.ServerToClient, tcpStreamFormat, format.TCPStreamIn{
+					SourcePort:      s.ClientEndpoint.Port,
+					DestinationPort: s.ServerEndpoint.Port,
+					PeerStream:      s.ClientToServer.Contiguous(),
+					TLSKeyLog:       tlsKeyLog,
+				})
+
+				fieldTCPChunks(d, "client_chunks", s.ClientToServer.Chunks)
+				fieldTCPGaps(d, "client_gaps", s.ClientToServer.Gaps)
+				d.FieldValueU("client_retransmissions", uint64(s.ClientToServer.Retransmissions))
+				fieldTCPChunks(d, "server_chunks", s.ServerToClient.Chunks)
+				fieldTCPGaps(d, "server_gaps", s.ServerToClient.Gaps)
+				d.FieldValueU("server_retransmissions", uint64(s.ServerToClient.Retransmissions))
+			})
+		}
+	})
+	d.FieldArray("udp_flows", func(d *decode.D) {
+		for _, f := range fd.UDPFlows {
+			d.FieldStruct("flow", func(d *decode.D) {
+				d.FieldValueStr("source_ip", f.ClientEndpoint.IP.String())
+				d.FieldValueU("source_port", uint64(f.ClientEndpoint.Port), format.UDPPortMap)
+				d.FieldValueStr("destination_ip", f.ServerEndpoint.IP.String())
+				d.FieldValueU("destination_port", uint64(f.ServerEndpoint.Port), format.UDPPortMap)
+
+				var bytes int
+				for _, dgs := range [][]flowsdecoder.UDPDatagram{f.ClientToServer, f.ServerToClient} {
+					for _, dg := range dgs {
+						bytes += len(dg.Payload)
+					}
 				}
+				d.FieldValueU("count", uint64(len(f.ClientToServer)+len(f.ServerToClient)))
+				d.FieldValueU("bytes", uint64(bytes))
+				fieldTimestamp(d, "first_timestamp", f.FirstTimestamp)
+				fieldTimestamp(d, "last_timestamp", f.LastTimestamp)
 
-				scBR := bitio.NewBitReader(s.ServerToClient.Bytes(), -1)
-				if dv, _, _ := d.TryFieldFormatBitBuf(
-					"server_stream",
-					scBR,
-					tcpStreamFormat,
-					format.TCPStreamIn{
-						SourcePort:      s.ClientEndpoint.Port,
-						DestinationPort: s.ServerEndpoint.Port,
-					},
-				); dv == nil {
-					d.FieldRootBitBuf("server_stream", scBR)
+				var clientPayloads [][]byte
+				for _, dg := range f.ClientToServer {
+					clientPayloads = append(clientPayloads, dg.Payload)
 				}
+				fieldUDPDatagrams(d, "client_datagrams", f.ClientToServer, udpPayloadFormat, f.ClientEndpoint, f.ServerEndpoint, clientPayloads)
+				fieldUDPDatagrams(d, "server_datagrams", f.ServerToClient, udpPayloadFormat, f.ServerEndpoint, f.ClientEndpoint, clientPayloads)
 			})
 		}
 	})
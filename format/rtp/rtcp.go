@@ -0,0 +1,314 @@
+package rtp
+
+// https://www.rfc-editor.org/rfc/rfc3550 RTP: A Transport Protocol for Real-Time Applications
+// https://www.rfc-editor.org/rfc/rfc4585 Extended RTP Profile for RTCP-Based Feedback (RTP/AVPF)
+// https://www.rfc-editor.org/rfc/rfc5104 Codec Control Messages in the RTP Audio-Visual Profile with Feedback (AVPF)
+// https://www.rfc-editor.org/rfc/rfc3611 RTP Control Protocol Extended Reports (RTCP XR)
+// https://datatracker.ietf.org/doc/html/draft-alvestrand-rmcat-remb
+// TODO: SRTCP
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.RTCP,
+		Description: "RTP Control Protocol",
+		Groups:      []string{format.UDP_PAYLOAD},
+		DecodeFn:    decodeRTCP,
+	})
+}
+
+const (
+	rtcpTypeSR    = 200
+	rtcpTypeRR    = 201
+	rtcpTypeSDES  = 202
+	rtcpTypeBYE   = 203
+	rtcpTypeAPP   = 204
+	rtcpTypeRTPFB = 205
+	rtcpTypePSFB  = 206
+	rtcpTypeXR    = 207
+)
+
+var rtcpTypeMap = scalar.UToScalar{
+	rtcpTypeSR:    {Sym: "sr", Description: "Sender report"},
+	rtcpTypeRR:    {Sym: "rr", Description: "Receiver report"},
+	rtcpTypeSDES:  {Sym: "sdes", Description: "Source description"},
+	rtcpTypeBYE:   {Sym: "bye", Description: "Goodbye"},
+	rtcpTypeAPP:   {Sym: "app", Description: "Application-defined"},
+	rtcpTypeRTPFB: {Sym: "rtpfb", Description: "Transport layer feedback"},
+	rtcpTypePSFB:  {Sym: "psfb", Description: "Payload-specific feedback"},
+	rtcpTypeXR:    {Sym: "xr", Description: "Extended report"},
+}
+
+const (
+	rtpfbGenericNACK = 1
+	rtpfbTransportCC = 15
+)
+
+var rtpfbFormatMap = scalar.UToScalar{
+	rtpfbGenericNACK: {Sym: "generic_nack", Description: "Generic NACK"},
+	3:                {Sym: "tmmbr", Description: "Temporary maximum media stream bit rate request"},
+	4:                {Sym: "tmmbn", Description: "Temporary maximum media stream bit rate notification"},
+	5:                {Sym: "rapid_resync", Description: "Rapid resynchronisation request"},
+	rtpfbTransportCC: {Sym: "transport_cc", Description: "Transport-wide congestion control"},
+}
+
+const (
+	psfbPLI = 1
+	psfbFIR = 4
+	psfbAFB = 15
+)
+
+var psfbFormatMap = scalar.UToScalar{
+	psfbPLI: {Sym: "pli", Description: "Picture loss indication"},
+	2:       {Sym: "sli", Description: "Slice loss indication"},
+	3:       {Sym: "rpsi", Description: "Reference picture selection indication"},
+	psfbFIR: {Sym: "fir", Description: "Full intra request"},
+	5:       {Sym: "tstr", Description: "Temporal-spatial trade-off request"},
+	6:       {Sym: "tstn", Description: "Temporal-spatial trade-off notification"},
+	7:       {Sym: "vbcm", Description: "Video back channel message"},
+	psfbAFB: {Sym: "afb", Description: "Application layer feedback"},
+}
+
+const sdesItemEnd = 0
+
+var sdesItemTypeMap = scalar.UToScalar{
+	sdesItemEnd: {Sym: "end", Description: "End of item list"},
+	1:           {Sym: "cname", Description: "Canonical end-point identifier"},
+	2:           {Sym: "name", Description: "User name"},
+	3:           {Sym: "email", Description: "Electronic mail address"},
+	4:           {Sym: "phone", Description: "Phone number"},
+	5:           {Sym: "loc", Description: "Geographic user location"},
+	6:           {Sym: "tool", Description: "Application or tool name"},
+	7:           {Sym: "note", Description: "Notice/status"},
+	8:           {Sym: "priv", Description: "Private extensions"},
+}
+
+var ntpEpochDate = time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// 32.32 fixed point seconds since 1900
+var ntpTimestamp = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	t := ntpEpochDate.Add(time.Duration(uv>>32)*time.Second + time.Duration((uv&0xffff_ffff)*uint64(time.Second)>>32))
+	s.Description = t.Format(time.RFC3339Nano)
+	return s, nil
+})
+
+// packets chains to end of datagram
+func isRTCPCompound(bs []byte) bool {
+	if len(bs) < 8 {
+		return false
+	}
+	for len(bs) > 0 {
+		if len(bs) < 4 || bs[0]>>6 != 2 || bs[1] < rtcpTypeSR || bs[1] > rtcpTypeXR {
+			return false
+		}
+		n := 4 + int(binary.BigEndian.Uint16(bs[2:]))*4
+		if n > len(bs) {
+			return false
+		}
+		bs = bs[n:]
+	}
+	return true
+}
+
+func fieldRTCPReportBlocks(d *decode.D, count uint64) {
+	d.FieldArray("report_blocks", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("report_block", func(d *decode.D) {
+				d.FieldU32("ssrc", scalar.Hex)
+				d.FieldU8("fraction_lost")
+				d.FieldS24("cumulative_lost")
+				d.FieldU32("extended_highest_sequence_number")
+				d.FieldU32("interarrival_jitter")
+				d.FieldU32("last_sr")
+				d.FieldU32("delay_since_last_sr")
+			})
+		}
+	})
+}
+
+func decodeRTCPFeedback(d *decode.D, typ uint64, fbFormat uint64) {
+	d.FieldU32("sender_ssrc", scalar.Hex)
+	d.FieldU32("media_ssrc", scalar.Hex)
+
+	switch {
+	case typ == rtcpTypeRTPFB && fbFormat == rtpfbGenericNACK:
+		d.FieldArray("nacks", func(d *decode.D) {
+			for !d.End() {
+				d.FieldStruct("nack", func(d *decode.D) {
+					d.FieldU16("packet_id")
+					d.FieldU16("lost_packets_bitmask", scalar.Bin)
+				})
+			}
+		})
+	case typ == rtcpTypePSFB && fbFormat == psfbPLI:
+		// no feedback control information
+	case typ == rtcpTypePSFB && fbFormat == psfbFIR:
+		d.FieldArray("entries", func(d *decode.D) {
+			for !d.End() {
+				d.FieldStruct("entry", func(d *decode.D) {
+					d.FieldU32("ssrc", scalar.Hex)
+					d.FieldU8("sequence_number")
+					d.FieldU24("reserved")
+				})
+			}
+		})
+	case typ == rtcpTypePSFB && fbFormat == psfbAFB && d.BitsLeft() >= 4*8 && string(d.PeekBytes(4)) == "REMB":
+		d.FieldUTF8("unique_identifier", 4)
+		ssrcs := d.FieldU8("ssrcs_count")
+		exp := d.FieldU6("bitrate_exponent")
+		mantissa := d.FieldU18("bitrate_mantissa")
+		d.FieldValueU("bitrate", mantissa<<exp)
+		d.FieldArray("ssrcs", func(d *decode.D) {
+			for i := uint64(0); i < ssrcs; i++ {
+				d.FieldU32("ssrc", scalar.Hex)
+			}
+		})
+	default:
+		d.FieldRawLen("feedback_control_information", d.BitsLeft())
+	}
+}
+
+func decodeRTCPPacket(d *decode.D) {
+	typ := d.PeekBits(16) & 0xff
+
+	d.FieldU2("version")
+	padding := d.FieldBool("padding")
+	var count uint64
+	switch typ {
+	case rtcpTypeRTPFB:
+		count = d.FieldU5("format", rtpfbFormatMap)
+	case rtcpTypePSFB:
+		count = d.FieldU5("format", psfbFormatMap)
+	case rtcpTypeAPP:
+		count = d.FieldU5("subtype")
+	default:
+		count = d.FieldU5("count")
+	}
+	d.FieldU8("packet_type", rtcpTypeMap)
+	length := d.FieldU16("length", scalar.Description("32-bit words minus one"))
+
+	bodyLen := int64(length) * 32
+	var paddingLen int64
+	if padding && bodyLen > 0 {
+		paddingLen = int64(d.BytesRange(d.Pos()+bodyLen-8, 1)[0]) * 8
+		if paddingLen > bodyLen {
+			d.Fatalf("invalid padding length")
+		}
+	}
+	d.FramedFn(bodyLen-paddingLen, func(d *decode.D) {
+		switch typ {
+		case rtcpTypeSR:
+			d.FieldU32("ssrc", scalar.Hex)
+			d.FieldStruct("sender_info", func(d *decode.D) {
+				d.FieldU64("ntp_timestamp", ntpTimestamp)
+				d.FieldU32("rtp_timestamp")
+				d.FieldU32("packet_count")
+				d.FieldU32("octet_count")
+			})
+			fieldRTCPReportBlocks(d, count)
+		case rtcpTypeRR:
+			d.FieldU32("ssrc", scalar.Hex)
+			fieldRTCPReportBlocks(d, count)
+		case rtcpTypeSDES:
+			d.FieldArray("chunks", func(d *decode.D) {
+				for i := uint64(0); i < count; i++ {
+					d.FieldStruct("chunk", func(d *decode.D) {
+						d.FieldU32("ssrc", scalar.Hex)
+						d.FieldArray("items", func(d *decode.D) {
+							for {
+								end := false
+								d.FieldStruct("item", func(d *decode.D) {
+									typ := d.FieldU8("type", sdesItemTypeMap)
+									if typ == sdesItemEnd {
+										end = true
+										return
+									}
+									length := d.FieldU8("length")
+									d.FieldUTF8("text", int(length))
+								})
+								if end {
+									break
+								}
+							}
+						})
+						// chunks are padded to 32 bit boundary
+						d.FieldRawLen("padding", int64(d.AlignBits(32)))
+					})
+				}
+			})
+		case rtcpTypeBYE:
+			d.FieldArray("ssrcs", func(d *decode.D) {
+				for i := uint64(0); i < count; i++ {
+					d.FieldU32("ssrc", scalar.Hex)
+				}
+			})
+			if !d.End() {
+				length := d.FieldU8("reason_length")
+				d.FieldUTF8("reason", int(length))
+			}
+		case rtcpTypeAPP:
+			d.FieldU32("ssrc", scalar.Hex)
+			d.FieldUTF8("name", 4)
+			d.FieldRawLen("data", d.BitsLeft())
+		case rtcpTypeRTPFB, rtcpTypePSFB:
+			decodeRTCPFeedback(d, typ, count)
+		case rtcpTypeXR:
+			d.FieldU32("ssrc", scalar.Hex)
+			d.FieldArray("report_blocks", func(d *decode.D) {
+				for !d.End() {
+					d.FieldStruct("report_block", func(d *decode.D) {
+						d.FieldU8("block_type")
+						d.FieldU8("type_specific")
+						length := d.FieldU16("block_length")
+						d.FieldRawLen("data", int64(length)*32)
+					})
+				}
+			})
+		}
+		if !d.End() {
+			d.FieldRawLen("extension", d.BitsLeft())
+		}
+	})
+	if paddingLen > 0 {
+		d.FieldRawLen("padding_data", paddingLen-8)
+		d.FieldU8("padding_length")
+	}
+}
+
+func decodeRTCP(d *decode.D, in interface{}) interface{} {
+	if !isRTCPCompound(d.PeekBytes(int(d.BitsLeft() / 8))) {
+		d.Fatalf("not a RTCP compound packet")
+	}
+	if upi, ok := in.(format.UDPPayloadIn); ok {
+		if ports := optionPorts(d); ports != nil {
+			// RTCP is sent on the RTP port or the port following it
+			if !ports[upi.SourcePort] && !ports[upi.DestinationPort] &&
+				!ports[upi.SourcePort-1] && !ports[upi.DestinationPort-1] {
+				d.Fatalf("wrong port")
+			}
+		} else if upi.SourcePort < 1024 || upi.DestinationPort < 1024 {
+			d.Fatalf("wrong port")
+		}
+	}
+
+	d.FieldArray("packets", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("packet", decodeRTCPPacket)
+		}
+	})
+
+	return nil
+}
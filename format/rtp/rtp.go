@@ -0,0 +1,405 @@
+package rtp
+
+// https://www.rfc-editor.org/rfc/rfc3550 RTP: A Transport Protocol for Real-Time Applications
+// https://www.rfc-editor.org/rfc/rfc3551 RTP Profile for Audio and Video Conferences
+// https://www.rfc-editor.org/rfc/rfc8285 A General Mechanism for RTP Header Extensions
+// https://www.rfc-editor.org/rfc/rfc5761 Multiplexing RTP Data and Control Packets on a Single Port
+// TODO: SRTP decryption
+// TODO: interleaved H.264/H.265 packetization modes
+
+import (
+	"embed"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed *.jq
+var rtpFS embed.FS
+
+// formats used to decode payloads
+type payloadFormats struct {
+	opusPacket decode.Group
+	avcNALU    decode.Group
+	avcAU      decode.Group
+	hevcNALU   decode.Group
+	hevcAU     decode.Group
+	vp8Frame   decode.Group
+	vp9Frame   decode.Group
+	aacFrame   decode.Group
+}
+
+var rtpPayloadFormats payloadFormats
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.RTP,
+		Description: "Real-time Transport Protocol",
+		Groups:      []string{format.UDP_PAYLOAD},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.OPUS_PACKET}, Group: &rtpPayloadFormats.opusPacket},
+			{Names: []string{format.AVC_NALU}, Group: &rtpPayloadFormats.avcNALU},
+			{Names: []string{format.AVC_AU}, Group: &rtpPayloadFormats.avcAU},
+			{Names: []string{format.HEVC_NALU}, Group: &rtpPayloadFormats.hevcNALU},
+			{Names: []string{format.HEVC_AU}, Group: &rtpPayloadFormats.hevcAU},
+			{Names: []string{format.VP8_FRAME}, Group: &rtpPayloadFormats.vp8Frame},
+			{Names: []string{format.VP9_FRAME}, Group: &rtpPayloadFormats.vp9Frame},
+			{Names: []string{format.AAC_FRAME}, Group: &rtpPayloadFormats.aacFrame},
+		},
+		DecodeFn: decodeRTP,
+		Files:    rtpFS,
+	})
+}
+
+// max number of earlier datagrams to look at when reassembling a frame
+const maxFramePackets = 1024
+
+type encoding struct {
+	name      string // lower case encoding name, ex: h264
+	clockRate int
+}
+
+// https://www.iana.org/assignments/rtp-parameters/rtp-parameters.xhtml
+var staticPayloadTypes = map[uint64]encoding{
+	0:  {name: "pcmu", clockRate: 8000},
+	3:  {name: "gsm", clockRate: 8000},
+	4:  {name: "g723", clockRate: 8000},
+	5:  {name: "dvi4", clockRate: 8000},
+	6:  {name: "dvi4", clockRate: 16000},
+	7:  {name: "lpc", clockRate: 8000},
+	8:  {name: "pcma", clockRate: 8000},
+	9:  {name: "g722", clockRate: 8000},
+	10: {name: "l16", clockRate: 44100},
+	11: {name: "l16", clockRate: 44100},
+	12: {name: "qcelp", clockRate: 8000},
+	13: {name: "cn", clockRate: 8000},
+	14: {name: "mpa", clockRate: 90000},
+	15: {name: "g728", clockRate: 8000},
+	16: {name: "dvi4", clockRate: 11025},
+	17: {name: "dvi4", clockRate: 22050},
+	18: {name: "g729", clockRate: 8000},
+	25: {name: "celb", clockRate: 90000},
+	26: {name: "jpeg", clockRate: 90000},
+	28: {name: "nv", clockRate: 90000},
+	31: {name: "h261", clockRate: 90000},
+	32: {name: "mpv", clockRate: 90000},
+	33: {name: "mp2t", clockRate: 90000},
+	34: {name: "h263", clockRate: 90000},
+}
+
+// clock rates of dynamic payload type encodings with a fixed clock rate
+var encodingClockRates = map[string]int{
+	"opus": 48000,
+	"h264": 90000,
+	"h265": 90000,
+	"vp8":  90000,
+	"vp9":  90000,
+}
+
+var payloadTypeMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	if e, ok := staticPayloadTypes[uv]; ok {
+		s.Sym = e.name
+	} else if uv >= 96 && uv <= 127 {
+		s.Description = "Dynamic"
+	}
+	return s, nil
+})
+
+const (
+	extensionProfileOneByte = 0xbede
+	extensionProfileTwoByte = 0x1000 // lower 4 bits are application bits
+)
+
+var extensionProfileMap = scalar.UToScalar{
+	extensionProfileOneByte: {Sym: "one_byte", Description: "One-byte header extensions"},
+	extensionProfileTwoByte: {Sym: "two_byte", Description: "Two-byte header extensions"},
+}
+
+type rtpPacket struct {
+	marker         bool
+	payloadType    int
+	sequenceNumber uint16
+	timestamp      uint32
+	ssrc           uint32
+	payload        []byte // without header, extension and padding
+}
+
+func parseRTPPacket(bs []byte) (rtpPacket, bool) {
+	if len(bs) < 12 || bs[0]>>6 != 2 {
+		return rtpPacket{}, false
+	}
+	n := 12 + int(bs[0]&0xf)*4
+	if bs[0]&0x10 != 0 {
+		if len(bs) < n+4 {
+			return rtpPacket{}, false
+		}
+		n += 4 + int(binary.BigEndian.Uint16(bs[n+2:]))*4
+	}
+	end := len(bs)
+	if bs[0]&0x20 != 0 {
+		if bs[end-1] == 0 {
+			return rtpPacket{}, false
+		}
+		end -= int(bs[end-1])
+	}
+	if n > end {
+		return rtpPacket{}, false
+	}
+	return rtpPacket{
+		marker:         bs[1]&0x80 != 0,
+		payloadType:    int(bs[1] & 0x7f),
+		sequenceNumber: binary.BigEndian.Uint16(bs[2:]),
+		timestamp:      binary.BigEndian.Uint32(bs[4:]),
+		ssrc:           binary.BigEndian.Uint32(bs[8:]),
+		payload:        bs[n:end],
+	}, true
+}
+
+// payload types 64-95 are avoided as they would be confused with RTCP
+func isRTCPConflictingPayloadType(pt int) bool {
+	return pt >= 64 && pt <= 95
+}
+
+// ports from rtp_ports option, nil if not set
+func optionPorts(d *decode.D) map[int]bool {
+	var vs []interface{}
+	switch v := d.Options.FormatOptions["rtp_ports"].(type) {
+	case []interface{}:
+		vs = v
+	case nil:
+		return nil
+	default:
+		vs = []interface{}{v}
+	}
+	ports := map[int]bool{}
+	for _, v := range vs {
+		switch v := v.(type) {
+		case int:
+			ports[v] = true
+		case float64:
+			ports[int(v)] = true
+		}
+	}
+	return ports
+}
+
+// encodings from rtp_payload_types option, values are in the SDP rtpmap
+// attribute form "<encoding name>/<clock rate>[/<channels>]", ex: {"96": "VP8/90000"}
+func optionPayloadTypes(d *decode.D) map[int]encoding {
+	m, ok := d.Options.FormatOptions["rtp_payload_types"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	encs := map[int]encoding{}
+	for k, v := range m {
+		pt, err := strconv.Atoi(k)
+		if err != nil {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		parts := strings.Split(s, "/")
+		e := encoding{name: strings.ToLower(parts[0])}
+		e.clockRate = encodingClockRates[e.name]
+		if len(parts) > 1 {
+			if n, err := strconv.Atoi(parts[1]); err == nil {
+				e.clockRate = n
+			}
+		}
+		encs[pt] = e
+	}
+	return encs
+}
+
+type rtpDecoder struct {
+	upi       format.UDPPayloadIn
+	encodings map[int]encoding
+}
+
+func (rd *rtpDecoder) encoding(pt int) (encoding, bool) {
+	if e, ok := rd.encodings[pt]; ok {
+		return e, true
+	}
+	e, ok := staticPayloadTypes[uint64(pt)]
+	return e, ok
+}
+
+// datagrams of a flow are assumed to be RTP if some nearby datagram has the same SSRC
+func hasNearbySameSource(payloads [][]byte, index int, p rtpPacket) bool {
+	const maxDistance = 8
+	for i := index - maxDistance; i <= index+maxDistance; i++ {
+		if i == index || i < 0 || i >= len(payloads) {
+			continue
+		}
+		if pp, ok := parseRTPPacket(payloads[i]); ok && pp.ssrc == p.ssrc && !isRTCPConflictingPayloadType(pp.payloadType) {
+			return true
+		}
+	}
+	return false
+}
+
+// packets with the same timestamp as packet p ending with p, oldest first. If isStart is not nil
+// the frame starts at the last packet it reports as a start. Returns nil if some packet is missing.
+func (rd *rtpDecoder) framePackets(p rtpPacket, isStart func(payload []byte) bool) []rtpPacket {
+	ps := []rtpPacket{p}
+	for i := rd.upi.PayloadIndex - 1; i >= 0 && rd.upi.PayloadIndex-i <= maxFramePackets; i-- {
+		pp, ok := parseRTPPacket(rd.upi.Payloads[i])
+		if !ok || pp.ssrc != p.ssrc || pp.payloadType != p.payloadType {
+			continue
+		}
+		if pp.timestamp != p.timestamp {
+			break
+		}
+		// ignore retransmissions and packets after p
+		if d := int16(p.sequenceNumber - pp.sequenceNumber); d <= 0 {
+			continue
+		}
+		ps = append(ps, pp)
+	}
+	// might have been reordered
+	sort.SliceStable(ps, func(i, j int) bool {
+		return int16(p.sequenceNumber-ps[i].sequenceNumber) > int16(p.sequenceNumber-ps[j].sequenceNumber)
+	})
+
+	if isStart != nil {
+		start := -1
+		for i := len(ps) - 1; i >= 0; i-- {
+			if isStart(ps[i].payload) {
+				start = i
+				break
+			}
+		}
+		if start == -1 {
+			return nil
+		}
+		ps = ps[start:]
+	}
+	for i := 1; i < len(ps); i++ {
+		if ps[i].sequenceNumber != ps[i-1].sequenceNumber+1 {
+			return nil
+		}
+	}
+
+	return ps
+}
+
+func decodeRTPHeaderExtension(d *decode.D) {
+	profile := d.FieldU16("profile", extensionProfileMap, scalar.Hex)
+	length := d.FieldU16("length")
+	d.FramedFn(int64(length)*32, func(d *decode.D) {
+		switch {
+		case profile == extensionProfileOneByte:
+			d.FieldArray("elements", func(d *decode.D) {
+				for !d.End() {
+					if d.PeekBits(8) == 0 {
+						d.FieldU8("padding")
+						continue
+					}
+					d.FieldStruct("element", func(d *decode.D) {
+						id := d.FieldU4("id")
+						l := d.FieldU4("length", scalar.UAdd(1))
+						if id == 15 {
+							// reserved, stop processing
+							d.FieldRawLen("data", d.BitsLeft())
+							return
+						}
+						d.FieldRawLen("data", int64(l)*8)
+					})
+				}
+			})
+		case profile&0xfff0 == extensionProfileTwoByte:
+			d.FieldArray("elements", func(d *decode.D) {
+				for !d.End() {
+					if d.PeekBits(8) == 0 {
+						d.FieldU8("padding")
+						continue
+					}
+					d.FieldStruct("element", func(d *decode.D) {
+						d.FieldU8("id")
+						l := d.FieldU8("length")
+						d.FieldRawLen("data", int64(l)*8)
+					})
+				}
+			})
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+func decodeRTP(d *decode.D, in interface{}) interface{} {
+	rd := &rtpDecoder{encodings: optionPayloadTypes(d)}
+
+	p, ok := parseRTPPacket(d.PeekBytes(int(d.BitsLeft() / 8)))
+	if !ok || isRTCPConflictingPayloadType(p.payloadType) {
+		d.Fatalf("not a RTP packet")
+	}
+	if upi, ok := in.(format.UDPPayloadIn); ok {
+		rd.upi = upi
+		if ports := optionPorts(d); ports != nil {
+			if !ports[upi.SourcePort] && !ports[upi.DestinationPort] {
+				d.Fatalf("wrong port")
+			}
+		} else {
+			if upi.SourcePort < 1024 || upi.DestinationPort < 1024 {
+				d.Fatalf("wrong port")
+			}
+			// without flow context, ex: a single datagram or packet, there is nothing to tell
+			// RTP apart from other UDP payloads
+			if !hasNearbySameSource(upi.Payloads, upi.PayloadIndex, p) {
+				d.Fatalf("no other datagram with same SSRC")
+			}
+		}
+	}
+
+	d.FieldU2("version")
+	padding := d.FieldBool("padding")
+	extension := d.FieldBool("extension")
+	csrcCount := d.FieldU4("csrc_count")
+	d.FieldBool("marker")
+	d.FieldU7("payload_type", payloadTypeMap)
+	d.FieldU16("sequence_number")
+	d.FieldU32("timestamp")
+	d.FieldU32("ssrc", scalar.Hex)
+	d.FieldArray("csrcs", func(d *decode.D) {
+		for i := uint64(0); i < csrcCount; i++ {
+			d.FieldU32("csrc", scalar.Hex)
+		}
+	})
+	if extension {
+		d.FieldStruct("header_extension", decodeRTPHeaderExtension)
+	}
+
+	e, ok := rd.encoding(p.payloadType)
+	if ok {
+		d.FieldValueStr("encoding", e.name)
+		if e.clockRate != 0 {
+			d.FieldValueU("clock_rate", uint64(e.clockRate))
+		}
+	}
+	payloadLen := int64(len(p.payload)) * 8
+	if fn, ok := payloadFns[e.name]; ok {
+		d.FramedFn(payloadLen, func(d *decode.D) { fn(d, rd, p) })
+	} else {
+		d.FieldRawLen("payload", payloadLen)
+	}
+
+	if padding {
+		d.FieldRawLen("padding_data", d.BitsLeft()-8)
+		d.FieldU8("padding_length")
+	}
+
+	return nil
+}
@@ -0,0 +1,621 @@
+package rtp
+
+// https://www.rfc-editor.org/rfc/rfc7587 RTP Payload Format for the Opus Speech and Audio Codec
+// https://www.rfc-editor.org/rfc/rfc6184 RTP Payload Format for H.264 Video
+// https://www.rfc-editor.org/rfc/rfc7798 RTP Payload Format for High Efficiency Video Coding (HEVC)
+// https://www.rfc-editor.org/rfc/rfc7741 RTP Payload Format for VP8 Video
+// https://www.rfc-editor.org/rfc/rfc9628 RTP Payload Format for VP9 Video
+// https://www.rfc-editor.org/rfc/rfc3640 RTP Payload Format for Transport of MPEG-4 Elementary Streams
+// TODO: AAC-lbr and other RFC 3640 modes, only AAC-hbr is supported
+// TODO: H.265 DONL fields, assumes sprop-max-don-diff is 0
+
+import (
+	"encoding/binary"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var payloadFns = map[string]func(d *decode.D, rd *rtpDecoder, p rtpPacket){
+	"opus":          decodeOpusPayload,
+	"h264":          decodeH264Payload,
+	"h265":          decodeH265Payload,
+	"vp8":           decodeVP8Payload,
+	"vp9":           decodeVP9Payload,
+	"mpeg4-generic": decodeMPEG4GenericPayload,
+}
+
+// try decode using group, fallback to raw bits
+func fieldFormatOrRawLen(d *decode.D, name string, nBits int64, group decode.Group, inArg interface{}) {
+	if dv, _, _ := d.TryFieldFormatLen(name, nBits, group, inArg); dv == nil {
+		d.FieldRawLen(name, nBits)
+	}
+}
+
+func fieldFormatOrRawBitBuf(d *decode.D, name string, bs []byte, group decode.Group, inArg interface{}) {
+	br := bitio.NewBitReader(bs, -1)
+	if dv, _, _ := d.TryFieldFormatBitBuf(name, br, group, inArg); dv == nil {
+		d.FieldRootBitBuf(name, br)
+	}
+}
+
+// NAL units prefixed with 4 byte length, used as avc_au and hevc_au input
+func lengthPrefixed(nalus [][]byte) []byte {
+	var bs []byte
+	for _, n := range nalus {
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(n)))
+		bs = append(bs, l[:]...)
+		bs = append(bs, n...)
+	}
+	return bs
+}
+
+func decodeOpusPayload(d *decode.D, _ *rtpDecoder, _ rtpPacket) {
+	fieldFormatOrRawLen(d, "payload", d.BitsLeft(), rtpPayloadFormats.opusPacket, nil)
+}
+
+const (
+	h264NALTypeSTAPA  = 24
+	h264NALTypeSTAPB  = 25
+	h264NALTypeMTAP16 = 26
+	h264NALTypeMTAP24 = 27
+	h264NALTypeFUA    = 28
+	h264NALTypeFUB    = 29
+)
+
+var h264PayloadNALTypeMap = scalar.UToSymStr{
+	h264NALTypeSTAPA:  "STAP_A",
+	h264NALTypeSTAPB:  "STAP_B",
+	h264NALTypeMTAP16: "MTAP16",
+	h264NALTypeMTAP24: "MTAP24",
+	h264NALTypeFUA:    "FU_A",
+	h264NALTypeFUB:    "FU_B",
+}
+
+func h264IsStart(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	switch payload[0] & 0x1f {
+	case h264NALTypeFUA:
+		return len(payload) >= 2 && payload[1]&0x80 != 0
+	default:
+		return true
+	}
+}
+
+func h264NALUs(ps []rtpPacket) [][]byte {
+	var nalus [][]byte
+	var fu []byte
+	for _, p := range ps {
+		pl := p.payload
+		if len(pl) < 1 {
+			continue
+		}
+		switch pl[0] & 0x1f {
+		case h264NALTypeSTAPA:
+			for b := pl[1:]; len(b) >= 2; {
+				n := int(binary.BigEndian.Uint16(b))
+				b = b[2:]
+				if n > len(b) {
+					break
+				}
+				nalus = append(nalus, b[:n])
+				b = b[n:]
+			}
+		case h264NALTypeFUA:
+			if len(pl) < 2 {
+				continue
+			}
+			if pl[1]&0x80 != 0 {
+				fu = []byte{pl[0]&0xe0 | pl[1]&0x1f}
+			} else if fu == nil {
+				continue
+			}
+			fu = append(fu, pl[2:]...)
+			if pl[1]&0x40 != 0 {
+				nalus = append(nalus, fu)
+				fu = nil
+			}
+		case h264NALTypeSTAPB, h264NALTypeMTAP16, h264NALTypeMTAP24, h264NALTypeFUB:
+			// interleaved mode not supported
+		default:
+			nalus = append(nalus, pl)
+		}
+	}
+	return nalus
+}
+
+func decodeH264Payload(d *decode.D, rd *rtpDecoder, p rtpPacket) {
+	if d.BitsLeft() < 8 {
+		d.FieldRawLen("payload", d.BitsLeft())
+		return
+	}
+
+	switch d.PeekBits(8) & 0x1f {
+	case h264NALTypeSTAPA:
+		d.FieldStruct("payload", func(d *decode.D) {
+			d.FieldBool("forbidden_zero_bit")
+			d.FieldU2("nal_ref_idc")
+			d.FieldU5("nal_unit_type", h264PayloadNALTypeMap)
+			d.FieldArray("nalus", func(d *decode.D) {
+				for d.BitsLeft() >= 16 {
+					d.FieldStruct("nalu", func(d *decode.D) {
+						size := d.FieldU16("size")
+						fieldFormatOrRawLen(d, "nalu", int64(size)*8, rtpPayloadFormats.avcNALU, nil)
+					})
+				}
+			})
+		})
+	case h264NALTypeFUA:
+		d.FieldStruct("payload", func(d *decode.D) {
+			d.FieldBool("forbidden_zero_bit")
+			d.FieldU2("nal_ref_idc")
+			d.FieldU5("nal_unit_type", h264PayloadNALTypeMap)
+			d.FieldStruct("fu_header", func(d *decode.D) {
+				d.FieldBool("start")
+				d.FieldBool("end")
+				d.FieldBool("reserved")
+				d.FieldU5("nal_unit_type")
+			})
+			d.FieldRawLen("fragment", d.BitsLeft())
+		})
+	case h264NALTypeSTAPB, h264NALTypeMTAP16, h264NALTypeMTAP24, h264NALTypeFUB:
+		d.FieldStruct("payload", func(d *decode.D) {
+			d.FieldBool("forbidden_zero_bit")
+			d.FieldU2("nal_ref_idc")
+			d.FieldU5("nal_unit_type", h264PayloadNALTypeMap)
+			d.FieldRawLen("data", d.BitsLeft())
+		})
+	default:
+		fieldFormatOrRawLen(d, "payload", d.BitsLeft(), rtpPayloadFormats.avcNALU, nil)
+	}
+
+	// marker bit is set on last packet of an access unit
+	if !p.marker {
+		return
+	}
+	// access unit is all packets with same timestamp
+	if ps := rd.framePackets(p, nil); len(ps) > 1 && h264IsStart(ps[0].payload) {
+		fieldFormatOrRawBitBuf(d, "access_unit", lengthPrefixed(h264NALUs(ps)), rtpPayloadFormats.avcAU, format.AvcIn{LengthSize: 4})
+	}
+}
+
+const (
+	h265NALTypeAP   = 48
+	h265NALTypeFU   = 49
+	h265NALTypePACI = 50
+)
+
+var h265PayloadNALTypeMap = scalar.UToSymStr{
+	h265NALTypeAP:   "AP",
+	h265NALTypeFU:   "FU",
+	h265NALTypePACI: "PACI",
+}
+
+func h265IsStart(payload []byte) bool {
+	if len(payload) < 2 {
+		return false
+	}
+	switch (payload[0] >> 1) & 0x3f {
+	case h265NALTypeFU:
+		return len(payload) >= 3 && payload[2]&0x80 != 0
+	default:
+		return true
+	}
+}
+
+func h265NALUs(ps []rtpPacket) [][]byte {
+	var nalus [][]byte
+	var fu []byte
+	for _, p := range ps {
+		pl := p.payload
+		if len(pl) < 2 {
+			continue
+		}
+		switch (pl[0] >> 1) & 0x3f {
+		case h265NALTypeAP:
+			for b := pl[2:]; len(b) >= 2; {
+				n := int(binary.BigEndian.Uint16(b))
+				b = b[2:]
+				if n > len(b) {
+					break
+				}
+				nalus = append(nalus, b[:n])
+				b = b[n:]
+			}
+		case h265NALTypeFU:
+			if len(pl) < 3 {
+				continue
+			}
+			if pl[2]&0x80 != 0 {
+				fu = []byte{pl[0]&0x81 | (pl[2]&0x3f)<<1, pl[1]}
+			} else if fu == nil {
+				continue
+			}
+			fu = append(fu, pl[3:]...)
+			if pl[2]&0x40 != 0 {
+				nalus = append(nalus, fu)
+				fu = nil
+			}
+		case h265NALTypePACI:
+			// not supported
+		default:
+			nalus = append(nalus, pl)
+		}
+	}
+	return nalus
+}
+
+func fieldH265PayloadHeader(d *decode.D) {
+	d.FieldBool("forbidden_zero_bit")
+	d.FieldU6("nal_unit_type", h265PayloadNALTypeMap)
+	d.FieldU6("nuh_layer_id")
+	d.FieldU3("nuh_temporal_id_plus1")
+}
+
+func decodeH265Payload(d *decode.D, rd *rtpDecoder, p rtpPacket) {
+	if d.BitsLeft() < 16 {
+		d.FieldRawLen("payload", d.BitsLeft())
+		return
+	}
+
+	switch (d.PeekBits(8) >> 1) & 0x3f {
+	case h265NALTypeAP:
+		d.FieldStruct("payload", func(d *decode.D) {
+			fieldH265PayloadHeader(d)
+			d.FieldArray("nalus", func(d *decode.D) {
+				for d.BitsLeft() >= 16 {
+					d.FieldStruct("nalu", func(d *decode.D) {
+						size := d.FieldU16("size")
+						fieldFormatOrRawLen(d, "nalu", int64(size)*8, rtpPayloadFormats.hevcNALU, nil)
+					})
+				}
+			})
+		})
+	case h265NALTypeFU:
+		d.FieldStruct("payload", func(d *decode.D) {
+			fieldH265PayloadHeader(d)
+			d.FieldStruct("fu_header", func(d *decode.D) {
+				d.FieldBool("start")
+				d.FieldBool("end")
+				d.FieldU6("nal_unit_type")
+			})
+			d.FieldRawLen("fragment", d.BitsLeft())
+		})
+	case h265NALTypePACI:
+		d.FieldStruct("payload", func(d *decode.D) {
+			fieldH265PayloadHeader(d)
+			d.FieldRawLen("data", d.BitsLeft())
+		})
+	default:
+		fieldFormatOrRawLen(d, "payload", d.BitsLeft(), rtpPayloadFormats.hevcNALU, nil)
+	}
+
+	// marker bit is set on last packet of an access unit
+	if !p.marker {
+		return
+	}
+	// access unit is all packets with same timestamp
+	if ps := rd.framePackets(p, nil); len(ps) > 1 && h265IsStart(ps[0].payload) {
+		fieldFormatOrRawBitBuf(d, "access_unit", lengthPrefixed(h265NALUs(ps)), rtpPayloadFormats.hevcAU, format.HevcIn{LengthSize: 4})
+	}
+}
+
+// length of VP8 payload descriptor and if it starts a frame, ok is false if truncated
+func vp8Descriptor(pl []byte) (n int, start bool, ok bool) {
+	if len(pl) < 1 {
+		return 0, false, false
+	}
+	n = 1
+	// start of partition 0
+	start = pl[0]&0x10 != 0 && pl[0]&0x07 == 0
+	if pl[0]&0x80 != 0 {
+		if len(pl) < 2 {
+			return 0, false, false
+		}
+		x := pl[1]
+		n++
+		if x&0x80 != 0 {
+			if len(pl) > n && pl[n]&0x80 != 0 {
+				n++
+			}
+			n++
+		}
+		if x&0x40 != 0 {
+			n++
+		}
+		if x&0x30 != 0 {
+			n++
+		}
+	}
+	return n, start, n <= len(pl)
+}
+
+func vp8IsStart(payload []byte) bool {
+	_, start, ok := vp8Descriptor(payload)
+	return ok && start
+}
+
+func decodeVP8Payload(d *decode.D, rd *rtpDecoder, p rtpPacket) {
+	_, start, ok := vp8Descriptor(p.payload)
+	if !ok {
+		d.FieldRawLen("payload", d.BitsLeft())
+		return
+	}
+
+	d.FieldStruct("payload_descriptor", func(d *decode.D) {
+		extended := d.FieldBool("extended_control_bits_present")
+		d.FieldBool("reserved0")
+		d.FieldBool("non_reference_frame")
+		d.FieldBool("start_of_partition")
+		d.FieldBool("reserved1")
+		d.FieldU3("partition_index")
+		if !extended {
+			return
+		}
+		pictureIDPresent := d.FieldBool("picture_id_present")
+		tl0PicIdxPresent := d.FieldBool("tl0_pic_idx_present")
+		tidPresent := d.FieldBool("tid_present")
+		keyIdxPresent := d.FieldBool("key_idx_present")
+		d.FieldU4("reserved2")
+		if pictureIDPresent {
+			if d.FieldBool("picture_id_extended") {
+				d.FieldU15("picture_id")
+			} else {
+				d.FieldU7("picture_id")
+			}
+		}
+		if tl0PicIdxPresent {
+			d.FieldU8("tl0_pic_idx")
+		}
+		if tidPresent || keyIdxPresent {
+			d.FieldU2("tid")
+			d.FieldBool("layer_sync")
+			d.FieldU5("key_idx")
+		}
+	})
+
+	// marker bit is set on last packet of a frame
+	if start && p.marker {
+		fieldFormatOrRawLen(d, "frame", d.BitsLeft(), rtpPayloadFormats.vp8Frame, nil)
+		return
+	}
+	d.FieldRawLen("payload", d.BitsLeft())
+	if !p.marker {
+		return
+	}
+	if ps := rd.framePackets(p, vp8IsStart); len(ps) > 1 {
+		var frame []byte
+		for _, fp := range ps {
+			n, _, _ := vp8Descriptor(fp.payload)
+			frame = append(frame, fp.payload[n:]...)
+		}
+		fieldFormatOrRawBitBuf(d, "frame", frame, rtpPayloadFormats.vp8Frame, nil)
+	}
+}
+
+// length of VP9 payload descriptor and if it starts or ends a frame, ok is false if truncated
+func vp9Descriptor(pl []byte) (n int, start bool, end bool, ok bool) {
+	next := func() (byte, bool) {
+		if n >= len(pl) {
+			return 0, false
+		}
+		n++
+		return pl[n-1], true
+	}
+	b0, ok := next()
+	if !ok {
+		return 0, false, false, false
+	}
+	start = b0&0x08 != 0
+	end = b0&0x04 != 0
+	flexible := b0&0x10 != 0
+	if b0&0x80 != 0 {
+		b, ok := next()
+		if !ok {
+			return 0, false, false, false
+		}
+		if b&0x80 != 0 {
+			if _, ok := next(); !ok {
+				return 0, false, false, false
+			}
+		}
+	}
+	if b0&0x20 != 0 {
+		if _, ok := next(); !ok {
+			return 0, false, false, false
+		}
+		if !flexible {
+			if _, ok := next(); !ok {
+				return 0, false, false, false
+			}
+		}
+	}
+	if b0&0x40 != 0 && flexible {
+		for i := 0; i < 3; i++ {
+			b, ok := next()
+			if !ok {
+				return 0, false, false, false
+			}
+			if b&0x01 == 0 {
+				break
+			}
+		}
+	}
+	if b0&0x02 != 0 {
+		b, ok := next()
+		if !ok {
+			return 0, false, false, false
+		}
+		if b&0x10 != 0 {
+			n += 4 * int(b>>5+1)
+		}
+		if b&0x08 != 0 {
+			ng, ok := next()
+			if !ok {
+				return 0, false, false, false
+			}
+			for i := 0; i < int(ng); i++ {
+				g, ok := next()
+				if !ok {
+					return 0, false, false, false
+				}
+				n += int(g>>2) & 0x3
+			}
+		}
+	}
+	return n, start, end, n <= len(pl)
+}
+
+func vp9IsStart(payload []byte) bool {
+	_, start, _, ok := vp9Descriptor(payload)
+	return ok && start
+}
+
+func decodeVP9Payload(d *decode.D, rd *rtpDecoder, p rtpPacket) {
+	_, start, end, ok := vp9Descriptor(p.payload)
+	if !ok {
+		d.FieldRawLen("payload", d.BitsLeft())
+		return
+	}
+
+	d.FieldStruct("payload_descriptor", func(d *decode.D) {
+		pictureIDPresent := d.FieldBool("picture_id_present")
+		interPicturePredicted := d.FieldBool("inter_picture_predicted")
+		layerIndicesPresent := d.FieldBool("layer_indices_present")
+		flexibleMode := d.FieldBool("flexible_mode")
+		d.FieldBool("start_of_frame")
+		d.FieldBool("end_of_frame")
+		ssPresent := d.FieldBool("scalability_structure_present")
+		d.FieldBool("not_reference_for_upper_layer")
+		if pictureIDPresent {
+			if d.FieldBool("picture_id_extended") {
+				d.FieldU15("picture_id")
+			} else {
+				d.FieldU7("picture_id")
+			}
+		}
+		if layerIndicesPresent {
+			d.FieldU3("temporal_id")
+			d.FieldBool("switching_up_point")
+			d.FieldU3("spatial_id")
+			d.FieldBool("inter_layer_dependency")
+			if !flexibleMode {
+				d.FieldU8("tl0_pic_idx")
+			}
+		}
+		if interPicturePredicted && flexibleMode {
+			more := true
+			d.FieldArrayLoop("reference_indices", func() bool { return more }, func(d *decode.D) {
+				d.FieldStruct("reference_index", func(d *decode.D) {
+					d.FieldU7("p_diff")
+					more = d.FieldBool("more")
+				})
+			})
+		}
+		if ssPresent {
+			d.FieldStruct("scalability_structure", func(d *decode.D) {
+				spatialLayers := d.FieldU3("spatial_layers", scalar.UAdd(1))
+				resolutionPresent := d.FieldBool("resolution_present")
+				pictureGroupPresent := d.FieldBool("picture_group_present")
+				d.FieldU3("reserved")
+				if resolutionPresent {
+					d.FieldArray("resolutions", func(d *decode.D) {
+						for i := uint64(0); i < spatialLayers; i++ {
+							d.FieldStruct("resolution", func(d *decode.D) {
+								d.FieldU16("width")
+								d.FieldU16("height")
+							})
+						}
+					})
+				}
+				if pictureGroupPresent {
+					pictures := d.FieldU8("pictures")
+					d.FieldArray("picture_group", func(d *decode.D) {
+						for i := uint64(0); i < pictures; i++ {
+							d.FieldStruct("picture", func(d *decode.D) {
+								d.FieldU3("temporal_id")
+								d.FieldBool("switching_up_point")
+								references := d.FieldU2("references")
+								d.FieldU2("reserved")
+								d.FieldArray("p_diffs", func(d *decode.D) {
+									for j := uint64(0); j < references; j++ {
+										d.FieldU8("p_diff")
+									}
+								})
+							})
+						}
+					})
+				}
+			})
+		}
+	})
+
+	// a frame of a spatial layer starts with B and ends with E bit set
+	if start && end {
+		fieldFormatOrRawLen(d, "frame", d.BitsLeft(), rtpPayloadFormats.vp9Frame, nil)
+		return
+	}
+	d.FieldRawLen("payload", d.BitsLeft())
+	if !end {
+		return
+	}
+	if ps := rd.framePackets(p, vp9IsStart); len(ps) > 1 {
+		var frame []byte
+		for _, fp := range ps {
+			n, _, _, _ := vp9Descriptor(fp.payload)
+			frame = append(frame, fp.payload[n:]...)
+		}
+		fieldFormatOrRawBitBuf(d, "frame", frame, rtpPayloadFormats.vp9Frame, nil)
+	}
+}
+
+// AAC-hbr mode, sizeLength=13 indexLength=3 indexDeltaLength=3
+func decodeMPEG4GenericPayload(d *decode.D, _ *rtpDecoder, _ rtpPacket) {
+	if d.BitsLeft() < 16 {
+		d.FieldRawLen("payload", d.BitsLeft())
+		return
+	}
+
+	var sizes []uint64
+	headersLength := d.FieldU16("au_headers_length")
+	if int64(headersLength) > d.BitsLeft() {
+		d.FieldRawLen("payload", d.BitsLeft())
+		return
+	}
+	d.FramedFn(int64(headersLength), func(d *decode.D) {
+		d.FieldArray("au_headers", func(d *decode.D) {
+			for i := 0; d.BitsLeft() >= 16; i++ {
+				d.FieldStruct("au_header", func(d *decode.D) {
+					sizes = append(sizes, d.FieldU13("au_size"))
+					if i == 0 {
+						d.FieldU3("au_index")
+					} else {
+						d.FieldU3("au_index_delta")
+					}
+				})
+			}
+		})
+	})
+	// header section is padded to byte boundary
+	if pad := (8 - int64(headersLength)%8) % 8; pad > 0 {
+		d.FieldRawLen("au_headers_padding", pad)
+	}
+	d.FieldArray("access_units", func(d *decode.D) {
+		for _, s := range sizes {
+			if int64(s)*8 > d.BitsLeft() {
+				// fragmented access unit
+				d.FieldRawLen("fragment", d.BitsLeft())
+				break
+			}
+			fieldFormatOrRawLen(d, "access_unit", int64(s)*8, rtpPayloadFormats.aacFrame, format.AACFrameIn{ObjectType: format.MPEGAudioObjectTypeLC})
+		}
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+}
@@ -5,6 +5,7 @@ package tar
 
 import (
 	"bytes"
+	"embed"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/registry"
@@ -14,12 +15,17 @@ import (
 
 var probeFormat decode.Group
 
+//go:embed *.jq
+var tarFS embed.FS
+
 func init() {
 	registry.MustRegister(decode.Format{
 		Name:        format.TAR,
 		Description: "Tar archive",
 		Groups:      []string{format.PROBE},
 		DecodeFn:    tarDecode,
+		Files:       tarFS,
+		Summary:     "_tar_summary",
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.PROBE}, Group: &probeFormat},
 		},
@@ -0,0 +1,672 @@
+package tls
+
+// https://www.rfc-editor.org/rfc/rfc9000 QUIC
+// https://www.rfc-editor.org/rfc/rfc9001 Using TLS to secure QUIC
+// https://www.rfc-editor.org/rfc/rfc9369 QUIC version 2
+// TODO: handshake, 0-RTT and 1-RTT packets using key log
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+	"golang.org/x/crypto/hkdf"
+)
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.QUIC,
+		Description: "QUIC",
+		Groups:      []string{format.UDP_PAYLOAD},
+		DecodeFn:    decodeQUIC,
+	})
+}
+
+const (
+	quicVersionNegotiation = 0x00000000
+	quicVersion1           = 0x00000001
+	quicVersion2           = 0x6b3343cf
+)
+
+var quicVersionMap = scalar.UToSymStr{
+	quicVersionNegotiation: "version_negotiation",
+	quicVersion1:           "v1",
+	quicVersion2:           "v2",
+}
+
+// initial salt and key derivation label prefix
+var quicVersionInitial = map[uint64]struct {
+	salt        string
+	labelPrefix string
+}{
+	quicVersion1: {salt: "\x38\x76\x2c\xf7\xf5\x59\x34\xb3\x4d\x17\x9a\xe6\xa4\xc8\x0c\xad\xcc\xbb\x7f\x0a", labelPrefix: "quic "},
+	quicVersion2: {salt: "\x0d\xed\xe3\xde\xf7\x00\xa6\xdb\x81\x93\x81\xbe\x6e\x26\x9d\xcb\xf9\xbd\x2e\xd9", labelPrefix: "quicv2 "},
+}
+
+const (
+	quicPacketTypeInitial   = 0
+	quicPacketType0RTT      = 1
+	quicPacketTypeHandshake = 2
+	quicPacketTypeRetry     = 3
+)
+
+var quicLongPacketTypeMap = scalar.UToSymStr{
+	quicPacketTypeInitial:   "initial",
+	quicPacketType0RTT:      "0rtt",
+	quicPacketTypeHandshake: "handshake",
+	quicPacketTypeRetry:     "retry",
+}
+
+// version 2 uses different type bits
+var quicV2LongPacketTypeMap = scalar.UToSymStr{
+	0: "retry",
+	1: "initial",
+	2: "0rtt",
+	3: "handshake",
+}
+
+var quicHeaderFormMap = scalar.UToSymStr{
+	0: "short",
+	1: "long",
+}
+
+const (
+	quicFrameTypePadding          = 0x00
+	quicFrameTypePing             = 0x01
+	quicFrameTypeACK              = 0x02
+	quicFrameTypeACKECN           = 0x03
+	quicFrameTypeCrypto           = 0x06
+	quicFrameTypeConnectionClose  = 0x1c
+	quicFrameTypeConnectionClose2 = 0x1d
+)
+
+var quicFrameTypeMap = scalar.UToSymStr{
+	quicFrameTypePadding:          "padding",
+	quicFrameTypePing:             "ping",
+	quicFrameTypeACK:              "ack",
+	quicFrameTypeACKECN:           "ack_ecn",
+	0x04:                          "reset_stream",
+	0x05:                          "stop_sending",
+	quicFrameTypeCrypto:           "crypto",
+	0x07:                          "new_token",
+	0x08:                          "stream",
+	0x09:                          "stream_fin",
+	0x0a:                          "stream_len",
+	0x0b:                          "stream_len_fin",
+	0x0c:                          "stream_off",
+	0x0d:                          "stream_off_fin",
+	0x0e:                          "stream_off_len",
+	0x0f:                          "stream_off_len_fin",
+	0x10:                          "max_data",
+	0x11:                          "max_stream_data",
+	0x12:                          "max_streams_bidi",
+	0x13:                          "max_streams_uni",
+	0x14:                          "data_blocked",
+	0x15:                          "stream_data_blocked",
+	0x16:                          "streams_blocked_bidi",
+	0x17:                          "streams_blocked_uni",
+	0x18:                          "new_connection_id",
+	0x19:                          "retire_connection_id",
+	0x1a:                          "path_challenge",
+	0x1b:                          "path_response",
+	quicFrameTypeConnectionClose:  "connection_close",
+	quicFrameTypeConnectionClose2: "connection_close_application",
+	0x1e:                          "handshake_done",
+	0x30:                          "datagram",
+	0x31:                          "datagram_len",
+}
+
+var quicTransportErrorMap = scalar.UToSymStr{
+	0x00: "no_error",
+	0x01: "internal_error",
+	0x02: "connection_refused",
+	0x03: "flow_control_error",
+	0x04: "stream_limit_error",
+	0x05: "stream_state_error",
+	0x06: "final_size_error",
+	0x07: "frame_encoding_error",
+	0x08: "transport_parameter_error",
+	0x09: "connection_id_limit_error",
+	0x0a: "protocol_violation",
+	0x0b: "invalid_token",
+	0x0c: "application_error",
+	0x0d: "crypto_buffer_exceeded",
+	0x0e: "key_update_error",
+	0x0f: "aead_limit_reached",
+	0x10: "no_viable_path",
+}
+
+// transport parameters with integer values
+var quicTransportParameterIntegers = map[uint64]bool{
+	0x01: true, 0x03: true, 0x04: true, 0x05: true, 0x06: true, 0x07: true,
+	0x08: true, 0x09: true, 0x0a: true, 0x0b: true, 0x0e: true, 0x20: true,
+}
+
+var quicTransportParameterMap = scalar.UToSymStr{
+	0x00: "original_destination_connection_id",
+	0x01: "max_idle_timeout",
+	0x02: "stateless_reset_token",
+	0x03: "max_udp_payload_size",
+	0x04: "initial_max_data",
+	0x05: "initial_max_stream_data_bidi_local",
+	0x06: "initial_max_stream_data_bidi_remote",
+	0x07: "initial_max_stream_data_uni",
+	0x08: "initial_max_streams_bidi",
+	0x09: "initial_max_streams_uni",
+	0x0a: "ack_delay_exponent",
+	0x0b: "max_ack_delay",
+	0x0c: "disable_active_migration",
+	0x0d: "preferred_address",
+	0x0e: "active_connection_id_limit",
+	0x0f: "initial_source_connection_id",
+	0x10: "retry_source_connection_id",
+	0x11: "version_information",
+	0x20: "max_datagram_frame_size",
+}
+
+// variable-length integer, 2 bit length prefix
+func quicVarInt(d *decode.D) uint64 {
+	n := d.U2()
+	return d.U(6 + 8*((1<<n)-1))
+}
+
+func fieldQUICVarInt(d *decode.D, name string, sms ...scalar.Mapper) uint64 {
+	return d.FieldUFn(name, quicVarInt, sms...)
+}
+
+func fieldQUICTransportParameters(d *decode.D) {
+	d.FieldArray("parameters", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("parameter", func(d *decode.D) {
+				id := fieldQUICVarInt(d, "id", quicTransportParameterMap, scalar.Hex)
+				length := fieldQUICVarInt(d, "length")
+				d.FramedFn(int64(length)*8, func(d *decode.D) {
+					if quicTransportParameterIntegers[id] && length > 0 {
+						fieldQUICVarInt(d, "value")
+						return
+					}
+					d.FieldRawLen("value", d.BitsLeft())
+				})
+			})
+		}
+	})
+}
+
+type quicInitialKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+func newQUICInitialKeys(version uint64, dcid []byte, isServer bool) (quicInitialKeys, error) {
+	vi, ok := quicVersionInitial[version]
+	if !ok {
+		return quicInitialKeys{}, errors.New("unknown version")
+	}
+	initialSecret := hkdf.Extract(sha256.New, dcid, []byte(vi.salt))
+	label := "client in"
+	if isServer {
+		label = "server in"
+	}
+	secret := hkdfExpandLabel(sha256.New, initialSecret, label, 32)
+	aead, err := newAESGCM(hkdfExpandLabel(sha256.New, secret, vi.labelPrefix+"key", 16))
+	if err != nil {
+		return quicInitialKeys{}, err
+	}
+	hp, err := aes.NewCipher(hkdfExpandLabel(sha256.New, secret, vi.labelPrefix+"hp", 16))
+	if err != nil {
+		return quicInitialKeys{}, err
+	}
+	return quicInitialKeys{
+		aead: aead,
+		iv:   hkdfExpandLabel(sha256.New, secret, vi.labelPrefix+"iv", 12),
+		hp:   hp,
+	}, nil
+}
+
+// removes header protection and decrypts a long header packet, returns unprotected
+// first byte and packet number followed by plaintext
+func (k quicInitialKeys) open(pkt []byte, pnOffset int) ([]byte, error) {
+	if len(pkt) < pnOffset+4+aes.BlockSize {
+		return nil, errors.New("packet too short for header protection sample")
+	}
+	mask := make([]byte, aes.BlockSize)
+	k.hp.Encrypt(mask, pkt[pnOffset+4:pnOffset+4+aes.BlockSize])
+
+	header := append([]byte{}, pkt[0:pnOffset]...)
+	header[0] ^= mask[0] & 0x0f
+	pnLen := int(header[0]&0x03) + 1
+	var pn uint64
+	for i := 0; i < pnLen; i++ {
+		b := pkt[pnOffset+i] ^ mask[1+i]
+		header = append(header, b)
+		pn = pn<<8 | uint64(b)
+	}
+
+	nonce := append([]byte{}, k.iv...)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	plain, err := k.aead.Open(nil, nonce, pkt[pnOffset+pnLen:], header)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{header[0]}, header[pnOffset:]...), plain...), nil
+}
+
+type quicCryptoChunk struct {
+	offset int
+	data   []byte
+}
+
+// state for one datagram
+type quicDecoder struct {
+	// original destination connection ids seen in client initial packets, used to derive
+	// initial keys for packets using other connection ids
+	initialDCIDs [][]byte
+	crypto       []quicCryptoChunk
+}
+
+// long header version and destination connection id without decoding
+func quicPeekLongHeader(bs []byte) (version uint64, dcid []byte, ok bool) {
+	if len(bs) < 6 || bs[0]&0x80 == 0 || len(bs) < 6+int(bs[5]) {
+		return 0, nil, false
+	}
+	return uint64(binary.BigEndian.Uint32(bs[1:5])), bs[6 : 6+int(bs[5])], true
+}
+
+func quicLongPacketType(version uint64, typeBits uint64) uint64 {
+	if version == quicVersion2 {
+		return (typeBits + 3) % 4
+	}
+	return typeBits
+}
+
+// variable-length integer from bytes, returns value and length
+func quicReadVarInt(bs []byte) (uint64, int, bool) {
+	if len(bs) == 0 {
+		return 0, 0, false
+	}
+	n := 1 << (bs[0] >> 6)
+	if len(bs) < n {
+		return 0, 0, false
+	}
+	v := uint64(bs[0] & 0x3f)
+	for _, b := range bs[1:n] {
+		v = v<<8 | uint64(b)
+	}
+	return v, n, true
+}
+
+// crypto frames in initial packet plaintext frames without decoding
+func quicCryptoChunks(frames []byte) []quicCryptoChunk {
+	var chunks []quicCryptoChunk
+	varInts := func(n int) bool {
+		for i := 0; i < n; i++ {
+			_, l, ok := quicReadVarInt(frames)
+			if !ok {
+				return false
+			}
+			frames = frames[l:]
+		}
+		return true
+	}
+	for len(frames) > 0 {
+		typ, l, ok := quicReadVarInt(frames)
+		if !ok || l == 0 {
+			return chunks
+		}
+		frames = frames[l:]
+		switch typ {
+		case quicFrameTypePadding, quicFrameTypePing:
+		case quicFrameTypeACK, quicFrameTypeACKECN:
+			if !varInts(2) {
+				return chunks
+			}
+			count, l, ok := quicReadVarInt(frames)
+			if !ok || count > uint64(len(frames)) {
+				return chunks
+			}
+			frames = frames[l:]
+			n := 1 + 2*int(count)
+			if typ == quicFrameTypeACKECN {
+				n += 3
+			}
+			if !varInts(n) {
+				return chunks
+			}
+		case quicFrameTypeCrypto:
+			offset, l, ok := quicReadVarInt(frames)
+			if !ok {
+				return chunks
+			}
+			frames = frames[l:]
+			length, l, ok := quicReadVarInt(frames)
+			if !ok || length > uint64(len(frames)-l) {
+				return chunks
+			}
+			frames = frames[l:]
+			chunks = append(chunks, quicCryptoChunk{offset: int(offset), data: frames[0:length]})
+			frames = frames[length:]
+		default:
+			// connection close ends the connection and other frames are not allowed
+			return chunks
+		}
+	}
+	return chunks
+}
+
+// crypto frames in initial packets of a datagram without decoding, used to reassemble
+// a crypto stream spanning several datagrams
+func (qd *quicDecoder) datagramCryptoChunks(bs []byte) []quicCryptoChunk {
+	var chunks []quicCryptoChunk
+	for {
+		version, dcid, ok := quicPeekLongHeader(bs)
+		if !ok {
+			return chunks
+		}
+		if _, isKnownVersion := quicVersionInitial[version]; !isKnownVersion {
+			return chunks
+		}
+		typ := quicLongPacketType(version, uint64(bs[0]>>4)&0x3)
+		p := 6 + len(dcid)
+		if p >= len(bs) {
+			return chunks
+		}
+		p += 1 + int(bs[p])
+		switch typ {
+		case quicPacketTypeRetry:
+			return chunks
+		case quicPacketTypeInitial:
+			if p > len(bs) {
+				return chunks
+			}
+			tokenLen, l, ok := quicReadVarInt(bs[p:])
+			if !ok || tokenLen > uint64(len(bs)) {
+				return chunks
+			}
+			p += l + int(tokenLen)
+		}
+		if p > len(bs) {
+			return chunks
+		}
+		length, l, ok := quicReadVarInt(bs[p:])
+		if !ok || length > uint64(len(bs)-p-l) {
+			return chunks
+		}
+		pnOffset := p + l
+		pkt := bs[0 : pnOffset+int(length)]
+		if typ == quicPacketTypeInitial {
+			if plain := qd.openInitial(version, dcid, pkt, pnOffset); plain != nil {
+				pnLen := int(plain[0]&0x03) + 1
+				chunks = append(chunks, quicCryptoChunks(plain[1+pnLen:])...)
+			}
+		}
+		bs = bs[len(pkt):]
+	}
+}
+
+// reassembled crypto stream from offset zero up to first gap
+func (qd *quicDecoder) cryptoStream() []byte {
+	sort.SliceStable(qd.crypto, func(i, j int) bool { return qd.crypto[i].offset < qd.crypto[j].offset })
+	var bs []byte
+	for _, c := range qd.crypto {
+		if c.offset > len(bs) {
+			break
+		}
+		if end := c.offset + len(c.data); end > len(bs) {
+			bs = append(bs, c.data[len(bs)-c.offset:]...)
+		}
+	}
+	return bs
+}
+
+func (qd *quicDecoder) decodeFrame(d *decode.D) {
+	typ := fieldQUICVarInt(d, "frame_type", quicFrameTypeMap, scalar.Hex)
+	switch typ {
+	case quicFrameTypePadding:
+		// consecutive padding frames as one
+		bs := d.PeekBytes(int(d.BitsLeft() / 8))
+		n := 0
+		for n < len(bs) && bs[n] == 0 {
+			n++
+		}
+		if n > 0 {
+			d.FieldRawLen("padding", int64(n)*8)
+		}
+	case quicFrameTypePing:
+		// empty
+	case quicFrameTypeACK, quicFrameTypeACKECN:
+		fieldQUICVarInt(d, "largest_acknowledged")
+		fieldQUICVarInt(d, "ack_delay")
+		count := fieldQUICVarInt(d, "ack_range_count")
+		fieldQUICVarInt(d, "first_ack_range")
+		d.FieldArray("ack_ranges", func(d *decode.D) {
+			for i := uint64(0); i < count; i++ {
+				d.FieldStruct("ack_range", func(d *decode.D) {
+					fieldQUICVarInt(d, "gap")
+					fieldQUICVarInt(d, "ack_range_length")
+				})
+			}
+		})
+		if typ == quicFrameTypeACKECN {
+			fieldQUICVarInt(d, "ect0_count")
+			fieldQUICVarInt(d, "ect1_count")
+			fieldQUICVarInt(d, "ecn_ce_count")
+		}
+	case quicFrameTypeCrypto:
+		offset := fieldQUICVarInt(d, "offset")
+		length := fieldQUICVarInt(d, "length")
+		qd.crypto = append(qd.crypto, quicCryptoChunk{
+			offset: int(offset),
+			data:   d.BytesRange(d.Pos(), int(length)),
+		})
+		d.FieldRawLen("data", int64(length)*8)
+	case quicFrameTypeConnectionClose, quicFrameTypeConnectionClose2:
+		if typ == quicFrameTypeConnectionClose {
+			fieldQUICVarInt(d, "error_code", quicTransportErrorMap, scalar.Hex)
+			fieldQUICVarInt(d, "frame_type", quicFrameTypeMap, scalar.Hex)
+		} else {
+			fieldQUICVarInt(d, "error_code", scalar.Hex)
+		}
+		length := fieldQUICVarInt(d, "reason_phrase_length")
+		d.FieldUTF8("reason_phrase", int(length))
+	default:
+		// other frames are not allowed in initial packets
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func (qd *quicDecoder) decodeInitialPlaintext(version uint64) func(d *decode.D) {
+	return func(d *decode.D) {
+		longPacketTypeMap := quicLongPacketTypeMap
+		if version == quicVersion2 {
+			longPacketTypeMap = quicV2LongPacketTypeMap
+		}
+		d.FieldU1("header_form", quicHeaderFormMap)
+		d.FieldU1("fixed_bit")
+		d.FieldU2("long_packet_type", longPacketTypeMap)
+		d.FieldU2("reserved_bits")
+		pnLen := d.FieldU2("packet_number_length", scalar.UAdd(1))
+		d.FieldU("packet_number", int(pnLen)*8)
+		d.FieldArray("frames", func(d *decode.D) {
+			for !d.End() {
+				d.FieldStruct("frame", qd.decodeFrame)
+			}
+		})
+	}
+}
+
+// tries connection id in packet and then original ones for both directions
+func (qd *quicDecoder) openInitial(version uint64, dcid []byte, pkt []byte, pnOffset int) []byte {
+	for _, id := range append([][]byte{dcid}, qd.initialDCIDs...) {
+		for _, isServer := range []bool{false, true} {
+			k, err := newQUICInitialKeys(version, id, isServer)
+			if err != nil {
+				return nil
+			}
+			if plain, err := k.open(pkt, pnOffset); err == nil {
+				return plain
+			}
+		}
+	}
+	return nil
+}
+
+// returns false if packet extends to end of datagram
+func (qd *quicDecoder) decodeLongPacket(d *decode.D) bool {
+	start := d.Pos()
+	version := uint64(binary.BigEndian.Uint32(d.PeekBytes(5)[1:5]))
+	longPacketTypeMap := quicLongPacketTypeMap
+	if version == quicVersion2 {
+		longPacketTypeMap = quicV2LongPacketTypeMap
+	}
+
+	_, isKnownVersion := quicVersionInitial[version]
+
+	d.FieldU1("header_form", quicHeaderFormMap)
+	switch {
+	case version == quicVersionNegotiation:
+		d.FieldU7("unused")
+	case isKnownVersion:
+		d.FieldU1("fixed_bit")
+		d.FieldU2("long_packet_type", longPacketTypeMap)
+		d.FieldU4("type_specific_bits")
+	default:
+		d.FieldU7("version_specific_bits")
+	}
+	d.FieldU32("version", quicVersionMap, scalar.Hex)
+	dcidLen := d.FieldU8("destination_connection_id_length")
+	dcid := d.BytesRange(d.Pos(), int(dcidLen))
+	d.FieldRawLen("destination_connection_id", int64(dcidLen)*8)
+	scidLen := d.FieldU8("source_connection_id_length")
+	d.FieldRawLen("source_connection_id", int64(scidLen)*8)
+
+	if version == quicVersionNegotiation {
+		d.FieldArray("supported_versions", func(d *decode.D) {
+			for d.BitsLeft() >= 32 {
+				d.FieldU32("version", quicVersionMap, scalar.Hex)
+			}
+		})
+		return false
+	}
+	if !isKnownVersion {
+		// only invariant header fields are known
+		d.FieldRawLen("data", d.BitsLeft())
+		return false
+	}
+
+	typ := quicLongPacketType(version, uint64(d.BytesRange(start, 1)[0]>>4)&0x3)
+	switch typ {
+	case quicPacketTypeRetry:
+		d.FieldRawLen("retry_token", d.BitsLeft()-16*8)
+		d.FieldRawLen("retry_integrity_tag", 16*8)
+		return false
+	case quicPacketTypeInitial:
+		tokenLen := fieldQUICVarInt(d, "token_length")
+		d.FieldRawLen("token", int64(tokenLen)*8)
+	}
+
+	length := int64(fieldQUICVarInt(d, "length"))
+	if length*8 > d.BitsLeft() {
+		d.FieldRawLen("protected_payload", d.BitsLeft())
+		return false
+	}
+	pnOffset := int((d.Pos() - start) / 8)
+	d.FieldRawLen("protected_payload", length*8)
+
+	if typ == quicPacketTypeInitial {
+		pkt := d.BytesRange(start, int((d.Pos()-start)/8))
+		if plain := qd.openInitial(version, dcid, pkt, pnOffset); plain != nil {
+			d.FieldStructRootBitBufFn("decrypted", bitio.NewBitReader(plain, -1), qd.decodeInitialPlaintext(version))
+		}
+	}
+
+	return true
+}
+
+func decodeQUICShortPacket(d *decode.D) {
+	d.FieldU1("header_form", quicHeaderFormMap)
+	d.FieldU1("fixed_bit")
+	d.FieldU1("spin_bit")
+	d.FieldU5("protected_bits")
+	// destination connection id length is only known by the endpoints
+	d.FieldRawLen("protected_payload", d.BitsLeft())
+}
+
+func decodeQUIC(d *decode.D, in interface{}) interface{} {
+	qd := &quicDecoder{}
+	upi, isUPI := in.(format.UDPPayloadIn)
+	if isUPI {
+		if upi.SourcePort != format.UDPPortHTTPS && upi.DestinationPort != format.UDPPortHTTPS {
+			d.Fatalf("wrong port")
+		}
+		for _, p := range upi.ClientPayloads {
+			version, dcid, ok := quicPeekLongHeader(p)
+			if ok && quicLongPacketType(version, uint64(p[0]>>4)&0x3) == quicPacketTypeInitial {
+				qd.initialDCIDs = append(qd.initialDCIDs, dcid)
+			}
+		}
+	}
+	bs := d.PeekBytes(int(d.BitsLeft() / 8))
+	version, _, isLong := quicPeekLongHeader(bs)
+	if len(bs) == 0 ||
+		(isLong && version != quicVersionNegotiation && bs[0]&0x40 == 0) ||
+		(!isLong && bs[0]&0xc0 != 0x40) {
+		d.Fatalf("not a QUIC packet")
+	}
+
+	d.FieldArray("packets", func(d *decode.D) {
+		for !d.End() {
+			first := d.PeekBits(8)
+			if first&0x80 == 0 {
+				if first&0x40 == 0 {
+					break
+				}
+				// short header packet extends to end of datagram
+				d.FieldStruct("packet", decodeQUICShortPacket)
+				break
+			}
+			if _, _, ok := quicPeekLongHeader(d.PeekBytes(int(d.BitsLeft() / 8))); !ok {
+				break
+			}
+			more := true
+			d.FieldStruct("packet", func(d *decode.D) { more = qd.decodeLongPacket(d) })
+			if !more {
+				break
+			}
+		}
+	})
+	if !d.End() {
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	// crypto stream can span initial packets in several datagrams, add crypto frames from the
+	// other datagrams in the same direction and decode it in the datagram with its start
+	hasStart := false
+	for _, c := range qd.crypto {
+		hasStart = hasStart || c.offset == 0
+	}
+	if hasStart && isUPI {
+		for i, p := range upi.Payloads {
+			if i != upi.PayloadIndex {
+				qd.crypto = append(qd.crypto, qd.datagramCryptoChunks(p)...)
+			}
+		}
+	}
+
+	if bs := qd.cryptoStream(); len(bs) > 0 {
+		td := &tlsDecoder{quic: true}
+		d.FieldStructRootBitBufFn("crypto_stream", bitio.NewBitReader(bs, -1), td.decodeHandshake)
+	}
+
+	return nil
+}
@@ -0,0 +1,480 @@
+package tls
+
+// https://www.rfc-editor.org/rfc/rfc8446 TLS 1.3
+// https://www.rfc-editor.org/rfc/rfc5246 TLS 1.2
+// TODO: SSLv2 compatible client hello
+// TODO: DTLS
+
+import (
+	"bytes"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var x509CertificateFormat decode.Group
+var applicationDataFormat decode.Group
+
+func init() {
+	registry.MustRegister(decode.Format{
+		Name:        format.TLS,
+		Description: "Transport Layer Security",
+		Groups:      []string{format.TCP_STREAM},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.X509_CERTIFICATE}, Group: &x509CertificateFormat},
+			{Names: []string{format.HTTP, format.HTTP2}, Group: &applicationDataFormat},
+		},
+		DecodeFn: decodeTLS,
+	})
+}
+
+const (
+	recordHeaderLen = 5
+	// plaintext max 2^14 plus expansion
+	recordMaxLen           = 1<<14 + 2048
+	handshakeHeaderLen     = 4
+	helloRetryRequestMagic = "\xcf\x21\xad\x74\xe5\x9a\x61\x11\xbe\x1d\x8c\x02\x1e\x65\xb8\x91\xc2\xa2\x11\x16\x7a\xbb\x8c\x5e\x07\x9e\x09\xe2\xc8\xa8\x33\x9c"
+)
+
+// state for one direction of a connection
+type tlsDecoder struct {
+	// negotiated version and cipher suite, only known in the server direction
+	version     uint64
+	cipherSuite uint64
+	// records are encrypted after change cipher spec or TLS 1.3 server hello
+	encrypted bool
+	// handshake message split into more than one record
+	fragment    bytes.Buffer
+	fragmentLen int
+	// nil if no keys for connection
+	decrypter *recordDecrypter
+	// TLS 1.3 application traffic secret to use after handshake finished
+	trafficSecret   []byte
+	applicationData bytes.Buffer
+	// handshake messages are from a QUIC CRYPTO stream
+	quic bool
+}
+
+func isRecordHeader(bs []byte) bool {
+	if len(bs) < recordHeaderLen {
+		return false
+	}
+	contentType := bs[0]
+	length := int(bs[3])<<8 | int(bs[4])
+	return contentType >= contentTypeChangeCipherSpec && contentType <= contentTypeHeartbeat &&
+		bs[1] == 3 && bs[2] <= 4 &&
+		length <= recordMaxLen
+}
+
+func fieldLengthPrefixedRaw(d *decode.D, name string, lengthBits int, sms ...scalar.Mapper) {
+	l := d.FieldU(name+"_length", lengthBits)
+	d.FieldRawLen(name, int64(l)*8, sms...)
+}
+
+// array of fixed size values prefixed with length in bytes
+func fieldLengthPrefixedArray(d *decode.D, name string, lengthBits int, fn func(d *decode.D)) {
+	l := d.FieldU(name+"_length", lengthBits)
+	d.FramedFn(int64(l)*8, func(d *decode.D) {
+		d.FieldArray(name, func(d *decode.D) {
+			for !d.End() {
+				fn(d)
+			}
+		})
+	})
+}
+
+func fieldVersion(d *decode.D, name string) uint64 {
+	return d.FieldU16(name, versionMap, scalar.Hex)
+}
+
+func fieldRandom(d *decode.D) bool {
+	isHRR := string(d.PeekBytes(32)) == helloRetryRequestMagic
+	if isHRR {
+		d.FieldRawLen("random", 32*8, scalar.Description("HelloRetryRequest"))
+	} else {
+		d.FieldRawLen("random", 32*8)
+	}
+	return isHRR
+}
+
+func (td *tlsDecoder) decodeCertificate(d *decode.D) {
+	// TLS 1.3 has request context before the list and extensions per certificate
+	isTLS13 := int64(d.PeekBits(24))*8 != d.BitsLeft()-24
+	if isTLS13 {
+		fieldLengthPrefixedRaw(d, "certificate_request_context", 8)
+	}
+	fieldLengthPrefixedArray(d, "certificate_list", 24, func(d *decode.D) {
+		d.FieldStruct("entry", func(d *decode.D) {
+			l := int64(d.FieldU24("certificate_length"))
+			if dv, _, _ := d.TryFieldFormatLen("certificate", l*8, x509CertificateFormat, nil); dv == nil {
+				d.FieldRawLen("certificate", l*8)
+			}
+			if isTLS13 {
+				decodeExtensions(d, handshakeTypeCertificate, nil)
+			}
+		})
+	})
+}
+
+func fieldSignature(d *decode.D) {
+	d.FieldU16("signature_algorithm", signatureSchemeMap, scalar.Hex)
+	fieldLengthPrefixedRaw(d, "signature", 16)
+}
+
+func (td *tlsDecoder) decodeServerKeyExchange(d *decode.D) {
+	cs := cipherSuites[td.cipherSuite]
+	switch {
+	case cs.keyExchange == cipherSuiteKeyExchangeECDHE && d.PeekBits(8) == 3:
+		d.FieldU8("curve_type", scalar.UToSymStr{3: "named_curve"})
+		d.FieldU16("named_curve", namedGroupMap, scalar.Hex)
+		fieldLengthPrefixedRaw(d, "public_key", 8)
+	case cs.keyExchange == cipherSuiteKeyExchangeDHE:
+		fieldLengthPrefixedRaw(d, "dh_p", 16)
+		fieldLengthPrefixedRaw(d, "dh_g", 16)
+		fieldLengthPrefixedRaw(d, "dh_ys", 16)
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+		return
+	}
+	if td.version >= versionTLS12 {
+		fieldSignature(d)
+	} else {
+		fieldLengthPrefixedRaw(d, "signature", 16)
+	}
+}
+
+func (td *tlsDecoder) decodeHandshakeMessage(d *decode.D) {
+	typ := d.FieldU8("msg_type", handshakeTypeMap)
+	length := d.FieldU24("length")
+
+	d.FramedFn(int64(length)*8, func(d *decode.D) {
+		switch typ {
+		case handshakeTypeHelloRequest,
+			handshakeTypeServerHelloDone,
+			handshakeTypeEndOfEarlyData:
+			// empty
+		case handshakeTypeClientHello:
+			var h helloInfo
+			h.version = fieldVersion(d, "legacy_version")
+			fieldRandom(d)
+			fieldLengthPrefixedRaw(d, "legacy_session_id", 8)
+			fieldLengthPrefixedArray(d, "cipher_suites", 16, func(d *decode.D) {
+				h.cipherSuites = append(h.cipherSuites, d.FieldU16("cipher_suite", cipherSuiteMap, scalar.Hex))
+			})
+			fieldLengthPrefixedArray(d, "legacy_compression_methods", 8, func(d *decode.D) {
+				d.FieldU8("compression_method", compressionMethodMap)
+			})
+			if !d.End() {
+				decodeExtensions(d, typ, &h)
+			}
+			d.FieldValueStr("ja3_full", h.ja3())
+			d.FieldValueStr("ja3", h.ja3Digest())
+			d.FieldValueStr("ja4", h.ja4(td.quic))
+		case handshakeTypeServerHello:
+			var h helloInfo
+			h.version = fieldVersion(d, "legacy_version")
+			isHRR := fieldRandom(d)
+			fieldLengthPrefixedRaw(d, "legacy_session_id_echo", 8)
+			td.cipherSuite = d.FieldU16("cipher_suite", cipherSuiteMap, scalar.Hex)
+			h.cipherSuites = []uint64{td.cipherSuite}
+			d.FieldU8("legacy_compression_method", compressionMethodMap)
+			msgType := typ
+			if isHRR {
+				// only used to know extension variant
+				msgType = handshakeTypeHelloRetryRequest
+			}
+			if !d.End() {
+				decodeExtensions(d, msgType, &h)
+			}
+			td.version = h.version
+			if h.selectedVersion != 0 {
+				td.version = h.selectedVersion
+			}
+			// rest of TLS 1.3 handshake is encrypted
+			if td.version == versionTLS13 && !isHRR {
+				td.encrypted = true
+			}
+			d.FieldValueStr("ja3s_full", h.ja3s())
+			d.FieldValueStr("ja3s", h.ja3sDigest())
+		case handshakeTypeNewSessionTicket:
+			d.FieldU32("ticket_lifetime")
+			if td.version == versionTLS13 {
+				d.FieldU32("ticket_age_add")
+				fieldLengthPrefixedRaw(d, "ticket_nonce", 8)
+				fieldLengthPrefixedRaw(d, "ticket", 16)
+				decodeExtensions(d, typ, nil)
+			} else {
+				fieldLengthPrefixedRaw(d, "ticket", 16)
+			}
+		case handshakeTypeEncryptedExtensions:
+			decodeExtensions(d, typ, nil)
+		case handshakeTypeCertificate:
+			td.decodeCertificate(d)
+		case handshakeTypeServerKeyExchange:
+			td.decodeServerKeyExchange(d)
+		case handshakeTypeCertificateRequest:
+			if td.version == versionTLS13 {
+				fieldLengthPrefixedRaw(d, "certificate_request_context", 8)
+				decodeExtensions(d, typ, nil)
+				return
+			}
+			fieldLengthPrefixedArray(d, "certificate_types", 8, func(d *decode.D) {
+				d.FieldU8("certificate_type", clientCertificateTypeMap)
+			})
+			if td.version >= versionTLS12 {
+				fieldSignatureAlgorithms(d, nil)
+			}
+			fieldLengthPrefixedArray(d, "certificate_authorities", 16, func(d *decode.D) {
+				d.FieldStruct("certificate_authority", func(d *decode.D) {
+					fieldLengthPrefixedRaw(d, "distinguished_name", 16)
+				})
+			})
+		case handshakeTypeCertificateVerify:
+			fieldSignature(d)
+		case handshakeTypeClientKeyExchange:
+			// key exchange is only known by the server so guess based on length
+			switch {
+			case d.PeekBits(8)*8 == uint64(d.BitsLeft()-8):
+				fieldLengthPrefixedRaw(d, "public_key", 8)
+			case d.BitsLeft() >= 16 && d.PeekBits(16)*8 == uint64(d.BitsLeft()-16):
+				fieldLengthPrefixedRaw(d, "exchange_keys", 16)
+			default:
+				d.FieldRawLen("exchange_keys", d.BitsLeft())
+			}
+		case handshakeTypeFinished:
+			d.FieldRawLen("verify_data", d.BitsLeft())
+			td.handshakeFinished()
+		case handshakeTypeCertificateStatus:
+			d.FieldU8("status_type", certificateStatusTypeMap)
+			fieldLengthPrefixedRaw(d, "response", 24)
+		case handshakeTypeKeyUpdate:
+			d.FieldU8("request_update", keyUpdateRequestMap)
+			td.keyUpdate()
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+// decodes handshake messages in a record, messages can span records
+func (td *tlsDecoder) decodeHandshake(d *decode.D) {
+	d.FieldArray("messages", func(d *decode.D) {
+		for !d.End() {
+			if td.fragment.Len() == 0 && d.BitsLeft() >= handshakeHeaderLen*8 {
+				length := int64(d.PeekBits(32) & 0xff_ff_ff)
+				if (handshakeHeaderLen+length)*8 <= d.BitsLeft() {
+					d.FieldStruct("message", td.decodeHandshakeMessage)
+					continue
+				}
+			}
+
+			n := d.BitsLeft() / 8
+			if td.fragmentLen > 0 && int64(td.fragmentLen-td.fragment.Len()) < n {
+				n = int64(td.fragmentLen - td.fragment.Len())
+			}
+			d.FieldRawLen("fragment", n*8)
+			td.fragment.Write(d.BytesRange(d.Pos()-n*8, int(n)))
+			if td.fragmentLen == 0 && td.fragment.Len() >= handshakeHeaderLen {
+				bs := td.fragment.Bytes()
+				td.fragmentLen = handshakeHeaderLen + (int(bs[1])<<16 | int(bs[2])<<8 | int(bs[3]))
+			}
+			if td.fragmentLen > 0 && td.fragment.Len() >= td.fragmentLen {
+				d.FieldStructRootBitBufFn("message", bitio.NewBitReader(td.fragment.Bytes(), -1), td.decodeHandshakeMessage)
+				td.fragment.Reset()
+				td.fragmentLen = 0
+			}
+		}
+	})
+}
+
+func (td *tlsDecoder) decodeContent(d *decode.D, contentType uint64) {
+	switch contentType {
+	case contentTypeAlert:
+		d.FieldU8("level", alertLevelMap)
+		d.FieldU8("description", alertDescriptionMap)
+	case contentTypeHandshake:
+		td.decodeHandshake(d)
+	case contentTypeApplicationData:
+		td.applicationData.Write(d.BytesRange(d.Pos(), int(d.BitsLeft()/8)))
+		d.FieldRawLen("data", d.BitsLeft())
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func (td *tlsDecoder) decodeDecrypted(d *decode.D, contentType uint64) {
+	if !td.decrypter.tls13 {
+		td.decodeContent(d, contentType)
+		return
+	}
+	// TLSInnerPlaintext is content, real content type and zero padding
+	bs := d.BytesRange(0, int(d.BitsLeft()/8))
+	n := len(bs) - 1
+	for n >= 0 && bs[n] == 0 {
+		n--
+	}
+	if n < 0 {
+		d.FieldRawLen("padding", d.BitsLeft())
+		return
+	}
+	d.FramedFn(int64(n)*8, func(d *decode.D) { td.decodeContent(d, uint64(bs[n])) })
+	d.FieldU8("content_type", contentTypeMap)
+	if !d.End() {
+		d.FieldRawLen("padding", d.BitsLeft())
+	}
+}
+
+func (td *tlsDecoder) decodeRecord(d *decode.D) {
+	header := d.PeekBytes(recordHeaderLen)
+	contentType := d.FieldU8("content_type", contentTypeMap)
+	fieldVersion(d, "version")
+	length := d.FieldU16("length")
+
+	d.FramedFn(int64(length)*8, func(d *decode.D) {
+		switch {
+		case contentType == contentTypeChangeCipherSpec:
+			d.FieldU8("change_cipher_spec")
+			td.encrypted = true
+		case contentType == contentTypeApplicationData,
+			td.encrypted:
+			payload := d.BytesRange(d.Pos(), int(length))
+			d.FieldRawLen("encrypted_data", d.BitsLeft())
+			if td.decrypter == nil {
+				return
+			}
+			// on failure leave as encrypted, ex unknown early data or wrong keys
+			plain, err := td.decrypter.decrypt(header, payload)
+			if err != nil {
+				return
+			}
+			d.FieldStructRootBitBufFn("decrypted", bitio.NewBitReader(plain, -1), func(d *decode.D) {
+				td.decodeDecrypted(d, contentType)
+			})
+		default:
+			td.decodeContent(d, contentType)
+		}
+	})
+}
+
+// setup decryption using key log from tcp stream input or tls_keylog option
+func (td *tlsDecoder) setupDecryption(d *decode.D, tsi format.TCPStreamIn) {
+	kl := keyLog{}
+	parseKeyLog(kl, tsi.TLSKeyLog)
+	if s, ok := d.Options.FormatOptions["tls_keylog"].(string); ok {
+		parseKeyLog(kl, []byte(s))
+	}
+	if len(kl) == 0 {
+		return
+	}
+
+	var own, peer helloParams
+	scanHellos(d.BytesRange(0, int(d.BitsLeft()/8)), &own)
+	scanHellos(tsi.PeerStream, &peer)
+	isClient := own.clientRandom != nil
+	p := own
+	if isClient {
+		p.serverRandom, p.cipherSuite, p.version = peer.serverRandom, peer.cipherSuite, peer.version
+	} else {
+		p.clientRandom = peer.clientRandom
+	}
+	if p.clientRandom == nil || p.serverRandom == nil {
+		return
+	}
+	suite, ok := cipherSuiteAEAD(p.cipherSuite)
+	if !ok {
+		return
+	}
+
+	switch p.version {
+	case versionTLS13:
+		handshakeLabel, trafficLabel := keyLogServerHandshakeTrafficSecret, keyLogServerTrafficSecret0
+		if isClient {
+			handshakeLabel, trafficLabel = keyLogClientHandshakeTrafficSecret, keyLogClientTrafficSecret0
+		}
+		secret := kl.secret(handshakeLabel, p.clientRandom)
+		if secret == nil {
+			return
+		}
+		td.decrypter, _ = newTLS13Decrypter(suite, secret)
+		td.trafficSecret = kl.secret(trafficLabel, p.clientRandom)
+	case versionTLS12:
+		masterSecret := kl.secret(keyLogClientRandom, p.clientRandom)
+		if masterSecret == nil {
+			return
+		}
+		td.decrypter, _ = newTLS12Decrypter(suite, masterSecret, p.clientRandom, p.serverRandom, isClient)
+	}
+}
+
+// TLS 1.3 switches from handshake to application traffic keys after finished
+func (td *tlsDecoder) handshakeFinished() {
+	if td.decrypter == nil || !td.decrypter.tls13 || td.trafficSecret == nil {
+		return
+	}
+	if err := td.decrypter.setSecret(td.trafficSecret); err != nil {
+		td.decrypter = nil
+	}
+	td.trafficSecret = nil
+}
+
+func (td *tlsDecoder) keyUpdate() {
+	if td.decrypter == nil || !td.decrypter.tls13 || td.trafficSecret != nil {
+		return
+	}
+	if err := td.decrypter.keyUpdate(); err != nil {
+		td.decrypter = nil
+	}
+}
+
+func decodeTLS(d *decode.D, in interface{}) interface{} {
+	tsi, ok := in.(format.TCPStreamIn)
+	if !ok {
+		d.Fatalf("no tcp stream input")
+	}
+	if d.BitsLeft() < recordHeaderLen*8 || !isRecordHeader(d.PeekBytes(recordHeaderLen)) {
+		d.Fatalf("no TLS record header")
+	}
+	// without port hint require stream to start with a handshake record
+	isTLSPort := false
+	for _, p := range []int{format.TCPPortHTTPS, format.TCPPortHTTPSAlt} {
+		if tsi.SourcePort == p || tsi.DestinationPort == p {
+			isTLSPort = true
+		}
+	}
+	if !isTLSPort && d.PeekBits(8) != contentTypeHandshake {
+		d.Fatalf("not a TLS handshake record")
+	}
+
+	td := &tlsDecoder{}
+	td.setupDecryption(d, tsi)
+	d.FieldArray("records", func(d *decode.D) {
+		for d.BitsLeft() >= recordHeaderLen*8 {
+			bs := d.PeekBytes(recordHeaderLen)
+			if !isRecordHeader(bs) {
+				break
+			}
+			length := int64(bs[3])<<8 | int64(bs[4])
+			if (recordHeaderLen+length)*8 > d.BitsLeft() {
+				break
+			}
+			d.FieldStruct("record", td.decodeRecord)
+		}
+	})
+	if !d.End() {
+		// truncated record, gap in stream or unknown data
+		d.FieldRawLen("unknown", d.BitsLeft())
+	}
+
+	if td.applicationData.Len() > 0 {
+		bb := bitio.NewBitReader(td.applicationData.Bytes(), -1)
+		dtsi := format.TCPStreamIn{SourcePort: tsi.SourcePort, DestinationPort: tsi.DestinationPort}
+		if dv, _, _ := d.TryFieldFormatBitBuf("application_data", bb, applicationDataFormat, dtsi); dv == nil {
+			d.FieldRootBitBuf("application_data", bb)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,317 @@
+package tls
+
+// https://www.rfc-editor.org/rfc/rfc5246#section-6.3 TLS 1.2 key calculation
+// https://www.rfc-editor.org/rfc/rfc5288 AES-GCM cipher suites
+// https://www.rfc-editor.org/rfc/rfc7905 ChaCha20-Poly1305 cipher suites
+// https://www.rfc-editor.org/rfc/rfc8446#section-7 TLS 1.3 cryptographic computations
+// https://firefox-source-docs.mozilla.org/security/nss/legacy/key_log_format/index.html
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	keyLogClientRandom                 = "CLIENT_RANDOM"
+	keyLogClientHandshakeTrafficSecret = "CLIENT_HANDSHAKE_TRAFFIC_SECRET"
+	keyLogServerHandshakeTrafficSecret = "SERVER_HANDSHAKE_TRAFFIC_SECRET"
+	keyLogClientTrafficSecret0         = "CLIENT_TRAFFIC_SECRET_0"
+	keyLogServerTrafficSecret0         = "SERVER_TRAFFIC_SECRET_0"
+)
+
+// label -> hex client random -> secret
+type keyLog map[string]map[string][]byte
+
+func parseKeyLog(kl keyLog, bs []byte) {
+	s := bufio.NewScanner(bytes.NewReader(bs))
+	for s.Scan() {
+		parts := strings.Fields(s.Text())
+		if len(parts) != 3 || strings.HasPrefix(parts[0], "#") {
+			continue
+		}
+		secret, err := hex.DecodeString(parts[2])
+		if err != nil {
+			continue
+		}
+		label := parts[0]
+		if _, ok := kl[label]; !ok {
+			kl[label] = map[string][]byte{}
+		}
+		kl[label][strings.ToLower(parts[1])] = secret
+	}
+}
+
+func (kl keyLog) secret(label string, clientRandom []byte) []byte {
+	return kl[label][hex.EncodeToString(clientRandom)]
+}
+
+// AEAD algorithm and PRF/HKDF hash for a cipher suite
+type aeadSuite struct {
+	keyLen  int
+	ivLen   int // TLS 1.2 implicit part of nonce, TLS 1.3 always 12
+	newAEAD func(key []byte) (cipher.AEAD, error)
+	hash    func() hash.Hash
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(b)
+}
+
+// figures out AEAD from cipher suite name, ex TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+func cipherSuiteAEAD(cipherSuite uint64) (aeadSuite, bool) {
+	cs, ok := cipherSuites[cipherSuite]
+	if !ok {
+		return aeadSuite{}, false
+	}
+	var s aeadSuite
+	switch {
+	case strings.Contains(cs.name, "_AES_128_GCM_"):
+		s = aeadSuite{keyLen: 16, ivLen: 4, newAEAD: newAESGCM}
+	case strings.Contains(cs.name, "_AES_256_GCM_"):
+		s = aeadSuite{keyLen: 32, ivLen: 4, newAEAD: newAESGCM}
+	case strings.Contains(cs.name, "_CHACHA20_POLY1305_"):
+		s = aeadSuite{keyLen: 32, ivLen: 12, newAEAD: chacha20poly1305.New}
+	default:
+		return aeadSuite{}, false
+	}
+	s.hash = sha256.New
+	if strings.HasSuffix(cs.name, "_SHA384") {
+		s.hash = sha512.New384
+	}
+	return s, true
+}
+
+// P_hash from RFC 5246 section 5
+func prf12(h func() hash.Hash, secret []byte, label string, seed []byte, n int) []byte {
+	labelSeed := append([]byte(label), seed...)
+	mac := hmac.New(h, secret)
+	mac.Write(labelSeed)
+	a := mac.Sum(nil)
+	var out []byte
+	for len(out) < n {
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(labelSeed)
+		out = append(out, mac.Sum(nil)...)
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+	}
+	return out[0:n]
+}
+
+// HKDF-Expand-Label from RFC 8446 section 7.1 with empty context
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, n int) []byte {
+	fullLabel := "tls13 " + label
+	info := []byte{byte(n >> 8), byte(n), byte(len(fullLabel))}
+	info = append(info, fullLabel...)
+	info = append(info, 0)
+	out := make([]byte, n)
+	if _, err := hkdf.Expand(h, secret, info).Read(out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// decrypts records in one direction
+type recordDecrypter struct {
+	suite aeadSuite
+	tls13 bool
+	aead  cipher.AEAD
+	iv    []byte
+	seq   uint64
+	// TLS 1.3 current traffic secret, used for key update
+	secret []byte
+}
+
+func newTLS12Decrypter(suite aeadSuite, masterSecret []byte, clientRandom []byte, serverRandom []byte, isClient bool) (*recordDecrypter, error) {
+	// key_block is client_write_key, server_write_key, client_write_IV, server_write_IV
+	// AEAD suites have no MAC keys
+	n := 2*suite.keyLen + 2*suite.ivLen
+	seed := append(append([]byte{}, serverRandom...), clientRandom...)
+	kb := prf12(suite.hash, masterSecret, "key expansion", seed, n)
+	key := kb[0:suite.keyLen]
+	iv := kb[2*suite.keyLen : 2*suite.keyLen+suite.ivLen]
+	if !isClient {
+		key = kb[suite.keyLen : 2*suite.keyLen]
+		iv = kb[2*suite.keyLen+suite.ivLen : n]
+	}
+	aead, err := suite.newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &recordDecrypter{suite: suite, aead: aead, iv: iv}, nil
+}
+
+func newTLS13Decrypter(suite aeadSuite, secret []byte) (*recordDecrypter, error) {
+	rd := &recordDecrypter{suite: suite, tls13: true}
+	if err := rd.setSecret(secret); err != nil {
+		return nil, err
+	}
+	return rd, nil
+}
+
+func (rd *recordDecrypter) setSecret(secret []byte) error {
+	aead, err := rd.suite.newAEAD(hkdfExpandLabel(rd.suite.hash, secret, "key", rd.suite.keyLen))
+	if err != nil {
+		return err
+	}
+	rd.aead = aead
+	rd.iv = hkdfExpandLabel(rd.suite.hash, secret, "iv", 12)
+	rd.secret = secret
+	rd.seq = 0
+	return nil
+}
+
+func (rd *recordDecrypter) keyUpdate() error {
+	return rd.setSecret(hkdfExpandLabel(rd.suite.hash, rd.secret, "traffic upd", len(rd.secret)))
+}
+
+// iv xor left padded sequence number
+func (rd *recordDecrypter) seqNonce() []byte {
+	nonce := append([]byte{}, rd.iv...)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(rd.seq >> (8 * i))
+	}
+	return nonce
+}
+
+// header is the 5 byte record header, for TLS 1.3 returned plaintext includes inner
+// content type and padding
+func (rd *recordDecrypter) decrypt(header []byte, payload []byte) ([]byte, error) {
+	var nonce, ciphertext, aad []byte
+	switch {
+	case rd.tls13:
+		nonce = rd.seqNonce()
+		ciphertext = payload
+		aad = header
+	default:
+		if len(rd.iv) == 12 {
+			nonce = rd.seqNonce()
+			ciphertext = payload
+		} else {
+			// implicit salt and explicit nonce in record
+			if len(payload) < 8 {
+				return nil, errors.New("record too short")
+			}
+			nonce = append(append([]byte{}, rd.iv...), payload[0:8]...)
+			ciphertext = payload[8:]
+		}
+		plainLen := len(ciphertext) - rd.aead.Overhead()
+		if plainLen < 0 {
+			return nil, errors.New("record too short")
+		}
+		aad = make([]byte, 13)
+		binary.BigEndian.PutUint64(aad[0:8], rd.seq)
+		copy(aad[8:11], header[0:3])
+		binary.BigEndian.PutUint16(aad[11:13], uint16(plainLen))
+	}
+	plain, err := rd.aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, err
+	}
+	rd.seq++
+	return plain, nil
+}
+
+// values needed to derive keys, collected from plaintext hellos
+type helloParams struct {
+	clientRandom []byte
+	serverRandom []byte
+	cipherSuite  uint64
+	version      uint64
+}
+
+// scans plaintext handshake records at start of a stream for client or server hello
+func scanHellos(bs []byte, p *helloParams) {
+	var hs []byte
+	seenHello := false
+	for isRecordHeader(bs) {
+		length := int(bs[3])<<8 | int(bs[4])
+		if recordHeaderLen+length > len(bs) {
+			return
+		}
+		contentType := bs[0]
+		body := bs[recordHeaderLen : recordHeaderLen+length]
+		bs = bs[recordHeaderLen+length:]
+
+		switch {
+		case contentType == contentTypeChangeCipherSpec && !seenHello:
+			// TLS 1.3 compatibility change cipher spec after hello retry request
+			continue
+		case contentType != contentTypeHandshake:
+			return
+		}
+
+		hs = append(hs, body...)
+		for len(hs) >= handshakeHeaderLen {
+			msgLen := int(hs[1])<<16 | int(hs[2])<<8 | int(hs[3])
+			if handshakeHeaderLen+msgLen > len(hs) {
+				break
+			}
+			msgType := hs[0]
+			msg := hs[handshakeHeaderLen : handshakeHeaderLen+msgLen]
+			hs = hs[handshakeHeaderLen+msgLen:]
+			// legacy_version and random
+			if len(msg) < 34 {
+				continue
+			}
+			switch msgType {
+			case handshakeTypeClientHello:
+				p.clientRandom = msg[2:34]
+				seenHello = true
+			case handshakeTypeServerHello:
+				if string(msg[2:34]) == helloRetryRequestMagic {
+					continue
+				}
+				p.serverRandom = msg[2:34]
+				p.version = uint64(binary.BigEndian.Uint16(msg[0:2]))
+				scanServerHello(msg[34:], p)
+				// rest is encrypted for TLS 1.3
+				return
+			}
+		}
+	}
+}
+
+// legacy_session_id_echo, cipher_suite, legacy_compression_method and extensions
+func scanServerHello(bs []byte, p *helloParams) {
+	if len(bs) < 1 || len(bs) < 1+int(bs[0])+3 {
+		return
+	}
+	bs = bs[1+int(bs[0]):]
+	p.cipherSuite = uint64(binary.BigEndian.Uint16(bs[0:2]))
+	bs = bs[3:]
+	if len(bs) < 2 {
+		return
+	}
+	bs = bs[2:]
+	for len(bs) >= 4 {
+		typ := binary.BigEndian.Uint16(bs[0:2])
+		length := int(binary.BigEndian.Uint16(bs[2:4]))
+		if 4+length > len(bs) {
+			return
+		}
+		if typ == extensionSupportedVersions && length == 2 {
+			p.version = uint64(binary.BigEndian.Uint16(bs[4:6]))
+		}
+		bs = bs[4+length:]
+	}
+}
@@ -0,0 +1,171 @@
+package tls
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// hello_retry_request was a handshake type in TLS 1.3 drafts, now a server hello with
+// a special random. Only used internally to know how to decode extensions.
+const handshakeTypeHelloRetryRequest = 6
+
+func fieldSignatureAlgorithms(d *decode.D, h *helloInfo) {
+	fieldLengthPrefixedArray(d, "supported_signature_algorithms", 16, func(d *decode.D) {
+		a := d.FieldU16("signature_algorithm", signatureSchemeMap, scalar.Hex)
+		if h != nil {
+			h.signatureAlgorithms = append(h.signatureAlgorithms, a)
+		}
+	})
+}
+
+func fieldProtocolName(d *decode.D) string {
+	var s string
+	d.FieldStruct("protocol", func(d *decode.D) {
+		l := d.FieldU8("name_length")
+		s = d.FieldUTF8("name", int(l))
+	})
+	return s
+}
+
+func fieldKeyShareEntry(d *decode.D, name string) {
+	d.FieldStruct(name, func(d *decode.D) {
+		d.FieldU16("group", namedGroupMap, scalar.Hex)
+		fieldLengthPrefixedRaw(d, "key_exchange", 16)
+	})
+}
+
+func decodeExtension(d *decode.D, msgType uint64, h *helloInfo) {
+	typ := d.FieldU16("type", extensionTypeMap)
+	length := d.FieldU16("length")
+	if h != nil {
+		h.extensions = append(h.extensions, typ)
+	}
+	if length == 0 {
+		return
+	}
+	isClientHello := msgType == handshakeTypeClientHello
+
+	d.FramedFn(int64(length)*8, func(d *decode.D) {
+		switch typ {
+		case extensionServerName:
+			fieldLengthPrefixedArray(d, "server_name_list", 16, func(d *decode.D) {
+				d.FieldStruct("server_name", func(d *decode.D) {
+					d.FieldU8("name_type", serverNameTypeMap)
+					l := d.FieldU16("host_name_length")
+					d.FieldUTF8("host_name", int(l))
+				})
+			})
+		case extensionApplicationLayerProtocolNegotiation:
+			fieldLengthPrefixedArray(d, "protocol_name_list", 16, func(d *decode.D) {
+				s := fieldProtocolName(d)
+				if h != nil {
+					h.alpn = append(h.alpn, s)
+				}
+			})
+		case extensionSupportedVersions:
+			if isClientHello {
+				fieldLengthPrefixedArray(d, "versions", 8, func(d *decode.D) {
+					v := d.FieldU16("version", greaseMapper{versionMap}, scalar.Hex)
+					if h != nil {
+						h.supportedVersions = append(h.supportedVersions, v)
+					}
+				})
+				return
+			}
+			v := d.FieldU16("selected_version", versionMap, scalar.Hex)
+			if h != nil {
+				h.selectedVersion = v
+			}
+		case extensionKeyShare:
+			switch msgType {
+			case handshakeTypeClientHello:
+				fieldLengthPrefixedArray(d, "client_shares", 16, func(d *decode.D) {
+					fieldKeyShareEntry(d, "key_share_entry")
+				})
+			case handshakeTypeHelloRetryRequest:
+				d.FieldU16("selected_group", namedGroupMap, scalar.Hex)
+			default:
+				fieldKeyShareEntry(d, "server_share")
+			}
+		case extensionSupportedGroups:
+			fieldLengthPrefixedArray(d, "named_group_list", 16, func(d *decode.D) {
+				g := d.FieldU16("named_group", namedGroupMap, scalar.Hex)
+				if h != nil {
+					h.supportedGroups = append(h.supportedGroups, g)
+				}
+			})
+		case extensionECPointFormats:
+			fieldLengthPrefixedArray(d, "ec_point_format_list", 8, func(d *decode.D) {
+				f := d.FieldU8("ec_point_format", ecPointFormatMap)
+				if h != nil {
+					h.ecPointFormats = append(h.ecPointFormats, f)
+				}
+			})
+		case extensionSignatureAlgorithms:
+			fieldSignatureAlgorithms(d, h)
+		case extensionSignatureAlgorithmsCert:
+			fieldSignatureAlgorithms(d, nil)
+		case extensionPSKKeyExchangeModes:
+			fieldLengthPrefixedArray(d, "ke_modes", 8, func(d *decode.D) {
+				d.FieldU8("ke_mode", pskKeyExchangeModeMap)
+			})
+		case extensionStatusRequest:
+			d.FieldU8("status_type", certificateStatusTypeMap)
+			if isClientHello {
+				fieldLengthPrefixedRaw(d, "responder_id_list", 16)
+				fieldLengthPrefixedRaw(d, "request_extensions", 16)
+			} else {
+				fieldLengthPrefixedRaw(d, "response", 24)
+			}
+		case extensionRenegotiationInfo:
+			fieldLengthPrefixedRaw(d, "renegotiated_connection", 8)
+		case extensionRecordSizeLimit:
+			d.FieldU16("record_size_limit")
+		case extensionCompressCertificate:
+			fieldLengthPrefixedArray(d, "algorithms", 8, func(d *decode.D) {
+				d.FieldU16("algorithm", certificateCompressionAlgorithmMap)
+			})
+		case extensionCookie:
+			fieldLengthPrefixedRaw(d, "cookie", 16)
+		case extensionEarlyData:
+			d.FieldU32("max_early_data_size")
+		case extensionPreSharedKey:
+			if !isClientHello {
+				d.FieldU16("selected_identity")
+				return
+			}
+			fieldLengthPrefixedArray(d, "identities", 16, func(d *decode.D) {
+				d.FieldStruct("psk_identity", func(d *decode.D) {
+					fieldLengthPrefixedRaw(d, "identity", 16)
+					d.FieldU32("obfuscated_ticket_age")
+				})
+			})
+			fieldLengthPrefixedArray(d, "binders", 16, func(d *decode.D) {
+				d.FieldStruct("psk_binder_entry", func(d *decode.D) {
+					fieldLengthPrefixedRaw(d, "binder", 8)
+				})
+			})
+		case extensionApplicationSettings:
+			if !isClientHello {
+				d.FieldRawLen("data", d.BitsLeft())
+				return
+			}
+			fieldLengthPrefixedArray(d, "supported_protocols", 16, func(d *decode.D) {
+				fieldProtocolName(d)
+			})
+		case extensionQUICTransportParameters:
+			fieldQUICTransportParameters(d)
+		case extensionPadding:
+			d.FieldRawLen("padding", d.BitsLeft())
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+// h is used to collect values for fingerprints, can be nil
+func decodeExtensions(d *decode.D, msgType uint64, h *helloInfo) {
+	fieldLengthPrefixedArray(d, "extensions", 16, func(d *decode.D) {
+		d.FieldStruct("extension", func(d *decode.D) { decodeExtension(d, msgType, h) })
+	})
+}
@@ -0,0 +1,167 @@
+package tls
+
+// https://github.com/salesforce/ja3
+// https://github.com/FoxIO-LLC/ja4/blob/main/technical_details/JA4.md
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// values collected while decoding a client or server hello
+type helloInfo struct {
+	version             uint64
+	selectedVersion     uint64
+	cipherSuites        []uint64
+	extensions          []uint64
+	supportedVersions   []uint64
+	supportedGroups     []uint64
+	ecPointFormats      []uint64
+	signatureAlgorithms []uint64
+	alpn                []string
+}
+
+func joinNonGREASE(vs []uint64, sep string, fmtFn func(v uint64) string) string {
+	var ss []string
+	for _, v := range vs {
+		if isGREASE(v) {
+			continue
+		}
+		ss = append(ss, fmtFn(v))
+	}
+	return strings.Join(ss, sep)
+}
+
+func decimal(v uint64) string { return strconv.FormatUint(v, 10) }
+func hex4(v uint64) string    { return fmt.Sprintf("%04x", v) }
+
+func (h helloInfo) ja3() string {
+	return strings.Join([]string{
+		decimal(h.version),
+		joinNonGREASE(h.cipherSuites, "-", decimal),
+		joinNonGREASE(h.extensions, "-", decimal),
+		joinNonGREASE(h.supportedGroups, "-", decimal),
+		joinNonGREASE(h.ecPointFormats, "-", decimal),
+	}, ",")
+}
+
+func (h helloInfo) ja3Digest() string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(h.ja3())))
+}
+
+func (h helloInfo) ja3s() string {
+	return strings.Join([]string{
+		decimal(h.version),
+		joinNonGREASE(h.cipherSuites, "-", decimal),
+		joinNonGREASE(h.extensions, "-", decimal),
+	}, ",")
+}
+
+func (h helloInfo) ja3sDigest() string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(h.ja3s())))
+}
+
+func ja4Hash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))[0:12]
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// isQUIC is true if client hello is from a QUIC CRYPTO stream
+func (h helloInfo) ja4(isQUIC bool) string {
+	version := h.version
+	for _, v := range h.supportedVersions {
+		if !isGREASE(v) && v > version {
+			version = v
+		}
+	}
+	versionStr := "00"
+	switch version {
+	case versionTLS13:
+		versionStr = "13"
+	case versionTLS12:
+		versionStr = "12"
+	case versionTLS11:
+		versionStr = "11"
+	case versionTLS10:
+		versionStr = "10"
+	case versionSSL30:
+		versionStr = "s3"
+	}
+
+	sni := "i"
+	var ciphers []string
+	var extensions []string
+	var nExtensions int
+	for _, c := range h.cipherSuites {
+		if !isGREASE(c) {
+			ciphers = append(ciphers, hex4(c))
+		}
+	}
+	for _, e := range h.extensions {
+		if isGREASE(e) {
+			continue
+		}
+		nExtensions++
+		switch e {
+		case extensionServerName:
+			sni = "d"
+		case extensionApplicationLayerProtocolNegotiation:
+		default:
+			extensions = append(extensions, hex4(e))
+		}
+	}
+	sort.Strings(ciphers)
+	sort.Strings(extensions)
+
+	alpn := "00"
+	if len(h.alpn) > 0 && h.alpn[0] != "" {
+		a := h.alpn[0]
+		if isAlphanumeric(a[0]) && isAlphanumeric(a[len(a)-1]) {
+			alpn = a[0:1] + a[len(a)-1:]
+		} else {
+			ah := fmt.Sprintf("%x", a)
+			alpn = ah[0:1] + ah[len(ah)-1:]
+		}
+	}
+
+	min99 := func(n int) int {
+		if n > 99 {
+			return 99
+		}
+		return n
+	}
+
+	extensionsStr := strings.Join(extensions, ",")
+	if len(h.signatureAlgorithms) > 0 {
+		extensionsStr += "_" + joinNonGREASE(h.signatureAlgorithms, ",", hex4)
+	}
+	if len(extensions) == 0 {
+		extensionsStr = ""
+	}
+
+	protocol := "t"
+	if isQUIC {
+		protocol = "q"
+	}
+
+	return fmt.Sprintf("%s%s%s%02d%02d%s_%s_%s",
+		protocol,
+		versionStr,
+		sni,
+		min99(len(ciphers)),
+		min99(nExtensions),
+		alpn,
+		ja4Hash(strings.Join(ciphers, ",")),
+		ja4Hash(extensionsStr),
+	)
+}
@@ -0,0 +1,393 @@
+package tls
+
+// https://www.iana.org/assignments/tls-parameters/tls-parameters.xhtml
+// https://www.iana.org/assignments/tls-extensiontype-values/tls-extensiontype-values.xhtml
+
+import (
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const (
+	versionSSL30 = 0x0300
+	versionTLS10 = 0x0301
+	versionTLS11 = 0x0302
+	versionTLS12 = 0x0303
+	versionTLS13 = 0x0304
+)
+
+var versionMap = scalar.UToSymStr{
+	versionSSL30: "ssl_3_0",
+	versionTLS10: "tls_1_0",
+	versionTLS11: "tls_1_1",
+	versionTLS12: "tls_1_2",
+	versionTLS13: "tls_1_3",
+}
+
+const (
+	contentTypeChangeCipherSpec = 20
+	contentTypeAlert            = 21
+	contentTypeHandshake        = 22
+	contentTypeApplicationData  = 23
+	contentTypeHeartbeat        = 24
+)
+
+var contentTypeMap = scalar.UToSymStr{
+	contentTypeChangeCipherSpec: "change_cipher_spec",
+	contentTypeAlert:            "alert",
+	contentTypeHandshake:        "handshake",
+	contentTypeApplicationData:  "application_data",
+	contentTypeHeartbeat:        "heartbeat",
+}
+
+const (
+	handshakeTypeHelloRequest        = 0
+	handshakeTypeClientHello         = 1
+	handshakeTypeServerHello         = 2
+	handshakeTypeNewSessionTicket    = 4
+	handshakeTypeEndOfEarlyData      = 5
+	handshakeTypeEncryptedExtensions = 8
+	handshakeTypeCertificate         = 11
+	handshakeTypeServerKeyExchange   = 12
+	handshakeTypeCertificateRequest  = 13
+	handshakeTypeServerHelloDone     = 14
+	handshakeTypeCertificateVerify   = 15
+	handshakeTypeClientKeyExchange   = 16
+	handshakeTypeFinished            = 20
+	handshakeTypeCertificateStatus   = 22
+	handshakeTypeKeyUpdate           = 24
+)
+
+var handshakeTypeMap = scalar.UToSymStr{
+	handshakeTypeHelloRequest:        "hello_request",
+	handshakeTypeClientHello:         "client_hello",
+	handshakeTypeServerHello:         "server_hello",
+	handshakeTypeNewSessionTicket:    "new_session_ticket",
+	handshakeTypeEndOfEarlyData:      "end_of_early_data",
+	handshakeTypeEncryptedExtensions: "encrypted_extensions",
+	handshakeTypeCertificate:         "certificate",
+	handshakeTypeServerKeyExchange:   "server_key_exchange",
+	handshakeTypeCertificateRequest:  "certificate_request",
+	handshakeTypeServerHelloDone:     "server_hello_done",
+	handshakeTypeCertificateVerify:   "certificate_verify",
+	handshakeTypeClientKeyExchange:   "client_key_exchange",
+	handshakeTypeFinished:            "finished",
+	handshakeTypeCertificateStatus:   "certificate_status",
+	handshakeTypeKeyUpdate:           "key_update",
+	254:                              "message_hash",
+}
+
+var alertLevelMap = scalar.UToSymStr{
+	1: "warning",
+	2: "fatal",
+}
+
+var alertDescriptionMap = scalar.UToSymStr{
+	0:   "close_notify",
+	10:  "unexpected_message",
+	20:  "bad_record_mac",
+	21:  "decryption_failed",
+	22:  "record_overflow",
+	30:  "decompression_failure",
+	40:  "handshake_failure",
+	41:  "no_certificate",
+	42:  "bad_certificate",
+	43:  "unsupported_certificate",
+	44:  "certificate_revoked",
+	45:  "certificate_expired",
+	46:  "certificate_unknown",
+	47:  "illegal_parameter",
+	48:  "unknown_ca",
+	49:  "access_denied",
+	50:  "decode_error",
+	51:  "decrypt_error",
+	60:  "export_restriction",
+	70:  "protocol_version",
+	71:  "insufficient_security",
+	80:  "internal_error",
+	86:  "inappropriate_fallback",
+	90:  "user_canceled",
+	100: "no_renegotiation",
+	109: "missing_extension",
+	110: "unsupported_extension",
+	111: "certificate_unobtainable",
+	112: "unrecognized_name",
+	113: "bad_certificate_status_response",
+	114: "bad_certificate_hash_value",
+	115: "unknown_psk_identity",
+	116: "certificate_required",
+	120: "no_application_protocol",
+}
+
+const (
+	extensionServerName                          = 0
+	extensionStatusRequest                       = 5
+	extensionSupportedGroups                     = 10
+	extensionECPointFormats                      = 11
+	extensionSignatureAlgorithms                 = 13
+	extensionApplicationLayerProtocolNegotiation = 16
+	extensionPadding                             = 21
+	extensionCompressCertificate                 = 27
+	extensionRecordSizeLimit                     = 28
+	extensionPreSharedKey                        = 41
+	extensionEarlyData                           = 42
+	extensionSupportedVersions                   = 43
+	extensionCookie                              = 44
+	extensionPSKKeyExchangeModes                 = 45
+	extensionSignatureAlgorithmsCert             = 50
+	extensionKeyShare                            = 51
+	extensionQUICTransportParameters             = 57
+	extensionApplicationSettings                 = 17513
+	extensionRenegotiationInfo                   = 65281
+)
+
+var extensionTypeMap = greaseMapper{scalar.UToSymStr{
+	extensionServerName:          "server_name",
+	1:                            "max_fragment_length",
+	extensionStatusRequest:       "status_request",
+	extensionSupportedGroups:     "supported_groups",
+	extensionECPointFormats:      "ec_point_formats",
+	extensionSignatureAlgorithms: "signature_algorithms",
+	14:                           "use_srtp",
+	15:                           "heartbeat",
+	extensionApplicationLayerProtocolNegotiation: "application_layer_protocol_negotiation",
+	18:                               "signed_certificate_timestamp",
+	extensionPadding:                 "padding",
+	22:                               "encrypt_then_mac",
+	23:                               "extended_master_secret",
+	extensionCompressCertificate:     "compress_certificate",
+	extensionRecordSizeLimit:         "record_size_limit",
+	35:                               "session_ticket",
+	extensionPreSharedKey:            "pre_shared_key",
+	extensionEarlyData:               "early_data",
+	extensionSupportedVersions:       "supported_versions",
+	extensionCookie:                  "cookie",
+	extensionPSKKeyExchangeModes:     "psk_key_exchange_modes",
+	47:                               "certificate_authorities",
+	49:                               "post_handshake_auth",
+	extensionSignatureAlgorithmsCert: "signature_algorithms_cert",
+	extensionKeyShare:                "key_share",
+	extensionQUICTransportParameters: "quic_transport_parameters",
+	extensionApplicationSettings:     "application_settings",
+	65037:                            "encrypted_client_hello",
+	extensionRenegotiationInfo:       "renegotiation_info",
+}}
+
+var namedGroupMap = greaseMapper{scalar.UToSymStr{
+	23:     "secp256r1",
+	24:     "secp384r1",
+	25:     "secp521r1",
+	29:     "x25519",
+	30:     "x448",
+	256:    "ffdhe2048",
+	257:    "ffdhe3072",
+	258:    "ffdhe4096",
+	259:    "ffdhe6144",
+	260:    "ffdhe8192",
+	0x11ec: "x25519_mlkem768",
+	0x6399: "x25519_kyber768_draft00",
+}}
+
+var signatureSchemeMap = greaseMapper{scalar.UToSymStr{
+	0x0201: "rsa_pkcs1_sha1",
+	0x0202: "dsa_sha1",
+	0x0203: "ecdsa_sha1",
+	// TLS 1.2 hash and signature algorithm pairs
+	0x0301: "rsa_sha224",
+	0x0302: "dsa_sha224",
+	0x0303: "ecdsa_sha224",
+	0x0402: "dsa_sha256",
+	0x0502: "dsa_sha384",
+	0x0602: "dsa_sha512",
+	0x0401: "rsa_pkcs1_sha256",
+	0x0501: "rsa_pkcs1_sha384",
+	0x0601: "rsa_pkcs1_sha512",
+	0x0403: "ecdsa_secp256r1_sha256",
+	0x0503: "ecdsa_secp384r1_sha384",
+	0x0603: "ecdsa_secp521r1_sha512",
+	0x0804: "rsa_pss_rsae_sha256",
+	0x0805: "rsa_pss_rsae_sha384",
+	0x0806: "rsa_pss_rsae_sha512",
+	0x0807: "ed25519",
+	0x0808: "ed448",
+	0x0809: "rsa_pss_pss_sha256",
+	0x080a: "rsa_pss_pss_sha384",
+	0x080b: "rsa_pss_pss_sha512",
+}}
+
+var ecPointFormatMap = scalar.UToSymStr{
+	0: "uncompressed",
+	1: "ansiX962_compressed_prime",
+	2: "ansiX962_compressed_char2",
+}
+
+var pskKeyExchangeModeMap = scalar.UToSymStr{
+	0: "psk_ke",
+	1: "psk_dhe_ke",
+}
+
+var certificateCompressionAlgorithmMap = scalar.UToSymStr{
+	1: "zlib",
+	2: "brotli",
+	3: "zstd",
+}
+
+var serverNameTypeMap = scalar.UToSymStr{
+	0: "host_name",
+}
+
+var certificateStatusTypeMap = scalar.UToSymStr{
+	1: "ocsp",
+}
+
+var clientCertificateTypeMap = scalar.UToSymStr{
+	1:  "rsa_sign",
+	2:  "dss_sign",
+	3:  "rsa_fixed_dh",
+	4:  "dss_fixed_dh",
+	64: "ecdsa_sign",
+}
+
+var keyUpdateRequestMap = scalar.UToSymStr{
+	0: "update_not_requested",
+	1: "update_requested",
+}
+
+var compressionMethodMap = scalar.UToSymStr{
+	0: "null",
+	1: "deflate",
+}
+
+const (
+	cipherSuiteKeyExchangeUnknown = iota
+	cipherSuiteKeyExchangeRSA
+	cipherSuiteKeyExchangeDHE
+	cipherSuiteKeyExchangeECDHE
+)
+
+type cipherSuite struct {
+	name        string
+	keyExchange int
+}
+
+var cipherSuites = map[uint64]cipherSuite{
+	0x0000: {"TLS_NULL_WITH_NULL_NULL", cipherSuiteKeyExchangeUnknown},
+	0x0001: {"TLS_RSA_WITH_NULL_MD5", cipherSuiteKeyExchangeRSA},
+	0x0002: {"TLS_RSA_WITH_NULL_SHA", cipherSuiteKeyExchangeRSA},
+	0x0003: {"TLS_RSA_EXPORT_WITH_RC4_40_MD5", cipherSuiteKeyExchangeRSA},
+	0x0004: {"TLS_RSA_WITH_RC4_128_MD5", cipherSuiteKeyExchangeRSA},
+	0x0005: {"TLS_RSA_WITH_RC4_128_SHA", cipherSuiteKeyExchangeRSA},
+	0x0006: {"TLS_RSA_EXPORT_WITH_RC2_CBC_40_MD5", cipherSuiteKeyExchangeRSA},
+	0x0007: {"TLS_RSA_WITH_IDEA_CBC_SHA", cipherSuiteKeyExchangeRSA},
+	0x0008: {"TLS_RSA_EXPORT_WITH_DES40_CBC_SHA", cipherSuiteKeyExchangeRSA},
+	0x0009: {"TLS_RSA_WITH_DES_CBC_SHA", cipherSuiteKeyExchangeRSA},
+	0x000a: {"TLS_RSA_WITH_3DES_EDE_CBC_SHA", cipherSuiteKeyExchangeRSA},
+	0x0011: {"TLS_DHE_DSS_EXPORT_WITH_DES40_CBC_SHA", cipherSuiteKeyExchangeDHE},
+	0x0012: {"TLS_DHE_DSS_WITH_DES_CBC_SHA", cipherSuiteKeyExchangeDHE},
+	0x0013: {"TLS_DHE_DSS_WITH_3DES_EDE_CBC_SHA", cipherSuiteKeyExchangeDHE},
+	0x0014: {"TLS_DHE_RSA_EXPORT_WITH_DES40_CBC_SHA", cipherSuiteKeyExchangeDHE},
+	0x0015: {"TLS_DHE_RSA_WITH_DES_CBC_SHA", cipherSuiteKeyExchangeDHE},
+	0x0016: {"TLS_DHE_RSA_WITH_3DES_EDE_CBC_SHA", cipherSuiteKeyExchangeDHE},
+	0x002f: {"TLS_RSA_WITH_AES_128_CBC_SHA", cipherSuiteKeyExchangeRSA},
+	0x0032: {"TLS_DHE_DSS_WITH_AES_128_CBC_SHA", cipherSuiteKeyExchangeDHE},
+	0x0033: {"TLS_DHE_RSA_WITH_AES_128_CBC_SHA", cipherSuiteKeyExchangeDHE},
+	0x0035: {"TLS_RSA_WITH_AES_256_CBC_SHA", cipherSuiteKeyExchangeRSA},
+	0x0038: {"TLS_DHE_DSS_WITH_AES_256_CBC_SHA", cipherSuiteKeyExchangeDHE},
+	0x0039: {"TLS_DHE_RSA_WITH_AES_256_CBC_SHA", cipherSuiteKeyExchangeDHE},
+	0x003c: {"TLS_RSA_WITH_AES_128_CBC_SHA256", cipherSuiteKeyExchangeRSA},
+	0x003d: {"TLS_RSA_WITH_AES_256_CBC_SHA256", cipherSuiteKeyExchangeRSA},
+	0x0040: {"TLS_DHE_DSS_WITH_AES_128_CBC_SHA256", cipherSuiteKeyExchangeDHE},
+	0x0041: {"TLS_RSA_WITH_CAMELLIA_128_CBC_SHA", cipherSuiteKeyExchangeRSA},
+	0x0044: {"TLS_DHE_DSS_WITH_CAMELLIA_128_CBC_SHA", cipherSuiteKeyExchangeDHE},
+	0x0045: {"TLS_DHE_RSA_WITH_CAMELLIA_128_CBC_SHA", cipherSuiteKeyExchangeDHE},
+	0x0067: {"TLS_DHE_RSA_WITH_AES_128_CBC_SHA256", cipherSuiteKeyExchangeDHE},
+	0x006a: {"TLS_DHE_DSS_WITH_AES_256_CBC_SHA256", cipherSuiteKeyExchangeDHE},
+	0x006b: {"TLS_DHE_RSA_WITH_AES_256_CBC_SHA256", cipherSuiteKeyExchangeDHE},
+	0x0084: {"TLS_RSA_WITH_CAMELLIA_256_CBC_SHA", cipherSuiteKeyExchangeRSA},
+	0x0087: {"TLS_DHE_DSS_WITH_CAMELLIA_256_CBC_SHA", cipherSuiteKeyExchangeDHE},
+	0x0088: {"TLS_DHE_RSA_WITH_CAMELLIA_256_CBC_SHA", cipherSuiteKeyExchangeDHE},
+	0x008c: {"TLS_PSK_WITH_AES_128_CBC_SHA", cipherSuiteKeyExchangeUnknown},
+	0x008d: {"TLS_PSK_WITH_AES_256_CBC_SHA", cipherSuiteKeyExchangeUnknown},
+	0x0096: {"TLS_RSA_WITH_SEED_CBC_SHA", cipherSuiteKeyExchangeRSA},
+	0x009c: {"TLS_RSA_WITH_AES_128_GCM_SHA256", cipherSuiteKeyExchangeRSA},
+	0x009d: {"TLS_RSA_WITH_AES_256_GCM_SHA384", cipherSuiteKeyExchangeRSA},
+	0x009e: {"TLS_DHE_RSA_WITH_AES_128_GCM_SHA256", cipherSuiteKeyExchangeDHE},
+	0x009f: {"TLS_DHE_RSA_WITH_AES_256_GCM_SHA384", cipherSuiteKeyExchangeDHE},
+	0x00a2: {"TLS_DHE_DSS_WITH_AES_128_GCM_SHA256", cipherSuiteKeyExchangeDHE},
+	0x00a3: {"TLS_DHE_DSS_WITH_AES_256_GCM_SHA384", cipherSuiteKeyExchangeDHE},
+	0x00ff: {"TLS_EMPTY_RENEGOTIATION_INFO_SCSV", cipherSuiteKeyExchangeUnknown},
+	0x1301: {"TLS_AES_128_GCM_SHA256", cipherSuiteKeyExchangeUnknown},
+	0x1302: {"TLS_AES_256_GCM_SHA384", cipherSuiteKeyExchangeUnknown},
+	0x1303: {"TLS_CHACHA20_POLY1305_SHA256", cipherSuiteKeyExchangeUnknown},
+	0x1304: {"TLS_AES_128_CCM_SHA256", cipherSuiteKeyExchangeUnknown},
+	0x1305: {"TLS_AES_128_CCM_8_SHA256", cipherSuiteKeyExchangeUnknown},
+	0x5600: {"TLS_FALLBACK_SCSV", cipherSuiteKeyExchangeUnknown},
+	0xc001: {"TLS_ECDH_ECDSA_WITH_NULL_SHA", cipherSuiteKeyExchangeUnknown},
+	0xc002: {"TLS_ECDH_ECDSA_WITH_RC4_128_SHA", cipherSuiteKeyExchangeUnknown},
+	0xc003: {"TLS_ECDH_ECDSA_WITH_3DES_EDE_CBC_SHA", cipherSuiteKeyExchangeUnknown},
+	0xc004: {"TLS_ECDH_ECDSA_WITH_AES_128_CBC_SHA", cipherSuiteKeyExchangeUnknown},
+	0xc005: {"TLS_ECDH_ECDSA_WITH_AES_256_CBC_SHA", cipherSuiteKeyExchangeUnknown},
+	0xc006: {"TLS_ECDHE_ECDSA_WITH_NULL_SHA", cipherSuiteKeyExchangeECDHE},
+	0xc007: {"TLS_ECDHE_ECDSA_WITH_RC4_128_SHA", cipherSuiteKeyExchangeECDHE},
+	0xc008: {"TLS_ECDHE_ECDSA_WITH_3DES_EDE_CBC_SHA", cipherSuiteKeyExchangeECDHE},
+	0xc009: {"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA", cipherSuiteKeyExchangeECDHE},
+	0xc00a: {"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA", cipherSuiteKeyExchangeECDHE},
+	0xc00b: {"TLS_ECDH_RSA_WITH_NULL_SHA", cipherSuiteKeyExchangeUnknown},
+	0xc00c: {"TLS_ECDH_RSA_WITH_RC4_128_SHA", cipherSuiteKeyExchangeUnknown},
+	0xc00d: {"TLS_ECDH_RSA_WITH_3DES_EDE_CBC_SHA", cipherSuiteKeyExchangeUnknown},
+	0xc00e: {"TLS_ECDH_RSA_WITH_AES_128_CBC_SHA", cipherSuiteKeyExchangeUnknown},
+	0xc00f: {"TLS_ECDH_RSA_WITH_AES_256_CBC_SHA", cipherSuiteKeyExchangeUnknown},
+	0xc010: {"TLS_ECDHE_RSA_WITH_NULL_SHA", cipherSuiteKeyExchangeECDHE},
+	0xc011: {"TLS_ECDHE_RSA_WITH_RC4_128_SHA", cipherSuiteKeyExchangeECDHE},
+	0xc012: {"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA", cipherSuiteKeyExchangeECDHE},
+	0xc013: {"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA", cipherSuiteKeyExchangeECDHE},
+	0xc014: {"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA", cipherSuiteKeyExchangeECDHE},
+	0xc023: {"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256", cipherSuiteKeyExchangeECDHE},
+	0xc024: {"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA384", cipherSuiteKeyExchangeECDHE},
+	0xc025: {"TLS_ECDH_ECDSA_WITH_AES_128_CBC_SHA256", cipherSuiteKeyExchangeUnknown},
+	0xc026: {"TLS_ECDH_ECDSA_WITH_AES_256_CBC_SHA384", cipherSuiteKeyExchangeUnknown},
+	0xc027: {"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256", cipherSuiteKeyExchangeECDHE},
+	0xc028: {"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA384", cipherSuiteKeyExchangeECDHE},
+	0xc029: {"TLS_ECDH_RSA_WITH_AES_128_CBC_SHA256", cipherSuiteKeyExchangeUnknown},
+	0xc02a: {"TLS_ECDH_RSA_WITH_AES_256_CBC_SHA384", cipherSuiteKeyExchangeUnknown},
+	0xc02b: {"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", cipherSuiteKeyExchangeECDHE},
+	0xc02c: {"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", cipherSuiteKeyExchangeECDHE},
+	0xc02d: {"TLS_ECDH_ECDSA_WITH_AES_128_GCM_SHA256", cipherSuiteKeyExchangeUnknown},
+	0xc02e: {"TLS_ECDH_ECDSA_WITH_AES_256_GCM_SHA384", cipherSuiteKeyExchangeUnknown},
+	0xc02f: {"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", cipherSuiteKeyExchangeECDHE},
+	0xc030: {"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", cipherSuiteKeyExchangeECDHE},
+	0xc031: {"TLS_ECDH_RSA_WITH_AES_128_GCM_SHA256", cipherSuiteKeyExchangeUnknown},
+	0xc032: {"TLS_ECDH_RSA_WITH_AES_256_GCM_SHA384", cipherSuiteKeyExchangeUnknown},
+	0xc09c: {"TLS_RSA_WITH_AES_128_CCM", cipherSuiteKeyExchangeRSA},
+	0xc09d: {"TLS_RSA_WITH_AES_256_CCM", cipherSuiteKeyExchangeRSA},
+	0xc0ac: {"TLS_ECDHE_ECDSA_WITH_AES_128_CCM", cipherSuiteKeyExchangeECDHE},
+	0xc0ad: {"TLS_ECDHE_ECDSA_WITH_AES_256_CCM", cipherSuiteKeyExchangeECDHE},
+	0xc0ae: {"TLS_ECDHE_ECDSA_WITH_AES_128_CCM_8", cipherSuiteKeyExchangeECDHE},
+	0xc0af: {"TLS_ECDHE_ECDSA_WITH_AES_256_CCM_8", cipherSuiteKeyExchangeECDHE},
+	0xcca8: {"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256", cipherSuiteKeyExchangeECDHE},
+	0xcca9: {"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256", cipherSuiteKeyExchangeECDHE},
+	0xccaa: {"TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256", cipherSuiteKeyExchangeDHE},
+}
+
+var cipherSuiteMap = greaseMapper{scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	if cs, ok := cipherSuites[s.ActualU()]; ok {
+		s.Sym = cs.name
+	}
+	return s, nil
+})}
+
+// https://www.rfc-editor.org/rfc/rfc8701 GREASE values are 0x0a0a, 0x1a1a ... 0xfafa
+func isGREASE(v uint64) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+type greaseMapper struct {
+	scalar.Mapper
+}
+
+func (m greaseMapper) MapScalar(s scalar.S) (scalar.S, error) {
+	if isGREASE(s.ActualU()) {
+		s.Sym = "grease"
+		return s, nil
+	}
+	return m.Mapper.MapScalar(s)
+}
@@ -7,6 +7,7 @@ package zip
 import (
 	"bytes"
 	"compress/flate"
+	"embed"
 	"io"
 
 	"github.com/wader/fq/format"
@@ -17,12 +18,17 @@ import (
 
 var probeFormat decode.Group
 
+//go:embed *.jq
+var zipFS embed.FS
+
 func init() {
 	registry.MustRegister(decode.Format{
 		Name:        format.ZIP,
 		Description: "ZIP archive",
 		Groups:      []string{format.PROBE},
 		DecodeFn:    zipDecode,
+		Files:       zipFS,
+		Summary:     "_zip_summary",
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.PROBE}, Group: &probeFormat},
 		},
@@ -10,6 +10,10 @@ require (
 )
 
 require (
+	// bump: gomod-brotli /github\.com\/andybalholm\/brotli v(.*)/ https://github.com/andybalholm/brotli.git|^1
+	// bump: gomod-brotli command go get -d github.com/andybalholm/brotli@v$LATEST && go mod tidy
+	// bump: gomod-brotli link "Source diff $CURRENT..$LATEST" https://github.com/andybalholm/brotli/compare/v$CURRENT..v$LATEST
+	github.com/andybalholm/brotli v1.0.4
 	// bump: gomod-golang-snappy /github.com\/golang\/snappy v(.*)/ https://github.com/golang/snappy.git|^0
 	// bump: gomod-golang-snappy command go get -d github.com/golang/snappy@v$LATEST && go mod tidy
 	// bump: gomod-golang-snappy link "Source diff $CURRENT..$LATEST" https://github.com/golang/snappy/compare/v$CURRENT..v$LATEST
@@ -26,13 +30,22 @@ require (
 	// bump: gomod-go-difflib command go get -d github.com/pmezard/go-difflib@v$LATEST && go mod tidy
 	// bump: gomod-go-difflib link "Source diff $CURRENT..$LATEST" https://github.com/pmezard/go-difflib/compare/v$CURRENT..v$LATEST
 	github.com/pmezard/go-difflib v1.0.0
+	// bump: gomod-golang/crypto /golang\.org\/x\/crypto v(.*)/ https://github.com/golang/crypto.git|^0
+	// bump: gomod-golang/crypto command go get -d golang.org/x/crypto@v$LATEST && go mod tidy
+	// bump: gomod-golang/crypto link "Source diff $CURRENT..$LATEST" https://github.com/golang/crypto/compare/v$CURRENT..v$LATEST
+	golang.org/x/crypto v0.0.0-20220214200702-86341886e292
+	// bump: gomod-golang/image /golang\.org\/x\/image v(.*)/ https://github.com/golang/image.git|^0
+	// bump: gomod-golang/image command go get -d golang.org/x/image@v$LATEST && go mod tidy
+	// bump: gomod-golang/image link "Source diff $CURRENT..$LATEST" https://github.com/golang/image/compare/v$CURRENT..v$LATEST
+	golang.org/x/image v0.0.0-20220302094943-723b81ca9867
+	// bump: gomod-golang/sys /golang\.org\/x\/sys v(.*)/ https://github.com/golang/sys.git|^0
+	// bump: gomod-golang/sys command go get -d golang.org/x/sys@v$LATEST && go mod tidy
+	// bump: gomod-golang/sys link "Source diff $CURRENT..$LATEST" https://github.com/golang/sys/compare/v$CURRENT..v$LATEST
+	golang.org/x/sys v0.0.0-20220227234510-4e6760a101f9
 	// bump: gomod-golang/text /golang\.org\/x\/text v(.*)/ https://github.com/golang/text.git|^0
 	// bump: gomod-golang/text command go get -d golang.org/x/text@v$LATEST && go mod tidy
 	// bump: gomod-golang/text link "Source diff $CURRENT..$LATEST" https://github.com/golang/text/compare/v$CURRENT..v$LATEST
 	golang.org/x/text v0.3.7
 )
 
-require (
-	github.com/itchyny/timefmt-go v0.1.3 // indirect
-	golang.org/x/sys v0.0.0-20220227234510-4e6760a101f9 // indirect
-)
+require github.com/itchyny/timefmt-go v0.1.3 // indirect
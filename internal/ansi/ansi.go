@@ -219,3 +219,36 @@ func Len(s string) int {
 	}
 	return l
 }
+
+// Truncate string to max n visible characters keeping ANSI escape sequences,
+// ends with a reset if any escape sequence was seen
+func Truncate(s string, n int) string {
+	sb := &strings.Builder{}
+	l := 0
+	inANSI := false
+	seenANSI := false
+	for _, c := range s {
+		if inANSI {
+			sb.WriteRune(c)
+			if c == 'm' {
+				inANSI = false
+			}
+		} else {
+			if c == '\x1b' {
+				sb.WriteRune(c)
+				inANSI = true
+				seenANSI = true
+			} else {
+				if l >= n {
+					continue
+				}
+				sb.WriteRune(c)
+				l++
+			}
+		}
+	}
+	if seenANSI {
+		sb.WriteString("\x1b[0m")
+	}
+	return sb.String()
+}
@@ -51,3 +51,25 @@ func TestLen(t *testing.T) {
 		})
 	}
 }
+
+func TestTruncate(t *testing.T) {
+	testCases := []struct {
+		s        string
+		n        int
+		expected string
+	}{
+		{"", 2, ""},
+		{"abc", 2, "ab"},
+		{"abc", 4, "abc"},
+		{"a" + ansi.Red.SetString + "bcd" + ansi.Red.ResetString, 2, "a" + ansi.Red.SetString + "b" + ansi.Red.ResetString + "\x1b[0m"},
+		{"a│b", 2, "a│"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.s, func(t *testing.T) {
+			actual := ansi.Truncate(tC.s, tC.n)
+			if tC.expected != actual {
+				t.Errorf("expected %q, got %q", tC.expected, actual)
+			}
+		})
+	}
+}
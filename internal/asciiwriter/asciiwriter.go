@@ -28,7 +28,7 @@ func New(w io.Writer, width int, startLineOffset int, fn func(v byte) string) *W
 		startLineOffset: startLineOffset,
 		fn:              fn,
 		offset:          0,
-		buf:             make([]byte, width*11+2), // worst case " " or "\n" + width*(c+ansi) + "\n"
+		buf:             make([]byte, width*11+2), // " " or "\n" + width*(c+ansi) + "\n", grows if needed
 		bufOffset:       0,
 	}
 }
@@ -53,14 +53,15 @@ func (h *Writer) Write(p []byte) (n int, err error) {
 	for i := 0; i < len(p); i++ {
 		lineOffset := h.offset % h.width
 
-		s := []byte(h.fn(p[i]))
-		copy(h.buf[h.bufOffset:], s)
+		// fn can return any number of ansi codes so grow buffer if needed
+		s := h.fn(p[i])
+		h.buf = append(h.buf[:h.bufOffset], s...)
 		h.bufOffset += len(s)
 
 		var b []byte
 		switch {
 		case i < len(p)-1 && lineOffset == h.width-1:
-			h.buf[h.bufOffset] = '\n'
+			h.buf = append(h.buf[:h.bufOffset], '\n')
 			h.bufOffset++
 			b = h.buf[:h.bufOffset]
 		case i == len(p)-1:
@@ -0,0 +1,85 @@
+package binwriter
+
+import (
+	"io"
+)
+
+// Writer writes bytes as groups of bits, one group per byte separated by space and
+// width groups per line. Bits outside of the visible bit range are written as space.
+type Writer struct {
+	w               io.Writer
+	width           int
+	startLineOffset int
+	startBit        int64
+	bitLen          int64
+	fn              func(b byte, s string) string
+	offset          int
+	bitOffset       int64
+}
+
+// Bits returns bits of b as a string of "0" and "1", most significant bit first
+func Bits(b byte) string {
+	var s [8]byte
+	for i := 0; i < 8; i++ {
+		s[i] = '0' + (b>>(7-i))&1
+	}
+	return string(s[:])
+}
+
+// New creates a writer that starts at startLineOffset bytes into the first line,
+// startBit is number of bits in first byte before the visible bits and bitLen number
+// of visible bits, fn can be used to color the bits string of a byte
+func New(w io.Writer, width int, startLineOffset int, startBit int64, bitLen int64, fn func(b byte, s string) string) *Writer {
+	return &Writer{
+		w:               w,
+		width:           width,
+		startLineOffset: startLineOffset,
+		startBit:        startBit,
+		bitLen:          bitLen,
+		fn:              fn,
+	}
+}
+
+func (h *Writer) Write(p []byte) (n int, err error) {
+	for h.offset < h.startLineOffset {
+		s := "         "
+		if h.offset%h.width == h.width-1 {
+			s = "        \n"
+		}
+		if _, err := io.WriteString(h.w, s); err != nil {
+			return 0, err
+		}
+		h.offset++
+	}
+
+	for _, b := range p {
+		var s string
+		if h.offset > h.startLineOffset {
+			if h.offset%h.width == 0 {
+				s = "\n"
+			} else {
+				s = " "
+			}
+		}
+
+		var bits [8]byte
+		bs := Bits(b)
+		for i := 0; i < 8; i++ {
+			if p := h.bitOffset + int64(i); p < h.startBit || p >= h.startBit+h.bitLen {
+				bits[i] = ' '
+			} else {
+				bits[i] = bs[i]
+			}
+		}
+		s += h.fn(b, string(bits[:]))
+
+		if _, err := io.WriteString(h.w, s); err != nil {
+			return 0, err
+		}
+
+		h.offset++
+		h.bitOffset += 8
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,24 @@
+package binwriter_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/wader/fq/internal/binwriter"
+)
+
+func TestWrite(t *testing.T) {
+	b := &bytes.Buffer{}
+	// 3 bits into second byte of first line, 11 visible bits
+	h := binwriter.New(b, 2, 1, 3, 11, func(b byte, s string) string { return s })
+	_, _ = h.Write([]byte(""))
+	_, _ = h.Write([]byte{0xff})
+	_, _ = h.Write([]byte{0xaa, 0x0f})
+
+	expected := "" +
+		"         " + "   11111\n" +
+		"101010  " + " " + "        "
+	if expected != b.String() {
+		t.Errorf("expected:\n%q\ngot:\n%q", expected, b.String())
+	}
+}
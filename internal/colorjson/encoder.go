@@ -35,6 +35,7 @@ import (
 	"math/big"
 	"sort"
 	"strconv"
+	"unicode/utf16"
 	"unicode/utf8"
 )
 
@@ -56,18 +57,20 @@ type Encoder struct {
 	color   bool
 	tab     bool
 	indent  int
+	ascii   bool
 	depth   int
 	buf     [64]byte
 	valueFn func(v interface{}) interface{}
 	colors  Colors
 }
 
-func NewEncoder(color bool, tab bool, indent int, valueFn func(v interface{}) interface{}, colors Colors) *Encoder {
+func NewEncoder(color bool, tab bool, indent int, ascii bool, valueFn func(v interface{}) interface{}, colors Colors) *Encoder {
 	// reuse the buffer in multiple calls of marshal
 	return &Encoder{
 		color:   color,
 		tab:     tab,
 		indent:  indent,
+		ascii:   ascii,
 		valueFn: valueFn,
 		colors:  colors,
 	}
@@ -190,6 +193,22 @@ func (e *Encoder) encodeString(s string, color []byte) {
 			start = i
 			continue
 		}
+		// escape non-ASCII as \uXXXX, as UTF-16 surrogate pair if needed
+		if e.ascii {
+			if start < i {
+				e.w.WriteString(s[start:i])
+			}
+			rs := []rune{c}
+			if r1, r2 := utf16.EncodeRune(c); r1 != utf8.RuneError {
+				rs = []rune{r1, r2}
+			}
+			for _, r := range rs {
+				fmt.Fprintf(e.w, `\u%04x`, r)
+			}
+			i += size
+			start = i
+			continue
+		}
 		i += size
 	}
 	if start < len(s) {
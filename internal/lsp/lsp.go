@@ -0,0 +1,333 @@
+// Package lsp implements the base protocol and the subset of types of the language
+// server protocol needed by a simple language server.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+var ErrExitWithoutShutdown = errors.New("exit without shutdown")
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ResponseError) Error() string { return e.Message }
+
+func MethodNotFoundError(method string) error {
+	return &ResponseError{Code: CodeMethodNotFound, Message: "method not found: " + method}
+}
+
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+// Conn reads and writes messages with content length headers
+type Conn struct {
+	r  *bufio.Reader
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{r: bufio.NewReader(r), w: w}
+}
+
+// headers can end with \r\n or just \n, empty lines between messages are skipped
+func (c *Conn) read() (message, error) {
+	contentLength := -1
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) && line == "" && contentLength == -1 {
+				return message{}, io.EOF
+			}
+			return message{}, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if contentLength == -1 {
+				continue
+			}
+			break
+		}
+		i := strings.Index(line, ":")
+		if i == -1 {
+			return message{}, fmt.Errorf("invalid header: %q", line)
+		}
+		name, value := line[0:i], line[i+1:]
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 0 {
+				return message{}, fmt.Errorf("invalid content length: %q", value)
+			}
+			contentLength = n
+		}
+	}
+
+	b := make([]byte, contentLength)
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		return message{}, err
+	}
+	var m message
+	if err := json.Unmarshal(b, &m); err != nil {
+		return message{}, err
+	}
+
+	return m, nil
+}
+
+func (c *Conn) write(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(b), b)
+	return err
+}
+
+func (c *Conn) reply(id *json.RawMessage, result interface{}, err error) error {
+	m := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+	}
+	if err != nil {
+		var re *ResponseError
+		if !errors.As(err, &re) {
+			re = &ResponseError{Code: CodeInternalError, Message: err.Error()}
+		}
+		m["error"] = re
+	} else {
+		m["result"] = result
+	}
+	return c.write(m)
+}
+
+// Notify sends a notification to the client
+func (c *Conn) Notify(method string, params interface{}) error {
+	return c.write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+}
+
+// Handler handles requests and notifications, result is ignored for notifications
+type Handler interface {
+	Handle(ctx context.Context, c *Conn, method string, params json.RawMessage) (interface{}, error)
+}
+
+type HandlerFunc func(ctx context.Context, c *Conn, method string, params json.RawMessage) (interface{}, error)
+
+func (fn HandlerFunc) Handle(ctx context.Context, c *Conn, method string, params json.RawMessage) (interface{}, error) {
+	return fn(ctx, c, method, params)
+}
+
+// Serve reads and handles messages until exit notification or end of input
+// shutdown and exit is handled by Serve
+func Serve(ctx context.Context, c *Conn, h Handler) error {
+	shutdown := false
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		m, err := c.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch {
+		case m.Method == "exit":
+			if !shutdown {
+				return ErrExitWithoutShutdown
+			}
+			return nil
+		case m.Method == "shutdown":
+			shutdown = true
+			if err := c.reply(m.ID, nil, nil); err != nil {
+				return err
+			}
+		case m.ID == nil:
+			// notifications can't be replied to, errors are ignored
+			if !shutdown {
+				_, _ = h.Handle(ctx, c, m.Method, m.Params)
+			}
+		case shutdown:
+			if err := c.reply(m.ID, nil, &ResponseError{Code: CodeInvalidRequest, Message: "server is shutting down"}); err != nil {
+				return err
+			}
+		default:
+			result, err := h.Handle(ctx, c, m.Method, m.Params)
+			if err := c.reply(m.ID, result, err); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+type Position struct {
+	Line int `json:"line"`
+	// Character is in UTF-16 code units
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+const SeverityError = 1
+
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Message  string `json:"message"`
+}
+
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type TextDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+type DidOpenTextDocumentParams struct {
+	TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+// TextDocumentContentChangeEvent only full content changes are supported
+type TextDocumentContentChangeEvent struct {
+	Text string `json:"text"`
+}
+
+type DidChangeTextDocumentParams struct {
+	TextDocument   TextDocumentIdentifier           `json:"textDocument"`
+	ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
+}
+
+type DidCloseTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+const (
+	CompletionItemKindFunction = 3
+	CompletionItemKindVariable = 6
+	CompletionItemKindKeyword  = 14
+)
+
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+func Markdown(s string) *MarkupContent {
+	return &MarkupContent{Kind: "markdown", Value: s}
+}
+
+type CompletionItem struct {
+	Label         string         `json:"label"`
+	Kind          int            `json:"kind,omitempty"`
+	Detail        string         `json:"detail,omitempty"`
+	Documentation *MarkupContent `json:"documentation,omitempty"`
+}
+
+type Hover struct {
+	Contents *MarkupContent `json:"contents"`
+	Range    *Range         `json:"range,omitempty"`
+}
+
+// Offset returns byte offset in text for position
+func Offset(text string, p Position) int {
+	offset := 0
+	for l := 0; l < p.Line; l++ {
+		n := strings.IndexByte(text[offset:], '\n')
+		if n == -1 {
+			return len(text)
+		}
+		offset += n + 1
+	}
+	for c := 0; c < p.Character && offset < len(text) && text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		c += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+	return offset
+}
+
+// PositionAt returns position of byte offset in text
+func PositionAt(text string, offset int) Position {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	lineStart := strings.LastIndexByte(text[0:offset], '\n') + 1
+	return Position{
+		Line:      strings.Count(text[0:lineStart], "\n"),
+		Character: len(utf16.Encode([]rune(text[lineStart:offset]))),
+	}
+}
+
+// PathFromURI returns path for file URI
+func PathFromURI(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("%s: not a file URI", uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+// URIFromPath returns file URI for absolute path
+func URIFromPath(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
@@ -0,0 +1,101 @@
+package lsp_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/wader/fq/internal/lsp"
+)
+
+func TestServe(t *testing.T) {
+	messages := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"echo","params":{"a":1}}`,
+		`{"jsonrpc":"2.0","method":"notify","params":{"b":2}}`,
+		`{"jsonrpc":"2.0","id":"2","method":"missing"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","id":4,"method":"echo"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	}
+	input := &bytes.Buffer{}
+	for i, m := range messages {
+		// mix LF and CRLF headers
+		nl := "\r\n"
+		if i%2 == 0 {
+			nl = "\n"
+		}
+		fmt.Fprintf(input, "Content-Length: %d%s%s%s", len(m), nl, nl, m)
+	}
+	output := &bytes.Buffer{}
+
+	h := lsp.HandlerFunc(func(ctx context.Context, c *lsp.Conn, method string, params json.RawMessage) (interface{}, error) {
+		switch method {
+		case "echo":
+			return params, nil
+		case "notify":
+			return nil, c.Notify("notified", params)
+		default:
+			return nil, lsp.MethodNotFoundError(method)
+		}
+	})
+	if err := lsp.Serve(context.Background(), lsp.NewConn(input, output), h); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`{"id":1,"jsonrpc":"2.0","result":{"a":1}}`,
+		`{"jsonrpc":"2.0","method":"notified","params":{"b":2}}`,
+		`{"error":{"code":-32601,"message":"method not found: missing"},"id":"2","jsonrpc":"2.0"}`,
+		`{"id":3,"jsonrpc":"2.0","result":null}`,
+		`{"error":{"code":-32600,"message":"server is shutting down"},"id":4,"jsonrpc":"2.0"}`,
+	}
+	expectedOutput := ""
+	for _, m := range expected {
+		expectedOutput += fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	if expectedOutput != output.String() {
+		t.Errorf("expected:\n%q\ngot:\n%q", expectedOutput, output.String())
+	}
+}
+
+func TestServeExitWithoutShutdown(t *testing.T) {
+	m := `{"jsonrpc":"2.0","method":"exit"}`
+	input := strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(m), m))
+	h := lsp.HandlerFunc(func(ctx context.Context, c *lsp.Conn, method string, params json.RawMessage) (interface{}, error) {
+		return nil, nil
+	})
+	if err := lsp.Serve(context.Background(), lsp.NewConn(input, &bytes.Buffer{}), h); !errors.Is(err, lsp.ErrExitWithoutShutdown) {
+		t.Errorf("expected exit without shutdown error, got %v", err)
+	}
+}
+
+func TestPosition(t *testing.T) {
+	text := "ab\nå😀c\n"
+	testCases := []struct {
+		offset   int
+		expected lsp.Position
+	}{
+		{0, lsp.Position{Line: 0, Character: 0}},
+		{2, lsp.Position{Line: 0, Character: 2}},
+		{3, lsp.Position{Line: 1, Character: 0}},
+		{5, lsp.Position{Line: 1, Character: 1}},
+		// 😀 is a surrogate pair in UTF-16
+		{9, lsp.Position{Line: 1, Character: 3}},
+		{11, lsp.Position{Line: 2, Character: 0}},
+	}
+	for _, tC := range testCases {
+		t.Run(fmt.Sprintf("%d", tC.offset), func(t *testing.T) {
+			p := lsp.PositionAt(text, tC.offset)
+			if p != tC.expected {
+				t.Errorf("PositionAt: expected %v, got %v", tC.expected, p)
+			}
+			if o := lsp.Offset(text, p); o != tC.offset {
+				t.Errorf("Offset: expected %d, got %d", tC.offset, o)
+			}
+		})
+	}
+}
@@ -186,6 +186,24 @@ func (cr *CaseRun) Readline(opts interp.ReadlineOpts) (string, error) {
 }
 func (cr *CaseRun) History() ([]string, error) { return nil, nil }
 
+type caseCreatedFile struct {
+	bytes.Buffer
+	name string
+	c    *Case
+}
+
+func (f *caseCreatedFile) Close() error {
+	if f.c.created == nil {
+		f.c.created = map[string][]byte{}
+	}
+	f.c.created[f.name] = f.Bytes()
+	return nil
+}
+
+func (cr *CaseRun) Create(name string) (io.WriteCloser, error) {
+	return &caseCreatedFile{name: name, c: cr.Case}, nil
+}
+
 func (cr *CaseRun) ToExpectedStdout() string {
 	sb := &strings.Builder{}
 
@@ -230,6 +248,8 @@ type Case struct {
 	Path   string
 	Parts  []part
 	WasRun bool
+	// files created by runs, kept in memory and readable by later runs
+	created map[string][]byte
 }
 
 func (c *Case) ToActual() string {
@@ -303,6 +323,15 @@ func normalizeOSError(err error) error {
 }
 
 func (c *Case) Open(name string) (fs.File, error) {
+	if data, ok := c.created[name]; ok {
+		return interp.FileReader{
+			R: io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))),
+			FileInfo: interp.FixedFileInfo{
+				FName: filepath.Base(name),
+				FSize: int64(len(data)),
+			},
+		}, nil
+	}
 	for _, p := range c.Parts {
 		f, ok := p.(*caseFile)
 		if ok && f.name == name {
@@ -0,0 +1,306 @@
+// Package termimage renders images inline in a terminal using the kitty graphics
+// protocol, iTerm2 inline images, sixel or unicode half blocks.
+package termimage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"regexp"
+	"strings"
+
+	// register image decoders
+	_ "image/gif"
+	_ "image/jpeg"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	Kitty     = "kitty"
+	ITerm2    = "iterm2"
+	Sixel     = "sixel"
+	HalfBlock = "halfblock"
+)
+
+var Protocols = []string{Kitty, ITerm2, Sixel, HalfBlock}
+
+// most terminals don't report cell size in pixels so assume something common
+const (
+	cellWidth  = 8
+	cellHeight = 16
+)
+
+// kitty graphics protocol payload max chunk size
+const kittyChunkSize = 4096
+
+// Encode decodes image in buf and writes it using protocol scaled down to fit
+// inside cols x rows terminal cells.
+func Encode(w io.Writer, buf []byte, protocol string, cols int, rows int) error {
+	img, imgFormat, err := image.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	if cols < 1 || rows < 1 {
+		return fmt.Errorf("invalid size %dx%d", cols, rows)
+	}
+
+	switch protocol {
+	case Kitty:
+		// kitty only supports PNG and raw pixel data
+		if imgFormat != "png" {
+			if buf, err = toPNG(img); err != nil {
+				return err
+			}
+		}
+		c, r := fitCells(img.Bounds(), cols, rows)
+		return writeKitty(w, buf, c, r)
+	case ITerm2:
+		switch imgFormat {
+		case "png", "jpeg", "gif":
+		default:
+			if buf, err = toPNG(img); err != nil {
+				return err
+			}
+		}
+		c, r := fitCells(img.Bounds(), cols, rows)
+		return writeITerm2(w, buf, c, r)
+	case Sixel:
+		b := img.Bounds()
+		sw, sh := fit(b.Dx(), b.Dy(), cols*cellWidth, rows*cellHeight)
+		return writeSixel(w, scale(img, sw, sh))
+	case HalfBlock:
+		// each cell is two pixels, upper half foreground and lower half background
+		b := img.Bounds()
+		sw, sh := fit(b.Dx(), b.Dy(), cols, rows*2)
+		return writeHalfBlock(w, scale(img, sw, sh))
+	default:
+		return fmt.Errorf("unknown protocol %q, expected one of: %s", protocol, strings.Join(Protocols, ", "))
+	}
+}
+
+// Query is written to a terminal to detect image support. It asks for kitty graphics
+// support, terminal name and version (XTVERSION) and primary device attributes (DA1).
+// Terminals answer in order and all answer DA1 so its response marks the end.
+const Query = "\x1b_Gi=31,s=1,v=1,a=q,t=d,f=24;AAAA\x1b\\" + "\x1b[>q" + "\x1b[c"
+
+var da1Re = regexp.MustCompile(`\x1b\[\?([0-9;]*)c`)
+
+// QueryResponse returns protocol based on terminal response b to Query and true
+// if the response is complete.
+func QueryResponse(b []byte) (string, bool) {
+	m := da1Re.FindSubmatch(b)
+	if m == nil {
+		return "", false
+	}
+	s := string(b)
+	switch {
+	case strings.Contains(s, "\x1b_Gi=31;OK"):
+		return Kitty, true
+	case strings.Contains(s, "\x1bP>|iTerm2"), strings.Contains(s, "\x1bP>|WezTerm"):
+		return ITerm2, true
+	}
+	// attribute 4 is sixel graphics
+	for _, a := range strings.Split(string(m[1]), ";") {
+		if a == "4" {
+			return Sixel, true
+		}
+	}
+	return HalfBlock, true
+}
+
+// fit scales w x h down to fit inside maxW x maxH keeping aspect ratio
+func fit(w, h, maxW, maxH int) (int, int) {
+	if w <= maxW && h <= maxH {
+		return w, h
+	}
+	if w*maxH > h*maxW {
+		h = h * maxW / w
+		w = maxW
+	} else {
+		w = w * maxH / h
+		h = maxH
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+func fitCells(b image.Rectangle, cols, rows int) (int, int) {
+	w, h := fit(b.Dx(), b.Dy(), cols*cellWidth, rows*cellHeight)
+	return (w + cellWidth - 1) / cellWidth, (h + cellHeight - 1) / cellHeight
+}
+
+func scale(img image.Image, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+func toPNG(img image.Image) ([]byte, error) {
+	b := &bytes.Buffer{}
+	if err := png.Encode(b, img); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func writeKitty(w io.Writer, buf []byte, cols, rows int) error {
+	s := base64.StdEncoding.EncodeToString(buf)
+	first := true
+	for first || len(s) > 0 {
+		n := kittyChunkSize
+		if n > len(s) {
+			n = len(s)
+		}
+		more := 0
+		if n < len(s) {
+			more = 1
+		}
+		var ctrl string
+		if first {
+			ctrl = fmt.Sprintf("a=T,f=100,c=%d,r=%d,m=%d", cols, rows, more)
+			first = false
+		} else {
+			ctrl = fmt.Sprintf("m=%d", more)
+		}
+		if _, err := fmt.Fprintf(w, "\x1b_G%s;%s\x1b\\", ctrl, s[0:n]); err != nil {
+			return err
+		}
+		s = s[n:]
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func writeITerm2(w io.Writer, buf []byte, cols, rows int) error {
+	_, err := fmt.Fprintf(w,
+		"\x1b]1337;File=inline=1;size=%d;width=%d;height=%d;preserveAspectRatio=1:%s\a\n",
+		len(buf), cols, rows, base64.StdEncoding.EncodeToString(buf),
+	)
+	return err
+}
+
+// sixelLevels is number of levels per color component in the fixed palette
+const sixelLevels = 6
+
+func sixelIndex(c color.RGBA) int {
+	q := func(v uint8) int { return (int(v)*(sixelLevels-1) + 127) / 255 }
+	return (q(c.R)*sixelLevels+q(c.G))*sixelLevels + q(c.B)
+}
+
+func writeSixel(w io.Writer, img *image.RGBA) error {
+	b := img.Bounds()
+	sb := &strings.Builder{}
+
+	// P2=1 makes pixels not set keep background color, used for transparency
+	fmt.Fprintf(sb, "\x1bP0;1;0q\"1;1;%d;%d", b.Dx(), b.Dy())
+
+	used := map[int]bool{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			if c.A < 128 {
+				continue
+			}
+			used[sixelIndex(c)] = true
+		}
+	}
+	for i := 0; i < sixelLevels*sixelLevels*sixelLevels; i++ {
+		if !used[i] {
+			continue
+		}
+		r := i / (sixelLevels * sixelLevels)
+		g := (i / sixelLevels) % sixelLevels
+		bl := i % sixelLevels
+		p := func(v int) int { return v * 100 / (sixelLevels - 1) }
+		fmt.Fprintf(sb, "#%d;2;%d;%d;%d", i, p(r), p(g), p(bl))
+	}
+
+	writeRun := func(ch byte, n int) {
+		switch {
+		case n > 3:
+			fmt.Fprintf(sb, "!%d%c", n, ch)
+		default:
+			for j := 0; j < n; j++ {
+				sb.WriteByte(ch)
+			}
+		}
+	}
+
+	bandBits := make([]byte, b.Dx())
+	for by := b.Min.Y; by < b.Max.Y; by += 6 {
+		firstColor := true
+		for i := 0; i < sixelLevels*sixelLevels*sixelLevels; i++ {
+			if !used[i] {
+				continue
+			}
+			hasBits := false
+			for x := b.Min.X; x < b.Max.X; x++ {
+				var bits byte
+				for dy := 0; dy < 6 && by+dy < b.Max.Y; dy++ {
+					c := img.RGBAAt(x, by+dy)
+					if c.A >= 128 && sixelIndex(c) == i {
+						bits |= 1 << dy
+					}
+				}
+				bandBits[x-b.Min.X] = bits
+				hasBits = hasBits || bits != 0
+			}
+			if !hasBits {
+				continue
+			}
+			if !firstColor {
+				sb.WriteByte('$')
+			}
+			firstColor = false
+			fmt.Fprintf(sb, "#%d", i)
+
+			runCh, runN := byte(0), 0
+			for _, bits := range bandBits {
+				ch := '?' + bits
+				if ch == runCh {
+					runN++
+					continue
+				}
+				writeRun(runCh, runN)
+				runCh, runN = ch, 1
+			}
+			writeRun(runCh, runN)
+		}
+		sb.WriteByte('-')
+	}
+	sb.WriteString("\x1b\\\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writeHalfBlock(w io.Writer, img *image.RGBA) error {
+	b := img.Bounds()
+	sb := &strings.Builder{}
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			t := img.RGBAAt(x, y)
+			fmt.Fprintf(sb, "\x1b[38;2;%d;%d;%dm", t.R, t.G, t.B)
+			if y+1 < b.Max.Y {
+				l := img.RGBAAt(x, y+1)
+				fmt.Fprintf(sb, "\x1b[48;2;%d;%d;%dm", l.R, l.G, l.B)
+			}
+			sb.WriteString("▀")
+		}
+		sb.WriteString("\x1b[0m\n")
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
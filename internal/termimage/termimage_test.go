@@ -0,0 +1,78 @@
+package termimage_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/wader/fq/internal/termimage"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	b := &bytes.Buffer{}
+	if err := png.Encode(b, img); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestEncode(t *testing.T) {
+	testCases := []struct {
+		protocol string
+		w, h     int
+		cols     int
+		rows     int
+		expected string
+	}{
+		{termimage.HalfBlock, 1, 2, 10, 10, "\x1b[38;2;255;0;0m\x1b[48;2;255;0;0m▀\x1b[0m\n"},
+		{termimage.HalfBlock, 1, 1, 10, 10, "\x1b[38;2;255;0;0m▀\x1b[0m\n"},
+		// scaled down to 1x2
+		{termimage.HalfBlock, 10, 20, 1, 1, "\x1b[38;2;255;0;0m\x1b[48;2;255;0;0m▀\x1b[0m\n"},
+		{termimage.Sixel, 5, 1, 10, 10, "\x1bP0;1;0q\"1;1;5;1#180;2;100;0;0#180!5@-\x1b\\\n"},
+	}
+	for _, tC := range testCases {
+		tC := tC
+		t.Run(tC.protocol, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			if err := termimage.Encode(b, testPNG(t, tC.w, tC.h), tC.protocol, tC.cols, tC.rows); err != nil {
+				t.Fatal(err)
+			}
+			actual := b.String()
+			if tC.expected != actual {
+				t.Errorf("expected %q, got %q", tC.expected, actual)
+			}
+		})
+	}
+}
+
+func TestQueryResponse(t *testing.T) {
+	testCases := []struct {
+		response         string
+		expectedProtocol string
+		expectedOk       bool
+	}{
+		{"", "", false},
+		{"\x1b_Gi=31;OK\x1b\\", "", false},
+		{"\x1b_Gi=31;OK\x1b\\\x1bP>|kitty(0.26.5)\x1b\\\x1b[?62;c", termimage.Kitty, true},
+		{"\x1bP>|iTerm2 3.4.19\x1b\\\x1b[?62;4c", termimage.ITerm2, true},
+		{"\x1bP>|foot(1.13.1)\x1b\\\x1b[?62;4;22c", termimage.Sixel, true},
+		{"\x1b[?1;2c", termimage.HalfBlock, true},
+	}
+	for _, tC := range testCases {
+		tC := tC
+		t.Run(tC.response, func(t *testing.T) {
+			actualProtocol, actualOk := termimage.QueryResponse([]byte(tC.response))
+			if tC.expectedProtocol != actualProtocol || tC.expectedOk != actualOk {
+				t.Errorf("expected %q %v, got %q %v", tC.expectedProtocol, tC.expectedOk, actualProtocol, actualOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,352 @@
+// Package termplot renders line charts, bar charts and histograms using unicode
+// braille and block characters.
+package termplot
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/internal/ansi"
+)
+
+const (
+	Line      = "line"
+	Bar       = "bar"
+	Histogram = "histogram"
+)
+
+var Types = []string{Line, Bar, Histogram}
+
+type Point struct {
+	X float64
+	Y float64
+}
+
+type Options struct {
+	Type string
+	// Width and Height is total size in cells including axis and labels
+	Width  int
+	Height int
+	// Bins is number of histogram bins, zero means one per column
+	Bins      int
+	PlotColor ansi.Code
+	AxisColor ansi.Code
+}
+
+// eighth blocks used for bars, index is number of eighths filled
+var blocks = []rune{' ', '▁', '▂', '▃', '▄', '▅', '▆', '▇', '█'}
+
+// braille dot bit for a 2x4 cell, indexed by [y][x]
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+const brailleBase = 0x2800
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'g', 6, 64)
+}
+
+type canvas struct {
+	yLabels [3]string
+	xLabels [2]string
+	cols    int
+	rows    int
+	cells   [][]rune
+}
+
+func newCanvas(cols, rows int) *canvas {
+	c := &canvas{cols: cols, rows: rows, cells: make([][]rune, rows)}
+	for i := range c.cells {
+		c.cells[i] = []rune(strings.Repeat(" ", cols))
+	}
+	return c
+}
+
+func (c *canvas) labelWidth() int {
+	labelW := 0
+	for _, l := range c.yLabels {
+		if len(l) > labelW {
+			labelW = len(l)
+		}
+	}
+	return labelW
+}
+
+func (c *canvas) write(w io.Writer, labelW int, opts Options) error {
+	sb := &strings.Builder{}
+	for r := 0; r < c.rows; r++ {
+		label := ""
+		switch r {
+		case 0:
+			label = c.yLabels[0]
+		case c.rows / 2:
+			label = c.yLabels[1]
+		case c.rows - 1:
+			label = c.yLabels[2]
+		}
+		fmt.Fprintf(sb, "%s%s",
+			opts.AxisColor.Wrap(fmt.Sprintf("%*s", labelW, label)),
+			opts.AxisColor.Wrap("│"),
+		)
+		sb.WriteString(opts.PlotColor.Wrap(string(c.cells[r])))
+		sb.WriteString("\n")
+	}
+	sb.WriteString(opts.AxisColor.Wrap(strings.Repeat(" ", labelW) + "└" + strings.Repeat("─", c.cols)))
+	sb.WriteString("\n")
+	xl := c.xLabels[0]
+	xr := c.xLabels[1]
+	pad := c.cols - len(xl) - len(xr)
+	if pad < 1 {
+		pad = 1
+	}
+	sb.WriteString(opts.AxisColor.Wrap(strings.Repeat(" ", labelW+1) + xl + strings.Repeat(" ", pad) + xr))
+	sb.WriteString("\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func bounds(points []Point) (minX, maxX, minY, maxY float64) {
+	minX, maxX = math.Inf(1), math.Inf(-1)
+	minY, maxY = math.Inf(1), math.Inf(-1)
+	for _, p := range points {
+		minX = math.Min(minX, p.X)
+		maxX = math.Max(maxX, p.X)
+		minY = math.Min(minY, p.Y)
+		maxY = math.Max(maxY, p.Y)
+	}
+	return minX, maxX, minY, maxY
+}
+
+// Plot writes a chart of points to w
+func Plot(w io.Writer, points []Point, opts Options) error {
+	if len(points) == 0 {
+		return fmt.Errorf("nothing to plot")
+	}
+	for _, p := range points {
+		if math.IsNaN(p.X) || math.IsInf(p.X, 0) || math.IsNaN(p.Y) || math.IsInf(p.Y, 0) {
+			return fmt.Errorf("can't plot non-finite number")
+		}
+	}
+
+	// y label width depends on the plotted values so plot once to find out and
+	// redo if labels ended up wider than guessed
+	labelW := 1
+	for {
+		cols := opts.Width - labelW - 1
+		rows := opts.Height - 2
+		if cols < 1 || rows < 1 {
+			return fmt.Errorf("size %dx%d too small", opts.Width, opts.Height)
+		}
+
+		var c *canvas
+		switch opts.Type {
+		case Line:
+			c = plotLine(points, cols, rows)
+		case Bar:
+			c = plotBars(points, cols, rows)
+		case Histogram:
+			var err error
+			if c, err = plotHistogram(points, cols, rows, opts.Bins); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown type %q, expected one of: %s", opts.Type, strings.Join(Types, ", "))
+		}
+
+		if lw := c.labelWidth(); lw > labelW {
+			labelW = lw
+			continue
+		}
+
+		return c.write(w, labelW, opts)
+	}
+}
+
+func setYLabels(c *canvas, minY, maxY float64) {
+	c.yLabels = [3]string{
+		formatNumber(maxY),
+		formatNumber(minY + (maxY-minY)/2),
+		formatNumber(minY),
+	}
+}
+
+func plotLine(points []Point, cols, rows int) *canvas {
+	sorted := make([]Point, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].X < sorted[j].X })
+
+	minX, maxX, minY, maxY := bounds(sorted)
+	c := newCanvas(cols, rows)
+	setYLabels(c, minY, maxY)
+	c.xLabels = [2]string{formatNumber(minX), formatNumber(maxX)}
+
+	dotsW := cols * 2
+	dotsH := rows * 4
+	toDot := func(p Point) (int, int) {
+		x, y := 0, dotsH-1
+		if maxX > minX {
+			x = int(math.Round((p.X - minX) / (maxX - minX) * float64(dotsW-1)))
+		}
+		if maxY > minY {
+			y = int(math.Round((maxY - p.Y) / (maxY - minY) * float64(dotsH-1)))
+		}
+		return x, y
+	}
+	set := func(x, y int) {
+		c.cells[y/4][x/2] |= brailleBase | brailleDots[y%4][x%2]
+	}
+
+	for i := range c.cells {
+		for j := range c.cells[i] {
+			c.cells[i][j] = brailleBase
+		}
+	}
+
+	px, py := toDot(sorted[0])
+	set(px, py)
+	for _, p := range sorted[1:] {
+		x, y := toDot(p)
+		// bresenham line between previous and current dot
+		dx, dy := abs(x-px), -abs(y-py)
+		sx, sy := sign(x-px), sign(y-py)
+		e := dx + dy
+		for {
+			set(px, py)
+			if px == x && py == y {
+				break
+			}
+			e2 := 2 * e
+			if e2 >= dy {
+				e += dy
+				px += sx
+			}
+			if e2 <= dx {
+				e += dx
+				py += sy
+			}
+		}
+	}
+
+	// empty braille cell looks like a space but keep output clean
+	for i := range c.cells {
+		for j := range c.cells[i] {
+			if c.cells[i][j] == brailleBase {
+				c.cells[i][j] = ' '
+			}
+		}
+	}
+
+	return c
+}
+
+// fill columns with bars scaled from zero, or min value if negative, to max value
+func fillBars(c *canvas, values []float64) {
+	minY, maxY := 0.0, math.Inf(-1)
+	for _, v := range values {
+		minY = math.Min(minY, v)
+		maxY = math.Max(maxY, v)
+	}
+	setYLabels(c, minY, maxY)
+
+	eighths := c.rows * 8
+	for col := 0; col < c.cols; col++ {
+		i := col * len(values) / c.cols
+		h := 0
+		if maxY > minY {
+			h = int(math.Round((values[i] - minY) / (maxY - minY) * float64(eighths)))
+		}
+		for r := c.rows - 1; r >= 0 && h > 0; r-- {
+			n := h
+			if n > 8 {
+				n = 8
+			}
+			c.cells[r][col] = blocks[n]
+			h -= n
+		}
+	}
+}
+
+func plotBars(points []Point, cols, rows int) *canvas {
+	if len(points) < cols {
+		// use whole columns per bar
+		cols = (cols / len(points)) * len(points)
+	} else {
+		// more points than columns, use max of points sharing a column
+		reduced := make([]Point, cols)
+		for i := range reduced {
+			reduced[i].Y = math.Inf(-1)
+		}
+		for i, p := range points {
+			j := i * cols / len(points)
+			reduced[j].X = p.X
+			reduced[j].Y = math.Max(reduced[j].Y, p.Y)
+		}
+		points = reduced
+	}
+
+	c := newCanvas(cols, rows)
+	c.xLabels = [2]string{formatNumber(points[0].X), formatNumber(points[len(points)-1].X)}
+	values := make([]float64, len(points))
+	for i, p := range points {
+		values[i] = p.Y
+	}
+	fillBars(c, values)
+
+	return c
+}
+
+func plotHistogram(points []Point, cols, rows int, bins int) (*canvas, error) {
+	if bins < 0 {
+		return nil, fmt.Errorf("bins must be positive")
+	}
+	if bins == 0 || bins > cols {
+		bins = cols
+	}
+	cols = (cols / bins) * bins
+
+	_, _, minY, maxY := bounds(points)
+	counts := make([]float64, bins)
+	for _, p := range points {
+		i := 0
+		if maxY > minY {
+			i = int((p.Y - minY) / (maxY - minY) * float64(bins))
+		}
+		if i >= bins {
+			i = bins - 1
+		}
+		counts[i]++
+	}
+
+	c := newCanvas(cols, rows)
+	c.xLabels = [2]string{formatNumber(minY), formatNumber(maxY)}
+	fillBars(c, counts)
+
+	return c, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
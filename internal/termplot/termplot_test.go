@@ -0,0 +1,46 @@
+package termplot_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/wader/fq/internal/termplot"
+)
+
+func TestPlot(t *testing.T) {
+	testCases := []struct {
+		opts     termplot.Options
+		points   []termplot.Point
+		expected string
+	}{
+		{
+			opts:   termplot.Options{Type: termplot.Bar, Width: 6, Height: 3},
+			points: []termplot.Point{{X: 0, Y: 1}, {X: 1, Y: 2}},
+			expected: "" +
+				"2│▄▄██\n" +
+				" └────\n" +
+				"  0  1\n",
+		},
+		{
+			opts:   termplot.Options{Type: termplot.Line, Width: 6, Height: 3},
+			points: []termplot.Point{{X: 0, Y: 0}, {X: 1, Y: 1}},
+			expected: "" +
+				"  1│⡠⠊\n" +
+				"   └──\n" +
+				"    0 1\n",
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+		t.Run(tC.opts.Type, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			if err := termplot.Plot(b, tC.points, tC.opts); err != nil {
+				t.Fatal(err)
+			}
+			actual := b.String()
+			if tC.expected != actual {
+				t.Errorf("expected %q, got %q", tC.expected, actual)
+			}
+		})
+	}
+}
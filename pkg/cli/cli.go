@@ -9,10 +9,14 @@ import (
 	"io/fs"
 	"log"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"sync"
+	"time"
 
+	"github.com/wader/fq/internal/termimage"
 	"github.com/wader/fq/pkg/interp"
 	"github.com/wader/fq/pkg/registry"
 
@@ -35,9 +39,11 @@ func (a autoCompleterFn) Do(line []rune, pos int) (newLine [][]rune, length int)
 }
 
 type stdOS struct {
-	rl            *readline.Instance
-	closeChan     chan struct{}
-	interruptChan chan struct{}
+	rl                *readline.Instance
+	closeChan         chan struct{}
+	interruptChan     chan struct{}
+	imageProtocolOnce sync.Once
+	imageProtocol     string
 }
 
 func newStandardOS() *stdOS {
@@ -76,7 +82,7 @@ func newStandardOS() *stdOS {
 	}
 }
 
-func (stdOS) Platform() interp.Platform {
+func (*stdOS) Platform() interp.Platform {
 	return interp.Platform{
 		OS:   runtime.GOOS,
 		Arch: runtime.GOARCH,
@@ -92,6 +98,13 @@ func (fd fdTerminal) Size() (int, int) {
 func (fd fdTerminal) IsTerminal() bool {
 	return readline.IsTerminal(int(fd))
 }
+func (fd fdTerminal) RawMode() (func() error, error) {
+	state, err := readline.MakeRaw(int(fd))
+	if err != nil {
+		return nil, err
+	}
+	return func() error { return readline.Restore(int(fd), state) }, nil
+}
 
 type stdinInput struct {
 	fdTerminal
@@ -126,10 +139,64 @@ func (o stdoutOutput) Write(p []byte) (n int, err error) {
 	return os.Stdout.Write(p)
 }
 
+func (o stdoutOutput) ImageProtocol() string {
+	if !o.IsTerminal() {
+		return ""
+	}
+	o.os.imageProtocolOnce.Do(func() { o.os.imageProtocol = queryImageProtocol() })
+	return o.os.imageProtocol
+}
+
 func (o *stdOS) Stdout() interp.Output {
 	return stdoutOutput{fdTerminal: fdTerminal(os.Stdout.Fd()), os: o}
 }
 
+// should be enough also over ssh
+const terminalQueryTimeout = 500 * time.Millisecond
+
+// queryImageProtocol asks the terminal using /dev/tty so that it works even if stdin is
+// redirected, returns "" if the terminal could not be queried, ex: on windows or if
+// the terminal did not answer in time
+func queryImageProtocol() string {
+	f, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	// use raw conn to not make file blocking which would break read deadline
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return ""
+	}
+	var state *readline.State
+	var rawErr error
+	if err := rc.Control(func(fd uintptr) { state, rawErr = readline.MakeRaw(int(fd)) }); err != nil || rawErr != nil {
+		return ""
+	}
+	defer func() { _ = rc.Control(func(fd uintptr) { _ = readline.Restore(int(fd), state) }) }()
+
+	if err := f.SetReadDeadline(time.Now().Add(terminalQueryTimeout)); err != nil {
+		return ""
+	}
+	if _, err := io.WriteString(f, termimage.Query); err != nil {
+		return ""
+	}
+
+	var b []byte
+	buf := make([]byte, 256)
+	for {
+		n, err := f.Read(buf)
+		b = append(b, buf[0:n]...)
+		if p, ok := termimage.QueryResponse(b); ok {
+			return p
+		}
+		if err != nil {
+			return ""
+		}
+	}
+}
+
 type stderrOutput struct {
 	fdTerminal
 }
@@ -222,6 +289,45 @@ func (o *stdOS) History() ([]string, error) {
 	return hs, nil
 }
 
+func (o *stdOS) Create(name string) (io.WriteCloser, error) {
+	return os.Create(name)
+}
+
+type pagerCmd struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (p pagerCmd) Close() error {
+	_ = p.WriteCloser.Close()
+	return p.cmd.Wait()
+}
+
+func (o *stdOS) Pager(command string) (io.WriteCloser, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/c", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	// same as git, make less pass thru colors and not clear screen
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return pagerCmd{WriteCloser: w, cmd: cmd}, nil
+}
+
 func (o *stdOS) Close() error {
 	// only close if is terminal otherwise ansi reset will write
 	// to stdout and mess up raw output
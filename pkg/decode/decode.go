@@ -34,6 +34,10 @@ type Options struct {
 	FillGaps      bool
 	IsRoot        bool
 	Range         ranges.Range // if zero use whole buffer
+	// FormatOptions are the options given to the root decode and are on purpose inherited
+	// by all nested decodes so that ex a pcap decode can pass rtp_ports or tls_keylog to
+	// formats deep down in the tree. Format input specific to a nested decode should
+	// be passed using FormatInArg.
 	FormatOptions map[string]interface{}
 	FormatInArg   interface{}
 	ReadBuf       *[]byte
@@ -912,12 +916,13 @@ func (d *D) RangeFn(firstBit int64, nBits int64, fn func(d *D)) int64 {
 
 func (d *D) Format(group Group, inArg interface{}) interface{} {
 	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Force:       d.Options.Force,
-		FillGaps:    false,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: d.Pos(), Len: d.BitsLeft()},
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
+		Force:         d.Options.Force,
+		FillGaps:      false,
+		IsRoot:        false,
+		Range:         ranges.Range{Start: d.Pos(), Len: d.BitsLeft()},
+		FormatInArg:   inArg,
+		ReadBuf:       d.readBuf,
+		FormatOptions: d.Options.FormatOptions,
 	})
 	if dv == nil || dv.Errors() != nil {
 		d.IOPanic(err, "Format: decode")
@@ -941,13 +946,14 @@ func (d *D) Format(group Group, inArg interface{}) interface{} {
 
 func (d *D) TryFieldFormat(name string, group Group, inArg interface{}) (*Value, interface{}, error) {
 	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    false,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: d.Pos(), Len: d.BitsLeft()},
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
+		Name:          name,
+		Force:         d.Options.Force,
+		FillGaps:      false,
+		IsRoot:        false,
+		Range:         ranges.Range{Start: d.Pos(), Len: d.BitsLeft()},
+		FormatInArg:   inArg,
+		ReadBuf:       d.readBuf,
+		FormatOptions: d.Options.FormatOptions,
 	})
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
@@ -971,13 +977,14 @@ func (d *D) FieldFormat(name string, group Group, inArg interface{}) (*Value, in
 
 func (d *D) TryFieldFormatLen(name string, nBits int64, group Group, inArg interface{}) (*Value, interface{}, error) {
 	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    true,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: d.Pos(), Len: nBits},
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
+		Name:          name,
+		Force:         d.Options.Force,
+		FillGaps:      true,
+		IsRoot:        false,
+		Range:         ranges.Range{Start: d.Pos(), Len: nBits},
+		FormatInArg:   inArg,
+		ReadBuf:       d.readBuf,
+		FormatOptions: d.Options.FormatOptions,
 	})
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
@@ -1002,13 +1009,14 @@ func (d *D) FieldFormatLen(name string, nBits int64, group Group, inArg interfac
 // TODO: return decooder?
 func (d *D) TryFieldFormatRange(name string, firstBit int64, nBits int64, group Group, inArg interface{}) (*Value, interface{}, error) {
 	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    true,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: firstBit, Len: nBits},
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
+		Name:          name,
+		Force:         d.Options.Force,
+		FillGaps:      true,
+		IsRoot:        false,
+		Range:         ranges.Range{Start: firstBit, Len: nBits},
+		FormatInArg:   inArg,
+		ReadBuf:       d.readBuf,
+		FormatOptions: d.Options.FormatOptions,
 	})
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
@@ -1030,12 +1038,13 @@ func (d *D) FieldFormatRange(name string, firstBit int64, nBits int64, group Gro
 
 func (d *D) TryFieldFormatBitBuf(name string, br bitio.ReaderAtSeeker, group Group, inArg interface{}) (*Value, interface{}, error) {
 	dv, v, err := decode(d.Ctx, br, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    true,
-		IsRoot:      true,
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
+		Name:          name,
+		Force:         d.Options.Force,
+		FillGaps:      true,
+		IsRoot:        true,
+		FormatInArg:   inArg,
+		ReadBuf:       d.readBuf,
+		FormatOptions: d.Options.FormatOptions,
 	})
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
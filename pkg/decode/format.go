@@ -20,6 +20,7 @@ type Format struct {
 	Dependencies []Dependency
 	Files        fs.ReadDirFS
 	ToRepr       string
+	Summary      string
 }
 
 func FormatFn(d func(d *D, in interface{}) interface{}) Group {
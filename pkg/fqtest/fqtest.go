@@ -13,10 +13,20 @@ import (
 	"github.com/wader/fq/pkg/registry"
 )
 
+type Options struct {
+	Pattern string
+	// ActualFn is optional and can be used to normalize actual output
+	ActualFn func(s string) string
+}
+
 func TestPath(t *testing.T, registry *registry.Registry) {
+	TestPathWithOptions(t, registry, Options{Pattern: "*.fqtest"})
+}
+
+func TestPathWithOptions(t *testing.T, registry *registry.Registry, opts Options) {
 	difftest.TestWithOptions(t, difftest.Options{
 		Path:        ".",
-		Pattern:     "*.fqtest",
+		Pattern:     opts.Pattern,
 		ColorDiff:   os.Getenv("DIFF_COLOR") != "",
 		WriteOutput: os.Getenv("WRITE_ACTUAL") != "",
 		Fn: func(t *testing.T, path, input string) (string, string, error) {
@@ -50,7 +60,12 @@ func TestPath(t *testing.T, registry *registry.Registry) {
 				})
 			}
 
-			return path, c.ToActual(), nil
+			actual := c.ToActual()
+			if opts.ActualFn != nil {
+				actual = opts.ActualFn(actual)
+			}
+
+			return path, actual, nil
 		},
 	})
 }
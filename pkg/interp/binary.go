@@ -25,6 +25,9 @@ func init() {
 		return []Function{
 			{"_tobits", 3, 3, i._toBits, nil},
 			{"open", 0, 0, nil, i._open},
+			{"_binary_indices", 1, 1, i._binaryIndices, nil},
+			{"_explode_binary", 0, 0, i._explodeBinary, nil},
+			{"_implode_binary", 0, 0, i._implodeBinary, nil},
 		}
 	})
 }
@@ -174,6 +177,88 @@ func (of *openFile) ToBinary() (Binary, error) {
 	return newBinaryFromBitReader(of.br, 8, 0)
 }
 
+// byte offsets of all, possibly overlapping, occurrences of bytes in binary, same as
+// jq indices for strings
+func (i *Interp) _binaryIndices(c interface{}, a []interface{}) interface{} {
+	cBuf, err := toBytes(c)
+	if err != nil {
+		return err
+	}
+	xBuf, err := toBytes(a[0])
+	if err != nil {
+		return err
+	}
+
+	vs := []interface{}{}
+	if len(xBuf) == 0 {
+		return vs
+	}
+	for o := 0; ; {
+		n := bytes.Index(cBuf[o:], xBuf)
+		if n == -1 {
+			break
+		}
+		vs = append(vs, o+n)
+		o += n + 1
+	}
+
+	return vs
+}
+
+var _ Value = binaryUnits{}
+
+// binaryUnits is an array of units from exploding a binary, it remembers the unit
+// size so that implode can create a binary instead of an UTF-8 string
+type binaryUnits struct {
+	gojqextra.Array
+	unit int
+}
+
+func (binaryUnits) ExtType() string   { return "binary_units" }
+func (binaryUnits) ExtKeys() []string { return nil }
+
+func (i *Interp) _explodeBinary(c interface{}, a []interface{}) interface{} {
+	bv, err := toBinary(c)
+	if err != nil {
+		return err
+	}
+
+	l := bv.JQValueLength().(int)
+	vs := make(gojqextra.Array, l)
+	for j := 0; j < l; j++ {
+		v := bv.JQValueIndex(j)
+		if err, ok := v.(error); ok {
+			return err
+		}
+		vs[j] = v
+	}
+
+	return binaryUnits{Array: vs, unit: bv.unit}
+}
+
+func (i *Interp) _implodeBinary(c interface{}, a []interface{}) interface{} {
+	bu, ok := c.(binaryUnits)
+	if !ok {
+		return gojqextra.FuncTypeError{Name: "_implode_binary", V: c}
+	}
+
+	nBits := int64(len(bu.Array) * bu.unit)
+	buf := make([]byte, (nBits+7)/8)
+	for j, v := range bu.Array {
+		n, ok := gojqextra.ToInt(v)
+		if !ok || n < 0 || (bu.unit < 64 && n >= 1<<bu.unit) {
+			return fmt.Errorf("can't implode %v as %d bit unit", v, bu.unit)
+		}
+		bitio.Write64(uint64(n), int64(bu.unit), buf, int64(j*bu.unit))
+	}
+
+	bb, err := newBinaryFromBitReader(bitio.NewBitReader(buf, nBits), bu.unit, 0)
+	if err != nil {
+		return err
+	}
+	return bb
+}
+
 // opens a file for reading from filesystem
 // TODO: when to close? when br loses all refs? need to use finalizer somehow?
 func (i *Interp) _open(c interface{}, a []interface{}) gojq.Iter {
@@ -187,6 +272,9 @@ func (i *Interp) _open(c interface{}, a []interface{}) gojq.Iter {
 
 	switch c.(type) {
 	case nil:
+		if err := i.allow(CapabilityOpen, ""); err != nil {
+			return gojq.NewIter(err)
+		}
 		path = "<stdin>"
 		f = i.os.Stdin()
 	default:
@@ -194,6 +282,9 @@ func (i *Interp) _open(c interface{}, a []interface{}) gojq.Iter {
 		if err != nil {
 			return gojq.NewIter(fmt.Errorf("%s: %w", path, err))
 		}
+		if err := i.allow(CapabilityOpen, path); err != nil {
+			return gojq.NewIter(err)
+		}
 		f, err = i.os.FS().Open(path)
 		if err != nil {
 			// path context added in jq error code
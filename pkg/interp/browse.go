@@ -0,0 +1,724 @@
+package interp
+
+// TODO: search
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/wader/fq/internal/ansi"
+	"github.com/wader/fq/internal/asciiwriter"
+	"github.com/wader/fq/internal/binwriter"
+	"github.com/wader/fq/internal/bitioextra"
+	"github.com/wader/fq/internal/columnwriter"
+	"github.com/wader/fq/internal/hexpairwriter"
+	"github.com/wader/fq/internal/ioextra"
+	"github.com/wader/fq/internal/mathextra"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/gojq"
+)
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"_browse", 1, 1, nil, i._browse},
+		}
+	})
+}
+
+const (
+	browseKeyUp = iota + 0x100
+	browseKeyDown
+	browseKeyLeft
+	browseKeyRight
+	browseKeyPageUp
+	browseKeyPageDown
+	browseKeyHome
+	browseKeyEnd
+	browseKeyEscape
+)
+
+const browseHelp = "q quit  ↑↓ move  ←→ collapse/expand  n/p sibling  g offset  r format root  / filter  b bits/hex"
+
+// how often to check terminal size while waiting for input
+const browseResizeInterval = 100 * time.Millisecond
+
+// parse key presses from a chunk read from a raw terminal, a chunk can include
+// multiple keys and escape sequences
+func browseKeys(b []byte) []int {
+	var keys []int
+	for len(b) > 0 {
+		if b[0] != 0x1b {
+			r, size := utf8.DecodeRune(b)
+			keys = append(keys, int(r))
+			b = b[size:]
+			continue
+		}
+
+		// ESC [ params final or ESC O final
+		if len(b) >= 3 && (b[1] == '[' || b[1] == 'O') {
+			end := 2
+			for end < len(b) && (b[end] >= '0' && b[end] <= '9' || b[end] == ';') {
+				end++
+			}
+			if end < len(b) {
+				key := -1
+				switch string(b[2 : end+1]) {
+				case "A":
+					key = browseKeyUp
+				case "B":
+					key = browseKeyDown
+				case "C":
+					key = browseKeyRight
+				case "D":
+					key = browseKeyLeft
+				case "5~":
+					key = browseKeyPageUp
+				case "6~":
+					key = browseKeyPageDown
+				case "H", "1~", "7~":
+					key = browseKeyHome
+				case "F", "4~", "8~":
+					key = browseKeyEnd
+				}
+				if key != -1 {
+					keys = append(keys, key)
+				}
+				b = b[end+1:]
+				continue
+			}
+		}
+
+		keys = append(keys, browseKeyEscape)
+		b = b[1:]
+	}
+	return keys
+}
+
+type browseRow struct {
+	v     *decode.Value
+	depth int
+}
+
+type browser struct {
+	i      *Interp
+	ctx    context.Context
+	opts   Options
+	width  int
+	height int
+
+	root     *decode.Value
+	selected *decode.Value
+	expanded map[*decode.Value]bool
+	rows     []browseRow
+	treeTop  int
+	dumpTop  int64
+	// show bits instead of hex and ascii in dump pane
+	bits bool
+
+	// active prompt, "" if none
+	prompt  string
+	input   string
+	message string
+	quit    bool
+}
+
+func (b *browser) paneHeight() int {
+	return mathextra.MaxInt(1, b.height-2)
+}
+
+func (b *browser) updateRows() {
+	b.rows = nil
+	var walk func(v *decode.Value, depth int)
+	walk = func(v *decode.Value, depth int) {
+		b.rows = append(b.rows, browseRow{v: v, depth: depth})
+		if c, ok := v.V.(*decode.Compound); ok && b.expanded[v] {
+			for _, cv := range c.Children {
+				walk(cv, depth+1)
+			}
+		}
+	}
+	walk(b.root, 0)
+}
+
+func (b *browser) selectedRow() int {
+	for ri, r := range b.rows {
+		if r.v == b.selected {
+			return ri
+		}
+	}
+	return 0
+}
+
+func (b *browser) selectRow(ri int) {
+	ri = mathextra.ClampInt(0, len(b.rows)-1, ri)
+	b.selected = b.rows[ri].v
+}
+
+// select value and expand all parents so that it's visible
+func (b *browser) selectValue(v *decode.Value) {
+	for p := v.Parent; p != nil; p = p.Parent {
+		b.expanded[p] = true
+	}
+	b.selected = v
+	b.updateRows()
+}
+
+func (b *browser) sibling(delta int) {
+	p := b.selected.Parent
+	if p == nil {
+		return
+	}
+	c, ok := p.V.(*decode.Compound)
+	if !ok {
+		return
+	}
+	i := b.selected.Index + delta
+	if i < 0 || i >= len(c.Children) {
+		return
+	}
+	b.selected = c.Children[i]
+}
+
+// select deepest value in current buffer that includes byte offset
+func (b *browser) jumpToOffset(s string) {
+	offset, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		b.message = fmt.Sprintf("invalid offset %q", s)
+		return
+	}
+	bitOffset := offset * 8
+
+	var found *decode.Value
+	_ = b.selected.BufferRoot().WalkRootPreOrder(func(v *decode.Value, _ *decode.Value, _ int, _ int) error {
+		r := v.InnerRange()
+		if bitOffset >= r.Start && bitOffset < r.Stop() {
+			found = v
+			return nil
+		}
+		return decode.ErrWalkSkipChildren
+	})
+	if found == nil {
+		b.message = fmt.Sprintf("offset %s not found", s)
+		return
+	}
+	b.selectValue(found)
+}
+
+func (b *browser) formatRoot() {
+	v := b.selected
+	if c, ok := v.V.(*decode.Compound); ok && c.Format != nil && v.Parent != nil {
+		v = v.Parent
+	}
+	b.selectValue(v.FormatRoot())
+}
+
+// evaluate expression with selected value as input, select first output if it's
+// a decode value otherwise show it as JSON
+func (b *browser) filter(expr string) {
+	iter, err := b.i.Eval(b.ctx, makeDecodeValue(b.selected), expr, EvalOpts{
+		filename: "browse",
+		output:   ioextra.DiscardCtxWriter{Ctx: b.ctx},
+	})
+	if err != nil {
+		b.message = err.Error()
+		return
+	}
+	v, ok := iter.Next()
+	if !ok {
+		b.message = "empty"
+		return
+	}
+	switch v := v.(type) {
+	case error:
+		b.message = v.Error()
+	case DecodeValue:
+		b.selectValue(v.DecodeValue())
+	default:
+		opts := b.opts
+		opts.Compact = true
+		cj, err := b.i.NewColorJSON(opts)
+		if err != nil {
+			b.message = err.Error()
+			return
+		}
+		sb := &strings.Builder{}
+		if err := cj.Marshal(v, sb); err != nil {
+			b.message = err.Error()
+			return
+		}
+		b.message = sb.String()
+	}
+}
+
+func (b *browser) key(k int) {
+	if b.prompt != "" {
+		switch k {
+		case '\r', '\n':
+			prompt, input := b.prompt, b.input
+			b.prompt, b.input = "", ""
+			switch prompt {
+			case "offset":
+				b.jumpToOffset(input)
+			case "filter":
+				b.filter(input)
+			}
+		case browseKeyEscape, 3:
+			b.prompt, b.input = "", ""
+		case 0x7f, 0x08:
+			if rs := []rune(b.input); len(rs) > 0 {
+				b.input = string(rs[:len(rs)-1])
+			}
+		default:
+			if k >= 0x20 && k < browseKeyUp {
+				b.input += string(rune(k))
+			}
+		}
+		return
+	}
+
+	b.message = ""
+	ri := b.selectedRow()
+	_, isCompound := b.selected.V.(*decode.Compound)
+
+	switch k {
+	case 'q', 3, 4:
+		b.quit = true
+	case browseKeyUp, 'k':
+		b.selectRow(ri - 1)
+	case browseKeyDown, 'j':
+		b.selectRow(ri + 1)
+	case browseKeyPageUp:
+		b.selectRow(ri - b.paneHeight())
+	case browseKeyPageDown:
+		b.selectRow(ri + b.paneHeight())
+	case browseKeyHome:
+		b.selectRow(0)
+	case browseKeyEnd:
+		b.selectRow(len(b.rows) - 1)
+	case browseKeyLeft, 'h':
+		if isCompound && b.expanded[b.selected] {
+			b.expanded[b.selected] = false
+		} else if b.selected.Parent != nil {
+			b.selected = b.selected.Parent
+		}
+	case browseKeyRight, 'l':
+		if isCompound {
+			b.expanded[b.selected] = true
+		}
+	case '\r', '\n', ' ':
+		if isCompound {
+			b.expanded[b.selected] = !b.expanded[b.selected]
+		}
+	case 'n':
+		b.sibling(1)
+	case 'p':
+		b.sibling(-1)
+	case 'r':
+		b.formatRoot()
+	case 'g':
+		b.prompt = "offset"
+	case '/':
+		b.prompt = "filter"
+	case 'b':
+		b.bits = !b.bits
+		// line size changes so scroll to selection
+		b.dumpTop = -1
+	}
+	b.updateRows()
+}
+
+// resize to terminal size, returns true if size changed
+func (b *browser) resize(t Terminal) bool {
+	w, h := t.Size()
+	if w <= 0 || h <= 0 || (w == b.width && h == b.height) {
+		return false
+	}
+	b.width, b.height = w, h
+	return true
+}
+
+func (b *browser) treeLine(r browseRow, width int) string {
+	deco := b.opts.Decorator
+	sb := &strings.Builder{}
+
+	sb.WriteString(strings.Repeat("  ", r.depth))
+	if _, ok := r.v.V.(*decode.Compound); ok {
+		switch {
+		case b.expanded[r.v] && b.opts.Unicode:
+			sb.WriteString("▾ ")
+		case b.expanded[r.v]:
+			sb.WriteString("- ")
+		case b.opts.Unicode:
+			sb.WriteString("▸ ")
+		default:
+			sb.WriteString("+ ")
+		}
+	} else {
+		sb.WriteString("  ")
+	}
+
+	isInArray := false
+	if r.v.Parent != nil {
+		if c, ok := r.v.Parent.V.(*decode.Compound); ok {
+			isInArray = c.IsArray
+		}
+	}
+	if r.depth == 0 {
+		sb.WriteString(valuePathDecorated(r.v, deco))
+	} else if !isInArray {
+		sb.WriteString(deco.ObjectKey.Wrap(r.v.Name))
+	}
+	opts := b.opts
+	opts.Verbose = false
+	_ = dumpFieldValue(sb, r.v, isInArray, opts)
+
+	line := ansi.Truncate(sb.String(), width)
+	if l := ansi.Len(line); l < width {
+		line += strings.Repeat(" ", width-l)
+	}
+	if r.v == b.selected {
+		line = ansi.Inverse.Wrap(line)
+	}
+
+	return line
+}
+
+// read visible part of root buffer for a dump pane with lineBytes per line, scrolls
+// so that selected start byte is visible
+func (b *browser) dumpBuffer(lineBytes int) (int64, []byte, error) {
+	br := b.selected.RootReader
+	rootLen, err := bitioextra.Len(br)
+	if err != nil {
+		return 0, nil, err
+	}
+	rootBytes := bitio.BitsByteCount(rootLen)
+
+	paneH := int64(b.paneHeight())
+	selLine := b.selected.InnerRange().Start / 8 / int64(lineBytes)
+	if b.dumpTop < 0 || selLine < b.dumpTop || selLine >= b.dumpTop+paneH {
+		b.dumpTop = mathextra.MaxInt64(0, selLine-paneH/4)
+	}
+
+	startByte := b.dumpTop * int64(lineBytes)
+	n := mathextra.MinInt64(paneH*int64(lineBytes), rootBytes-startByte)
+	if n < 0 {
+		n = 0
+	}
+	buf := make([]byte, n)
+	readBits := mathextra.MinInt64(n*8, rootLen-startByte*8)
+	if _, err := bitio.ReadAtFull(br, buf, readBits, startByte*8); err != nil {
+		return 0, nil, err
+	}
+
+	return startByte, buf, nil
+}
+
+func (b *browser) byteColorFn(start int64) func(b byte) ansi.Code {
+	if b.opts.DumpEntropy {
+		return entropyByteColorFn(b.selected.RootReader, start, b.opts.Decorator.EntropyColor)
+	}
+	return b.opts.Decorator.ByteColor
+}
+
+// render hex and ascii columns the same way as dump with the selected range highlighted
+func (b *browser) hexLines(lineBytes int, addrWidth int) ([]string, error) {
+	deco := b.opts.Decorator
+	sr := b.selected.InnerRange()
+	selStart := sr.Start / 8
+	selStop := bitio.BitsByteCount(sr.Stop())
+
+	startByte, buf, err := b.dumpBuffer(lineBytes)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(len(buf))
+
+	colorFn := func(start int64) func(b byte) ansi.Code {
+		byteColorFn := b.byteColorFn(start)
+		pos := start
+		return func(bv byte) ansi.Code {
+			c := byteColorFn(bv)
+			p := pos
+			pos++
+			if p >= selStart && p < selStop {
+				return c.Add(ansi.Inverse)
+			}
+			return c
+		}
+	}
+	hexColorFn := colorFn(startByte)
+	asciiColorFn := colorFn(startByte)
+
+	out := &bytes.Buffer{}
+	cw := columnwriter.New(out, []int{addrWidth, 1, lineBytes*3 - 1, 1, lineBytes})
+	lines := (n + int64(lineBytes) - 1) / int64(lineBytes)
+	for l := int64(0); l < lines; l++ {
+		fmt.Fprintf(cw.Columns[colAddr], "%s\n", deco.DumpAddr.F(mathextra.PadFormatInt(startByte+l*int64(lineBytes), b.opts.AddrBase, true, addrWidth)))
+		fmt.Fprint(cw.Columns[1], deco.Column, "\n")
+		fmt.Fprint(cw.Columns[3], deco.Column, "\n")
+	}
+	hw := hexpairwriter.New(cw.Columns[colHex], lineBytes, 0, func(bv byte) string { return hexColorFn(bv).Wrap(hexpairwriter.Pair(bv)) })
+	if _, err := hw.Write(buf); err != nil {
+		return nil, err
+	}
+	aw := asciiwriter.New(cw.Columns[colASCII], lineBytes, 0, func(bv byte) string { return asciiColorFn(bv).Wrap(asciiwriter.SafeASCII(bv)) })
+	if _, err := aw.Write(buf); err != nil {
+		return nil, err
+	}
+	if err := cw.Flush(); err != nil {
+		return nil, err
+	}
+
+	s := strings.TrimSuffix(out.String(), "\n")
+	if s == "" {
+		return nil, nil
+	}
+	return strings.Split(s, "\n"), nil
+}
+
+// render bits of each byte with the selected bit range highlighted, shows exact
+// position of fields not aligned to bytes
+func (b *browser) bitLines(lineBytes int, addrWidth int) ([]string, error) {
+	deco := b.opts.Decorator
+	sr := b.selected.InnerRange()
+
+	startByte, buf, err := b.dumpBuffer(lineBytes)
+	if err != nil {
+		return nil, err
+	}
+	byteColorFn := b.byteColorFn(startByte)
+
+	var lines []string
+	for l := 0; l*lineBytes < len(buf); l++ {
+		sb := &strings.Builder{}
+		lineStart := startByte + int64(l*lineBytes)
+		fmt.Fprintf(sb, "%s", deco.DumpAddr.F(mathextra.PadFormatInt(lineStart, b.opts.AddrBase, true, addrWidth)))
+		sb.WriteString(deco.Column)
+		for i := 0; i < lineBytes && l*lineBytes+i < len(buf); i++ {
+			if i > 0 {
+				sb.WriteString(" ")
+			}
+			bv := buf[l*lineBytes+i]
+			c := byteColorFn(bv)
+			bits := binwriter.Bits(bv)
+			bitStart := (lineStart + int64(i)) * 8
+			// split bits into runs of selected and not selected
+			for j := 0; j < 8; {
+				selected := bitStart+int64(j) >= sr.Start && bitStart+int64(j) < sr.Stop()
+				k := j + 1
+				for k < 8 && (bitStart+int64(k) >= sr.Start && bitStart+int64(k) < sr.Stop()) == selected {
+					k++
+				}
+				if selected {
+					sb.WriteString(c.Add(ansi.Inverse).Wrap(bits[j:k]))
+				} else {
+					sb.WriteString(c.Wrap(bits[j:k]))
+				}
+				j = k
+			}
+		}
+		lines = append(lines, sb.String())
+	}
+
+	return lines, nil
+}
+
+func (b *browser) statusLine() string {
+	deco := b.opts.Decorator
+	r := b.selected.InnerRange()
+	s := fmt.Sprintf("%s %s (%s)",
+		valuePathDecorated(b.selected, deco),
+		mathextra.BitRange(r).StringByteBits(b.opts.AddrBase),
+		mathextra.Bits(r.Len).StringByteBits(b.opts.SizeBase),
+	)
+	if _, ok := b.selected.V.(*decode.Compound); !ok && r.Len > 0 && r.Len <= 64 {
+		buf := make([]byte, bitio.BitsByteCount(r.Len))
+		if _, err := bitio.ReadAtFull(b.selected.RootReader, buf, r.Len, r.Start); err == nil {
+			s += " bits " + deco.Number.Wrap(bitio.BitStringFromBytes(buf, r.Len))
+		}
+	}
+	return s
+}
+
+func (b *browser) render(w io.Writer) error {
+	sb := &strings.Builder{}
+	// position cursor at start of each row instead of using newlines as raw mode
+	// does not translate \n to \r\n
+	row := func(r int) { fmt.Fprintf(sb, "\x1b[%d;1H", r+1) }
+
+	paneH := b.paneHeight()
+	lineBytes := mathextra.MaxInt(1, b.opts.LineBytes)
+	addrWidth := mathextra.DigitsInBase(bitio.BitsByteCount(b.root.Range.Stop()), true, b.opts.AddrBase)
+	minLineBytes := 4
+	dumpWidth := func() int { return addrWidth + 1 + lineBytes*3 - 1 + 1 + lineBytes }
+	if b.bits {
+		minLineBytes = 1
+		dumpWidth = func() int { return addrWidth + 1 + lineBytes*9 - 1 }
+	}
+	// make room for tree pane if terminal is narrow
+	for lineBytes > minLineBytes && b.width-dumpWidth()-1 < b.width/3 {
+		lineBytes /= 2
+	}
+	treeWidth := mathextra.MaxInt(1, b.width-dumpWidth()-1)
+
+	ri := b.selectedRow()
+	if ri < b.treeTop {
+		b.treeTop = ri
+	} else if ri >= b.treeTop+paneH {
+		b.treeTop = ri - paneH + 1
+	}
+	b.treeTop = mathextra.ClampInt(0, mathextra.MaxInt(0, len(b.rows)-1), b.treeTop)
+
+	dumpLinesFn := b.hexLines
+	if b.bits {
+		dumpLinesFn = b.bitLines
+	}
+	dumpLines, err := dumpLinesFn(lineBytes, addrWidth)
+	if err != nil {
+		return err
+	}
+
+	for l := 0; l < paneH; l++ {
+		row(l)
+		if ti := b.treeTop + l; ti < len(b.rows) {
+			sb.WriteString(b.treeLine(b.rows[ti], treeWidth))
+		} else {
+			sb.WriteString(strings.Repeat(" ", treeWidth))
+		}
+		sb.WriteString(b.opts.Decorator.Column)
+		if l < len(dumpLines) {
+			sb.WriteString(dumpLines[l])
+		}
+		// clear rest of line
+		sb.WriteString("\x1b[K")
+	}
+
+	row(paneH)
+	sb.WriteString(ansi.Truncate(b.statusLine(), b.width))
+	sb.WriteString("\x1b[K")
+	row(paneH + 1)
+	switch {
+	case b.prompt != "":
+		sb.WriteString(ansi.Truncate(b.prompt+": "+b.input, b.width))
+	case b.message != "":
+		sb.WriteString(ansi.Truncate(b.message, b.width))
+	default:
+		sb.WriteString(ansi.Truncate(browseHelp, b.width))
+	}
+	sb.WriteString("\x1b[K")
+
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+func (i *Interp) _browse(c interface{}, a []interface{}) gojq.Iter {
+	dv, ok := c.(DecodeValue)
+	if !ok {
+		return gojq.NewIter(fmt.Errorf("%v: value is not a decode value", c))
+	}
+	if err := i.allow(CapabilityStdin, ""); err != nil {
+		return gojq.NewIter(err)
+	}
+
+	var sizeOpts struct {
+		Width  int `mapstructure:"width"`
+		Height int `mapstructure:"height"`
+	}
+	_ = mapstructure.Decode(a[0], &sizeOpts)
+
+	// show whole tree so that jump to offset and format root etc can select any value
+	v := dv.DecodeValue()
+	root := v.Root()
+	b := &browser{
+		i:        i,
+		ctx:      i.evalInstance.ctx,
+		opts:     i.Options(a[0]),
+		width:    sizeOpts.Width,
+		height:   sizeOpts.Height,
+		root:     root,
+		expanded: map[*decode.Value]bool{root: true},
+	}
+	b.selectValue(v)
+
+	// get once as it might create a new reader each time
+	stdin := i.os.Stdin()
+	if rm, ok := stdin.(RawModer); ok && stdin.IsTerminal() {
+		restore, err := rm.RawMode()
+		if err != nil {
+			return gojq.NewIter(err)
+		}
+		defer func() { _ = restore() }()
+	}
+
+	w := i.evalInstance.output
+	// alternate screen and hide cursor, restore on return
+	if _, err := io.WriteString(w, "\x1b[?1049h\x1b[?25l"); err != nil {
+		return gojq.NewIter(err)
+	}
+	defer func() { _, _ = io.WriteString(w, "\x1b[?25h\x1b[?1049l") }()
+
+	stdout := i.os.Stdout()
+	waiter, _ := stdin.(InputWaiter)
+	redraw := true
+	buf := make([]byte, 4096)
+	for !b.quit {
+		if b.resize(stdout) {
+			// clear as rows outside of new size are not redrawn
+			if _, err := io.WriteString(w, "\x1b[2J"); err != nil {
+				return gojq.NewIter(err)
+			}
+			redraw = true
+		}
+		if redraw {
+			if err := b.render(w); err != nil {
+				return gojq.NewIter(err)
+			}
+			redraw = false
+		}
+
+		// without waiter resize is only noticed on next key press
+		if waiter != nil {
+			ready, err := waiter.WaitInput(browseResizeInterval)
+			if err != nil {
+				return gojq.NewIter(err)
+			}
+			if !ready {
+				if err := b.ctx.Err(); err != nil {
+					return gojq.NewIter(err)
+				}
+				continue
+			}
+		}
+
+		n, err := stdin.Read(buf)
+		redraw = true
+		if n > 0 {
+			for _, k := range browseKeys(buf[0:n]) {
+				b.key(k)
+				if b.quit {
+					break
+				}
+			}
+		}
+		if err != nil {
+			if err == io.EOF { //nolint:errorlint
+				break
+			}
+			return gojq.NewIter(err)
+		}
+		if err := b.ctx.Err(); err != nil {
+			return gojq.NewIter(err)
+		}
+	}
+
+	return gojq.NewIter()
+}
@@ -26,6 +26,7 @@ func init() {
 		return []Function{
 			{"_registry", 0, 0, i._registry, nil},
 			{"_tovalue", 1, 1, i._toValue, nil},
+			{"_toannotated", 1, 1, nil, i._toAnnotated},
 			{"_decode", 2, 2, i._decode, nil},
 		}
 	})
@@ -76,6 +77,7 @@ func (i *Interp) _registry(c interface{}, a []interface{}) interface{} {
 			"root_name":   f.RootName,
 			"root_array":  f.RootArray,
 			"to_repr":     f.ToRepr,
+			"summary":     f.Summary,
 		}
 
 		var dependenciesVs []interface{}
@@ -245,6 +247,88 @@ func valueHas(key interface{}, a func(name string) interface{}, b func(key inter
 	return b(key)
 }
 
+// _toAnnotated outputs one object with metadata per value in pre-order, is lazy so that huge
+// trees can be streamed
+func (i *Interp) _toAnnotated(c interface{}, a []interface{}) gojq.Iter {
+	dv, ok := c.(DecodeValue)
+	if !ok {
+		return gojq.NewIter(fmt.Errorf("%v: value is not a decode value", c))
+	}
+	opts := i.Options(a[0])
+
+	stack := []*decode.Value{dv.DecodeValue()}
+	return iterFn(func() (interface{}, bool) {
+		if len(stack) == 0 {
+			return nil, false
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if c, ok := v.V.(*decode.Compound); ok {
+			for j := len(c.Children) - 1; j >= 0; j-- {
+				stack = append(stack, c.Children[j])
+			}
+		}
+
+		av, err := annotatedValue(v, opts)
+		if err != nil {
+			return err, true
+		}
+		return av, true
+	})
+}
+
+func annotatedValue(dv *decode.Value, opts Options) (interface{}, error) {
+	dvb := decodeValueBase{dv}
+
+	var actual, sym interface{}
+	errs := []interface{}{}
+	switch vv := dv.V.(type) {
+	case *decode.Compound:
+		if vv.Err != nil {
+			errs = append(errs, vv.Err.Error())
+		}
+	case *scalar.S:
+		var err error
+		if actual, err = annotatedScalar(vv.Actual, opts); err != nil {
+			return nil, err
+		}
+		if sym, err = annotatedScalar(vv.Sym, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]interface{}{
+		"name": dv.Name,
+		"path": valuePath(dv),
+		"range": map[string]interface{}{
+			"start_bit": big.NewInt(dv.Range.Start),
+			"len_bits":  big.NewInt(dv.Range.Len),
+		},
+		"actual":      actual,
+		"sym":         sym,
+		"description": dvb.JQValueKey("_description"),
+		"format":      dvb.JQValueKey("_format"),
+		"unknown":     dvb.JQValueKey("_unknown"),
+		"errors":      errs,
+	}, nil
+}
+
+// scalar value as jq value, bits are formatted using bits_format option
+func annotatedScalar(v interface{}, opts Options) (interface{}, error) {
+	if br, ok := v.(bitio.ReaderAtSeeker); ok {
+		brC, err := bitioextra.Clone(br)
+		if err != nil {
+			return nil, err
+		}
+		return opts.BitsFormatFn(brC)
+	}
+	jv, ok := gojqextra.ToGoJQValue(v)
+	if !ok {
+		return nil, fmt.Errorf("can't convert scalar value to jq value %#+v", v)
+	}
+	return jv, nil
+}
+
 // optsFn is a function as toValue is used by tovalue/0 so needs to be fast
 func toValue(optsFn func() Options, v interface{}) (interface{}, bool) {
 	switch v := v.(type) {
@@ -4,13 +4,15 @@ import (
 	"math/big"
 
 	"github.com/wader/fq/internal/ansi"
+	"github.com/wader/fq/internal/mathextra"
 	"github.com/wader/fq/pkg/bitio"
 )
 
 var PlainDecorator = Decorator{
-	Column:     "|",
-	ValueColor: func(v interface{}) ansi.Code { return ansi.None },
-	ByteColor:  func(b byte) ansi.Code { return ansi.None },
+	Column:       "|",
+	ValueColor:   func(v interface{}) ansi.Code { return ansi.None },
+	ByteColor:    func(b byte) ansi.Code { return ansi.None },
+	EntropyColor: func(e float64) ansi.Code { return ansi.None },
 }
 
 func decoratorFromOptions(opts Options) Decorator {
@@ -75,9 +77,26 @@ func decoratorFromOptions(opts Options) Decorator {
 			}
 		}
 		d.ByteColor = func(b byte) ansi.Code { return byteColors[b] }
+
+		entropyColors := make([]ansi.Code, 101)
+		for i := range entropyColors {
+			entropyColors[i] = byteDefaultColor
+		}
+		for _, sr := range opts.EntropyColors {
+			c := ansi.FromString(sr.Value)
+			for _, r := range sr.Ranges {
+				for i := mathextra.ClampInt(0, 100, r[0]); i <= mathextra.ClampInt(0, 100, r[1]); i++ {
+					entropyColors[i] = c
+				}
+			}
+		}
+		d.EntropyColor = func(e float64) ansi.Code {
+			return entropyColors[mathextra.ClampInt(0, 100, int(e*100/8))]
+		}
 	} else {
 		d.ValueColor = func(v interface{}) ansi.Code { return ansi.None }
 		d.ByteColor = func(b byte) ansi.Code { return ansi.None }
+		d.EntropyColor = func(e float64) ansi.Code { return ansi.None }
 	}
 
 	return d
@@ -103,6 +122,8 @@ type Decorator struct {
 
 	ValueColor func(v interface{}) ansi.Code
 	ByteColor  func(b byte) ansi.Code
+	// entropy in bits per byte, 0-8
+	EntropyColor func(e float64) ansi.Code
 
 	Column string
 }
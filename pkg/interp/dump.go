@@ -8,7 +8,9 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/wader/fq/internal/ansi"
 	"github.com/wader/fq/internal/asciiwriter"
+	"github.com/wader/fq/internal/binwriter"
 	"github.com/wader/fq/internal/bitioextra"
 	"github.com/wader/fq/internal/columnwriter"
 	"github.com/wader/fq/internal/hexpairwriter"
@@ -36,6 +38,81 @@ func isCompound(v *decode.Value) bool {
 	}
 }
 
+// field index, value, description etc after the name, used by dump and browse
+func dumpFieldValue(w io.Writer, v *decode.Value, isInArray bool, opts Options) error {
+	deco := opts.Decorator
+	cprint := func(a ...interface{}) {
+		fmt.Fprint(w, a...)
+	}
+	cfmt := func(format string, a ...interface{}) {
+		fmt.Fprintf(w, format, a...)
+	}
+
+	if isInArray {
+		cfmt("%s%s%s", deco.Index.F("["), deco.Number.F(strconv.Itoa(v.Index)), deco.Index.F("]"))
+	}
+
+	var valueErr error
+
+	// TODO: cleanup map[string]interface{} []interface{} or json format
+	// dump should use some internal interface instead?
+	switch vv := v.V.(type) {
+	case *decode.Compound:
+		if vv.IsArray {
+			cfmt("%s%s:%s%s", deco.Index.F("["), deco.Number.F("0"), deco.Number.F(strconv.Itoa(len(vv.Children))), deco.Index.F("]"))
+		} else {
+			cfmt("%s", deco.Object.F("{}"))
+		}
+		cprint(":")
+		if opts.Verbose && isInArray {
+			cfmt(" %s", v.Name)
+		}
+		if vv.Description != "" {
+			cfmt(" %s", deco.Value.F(vv.Description))
+		}
+		if vv.Format != nil {
+			cfmt(" (%s)", deco.Value.F(vv.Format.Name))
+		}
+
+		valueErr = vv.Err
+	case *scalar.S:
+		// TODO: rethink scalar array/struct (json format)
+		switch av := vv.Actual.(type) {
+		case map[string]interface{}:
+			cfmt(": %s (%s)", deco.Object.F("{}"), deco.Value.F("json"))
+		case []interface{}:
+			cfmt(": %s%s:%s%s (%s)", deco.Index.F("["), deco.Number.F("0"), deco.Number.F(strconv.Itoa(len(av))), deco.Index.F("]"), deco.Value.F("json"))
+		default:
+			cprint(":")
+			if vv.Sym == nil {
+				cfmt(" %s", deco.ValueColor(vv.Actual).F(previewValue(vv.Actual, vv.ActualDisplay)))
+			} else {
+				cfmt(" %s", deco.ValueColor(vv.Sym).F(previewValue(vv.Sym, vv.SymDisplay)))
+				cfmt(" (%s)", deco.ValueColor(vv.Actual).F(previewValue(vv.Actual, vv.ActualDisplay)))
+			}
+
+			if opts.Verbose && isInArray {
+				cfmt(" %s", v.Name)
+			}
+
+			// TODO: similar to struct/array?
+			if vv.Description != "" {
+				cfmt(fmt.Sprintf(" (%s)", deco.Value.F(vv.Description)))
+			}
+		}
+	default:
+		panic(fmt.Sprintf("unreachable vv %#+v", vv))
+	}
+
+	if opts.Verbose {
+		innerRange := v.InnerRange()
+		cfmt(" %s (%s)",
+			mathextra.BitRange(innerRange).StringByteBits(opts.AddrBase), mathextra.Bits(innerRange.Len).StringByteBits(opts.SizeBase))
+	}
+
+	return valueErr
+}
+
 func dumpEx(v *decode.Value, buf []byte, cw *columnwriter.Writer, depth int, rootV *decode.Value, rootDepth int, addrWidth int, opts Options) error {
 	deco := opts.Decorator
 	// no error check as we write into buffering column
@@ -58,7 +135,12 @@ func dumpEx(v *decode.Value, buf []byte, cw *columnwriter.Writer, depth int, roo
 	if depth == 0 {
 		for i := 0; i < opts.LineBytes; i++ {
 			s := mathextra.PadFormatInt(int64(i), opts.AddrBase, false, 2)
-			hexHeader += s
+			if opts.DumpBits {
+				// bit index in byte
+				hexHeader += "01234567"
+			} else {
+				hexHeader += s
+			}
 			if i < opts.LineBytes-1 {
 				hexHeader += " "
 			}
@@ -115,69 +197,9 @@ func dumpEx(v *decode.Value, buf []byte, cw *columnwriter.Writer, depth int, roo
 	}
 
 	cfmt(colField, "%s%s", indent, name)
-	if isInArray {
-		cfmt(colField, "%s%s%s", deco.Index.F("["), deco.Number.F(strconv.Itoa(v.Index)), deco.Index.F("]"))
-	}
-
-	var valueErr error
-
-	// TODO: cleanup map[string]interface{} []interface{} or json format
-	// dump should use some internal interface instead?
-	switch vv := v.V.(type) {
-	case *decode.Compound:
-		if vv.IsArray {
-			cfmt(colField, "%s%s:%s%s", deco.Index.F("["), deco.Number.F("0"), deco.Number.F(strconv.Itoa(len(vv.Children))), deco.Index.F("]"))
-		} else {
-			cfmt(colField, "%s", deco.Object.F("{}"))
-		}
-		cprint(colField, ":")
-		if opts.Verbose && isInArray {
-			cfmt(colField, " %s", v.Name)
-		}
-		if vv.Description != "" {
-			cfmt(colField, " %s", deco.Value.F(vv.Description))
-		}
-		if vv.Format != nil {
-			cfmt(colField, " (%s)", deco.Value.F(vv.Format.Name))
-		}
-
-		valueErr = vv.Err
-	case *scalar.S:
-		// TODO: rethink scalar array/struct (json format)
-		switch av := vv.Actual.(type) {
-		case map[string]interface{}:
-			cfmt(colField, ": %s (%s)", deco.Object.F("{}"), deco.Value.F("json"))
-		case []interface{}:
-			cfmt(colField, ": %s%s:%s%s (%s)", deco.Index.F("["), deco.Number.F("0"), deco.Number.F(strconv.Itoa(len(av))), deco.Index.F("]"), deco.Value.F("json"))
-		default:
-			cprint(colField, ":")
-			if vv.Sym == nil {
-				cfmt(colField, " %s", deco.ValueColor(vv.Actual).F(previewValue(vv.Actual, vv.ActualDisplay)))
-			} else {
-				cfmt(colField, " %s", deco.ValueColor(vv.Sym).F(previewValue(vv.Sym, vv.SymDisplay)))
-				cfmt(colField, " (%s)", deco.ValueColor(vv.Actual).F(previewValue(vv.Actual, vv.ActualDisplay)))
-			}
-
-			if opts.Verbose && isInArray {
-				cfmt(colField, " %s", v.Name)
-			}
-
-			// TODO: similar to struct/array?
-			if vv.Description != "" {
-				cfmt(colField, fmt.Sprintf(" (%s)", deco.Value.F(vv.Description)))
-			}
-		}
-	default:
-		panic(fmt.Sprintf("unreachable vv %#+v", vv))
-	}
-
+	valueErr := dumpFieldValue(cw.Columns[colField], v, isInArray, opts)
 	innerRange := v.InnerRange()
 
-	if opts.Verbose {
-		cfmt(colField, " %s (%s)",
-			mathextra.BitRange(innerRange).StringByteBits(opts.AddrBase), mathextra.Bits(innerRange.Len).StringByteBits(opts.SizeBase))
-	}
-
 	cprint(colField, "\n")
 
 	if valueErr != nil {
@@ -273,17 +295,33 @@ func dumpEx(v *decode.Value, buf []byte, cw *columnwriter.Writer, depth int, roo
 		}
 
 		addrLines := lastDisplayLine - startLine + 1
-		hexpairFn := func(b byte) string { return deco.ByteColor(b).Wrap(hexpairwriter.Pair(b)) }
-		asciiFn := func(b byte) string { return deco.ByteColor(b).Wrap(asciiwriter.SafeASCII(b)) }
+		hexColorFn := deco.ByteColor
+		asciiColorFn := deco.ByteColor
+		if opts.DumpEntropy {
+			hexColorFn = entropyByteColorFn(rootV.RootReader, startByte, deco.EntropyColor)
+			asciiColorFn = entropyByteColorFn(rootV.RootReader, startByte, deco.EntropyColor)
+		}
+		hexpairFn := func(b byte) string { return hexColorFn(b).Wrap(hexpairwriter.Pair(b)) }
+		asciiFn := func(b byte) string { return asciiColorFn(b).Wrap(asciiwriter.SafeASCII(b)) }
+
+		var hexW io.Writer = hexpairwriter.New(cw.Columns[colHex], opts.LineBytes, int(startLineByteOffset), hexpairFn)
+		if opts.DumpBits {
+			// only show bits of the value so that non byte aligned values are visible
+			hexW = binwriter.New(
+				cw.Columns[colHex],
+				opts.LineBytes,
+				int(startLineByteOffset),
+				startBit-startByte*8,
+				lastDisplayBit-startBit+1,
+				func(b byte, s string) string { return hexColorFn(b).Wrap(s) },
+			)
+		}
 
 		hexBR, err := bitioextra.Clone(vBR)
 		if err != nil {
 			return err
 		}
-		if _, err := bitioextra.CopyBitsBuffer(
-			hexpairwriter.New(cw.Columns[colHex], opts.LineBytes, int(startLineByteOffset), hexpairFn),
-			hexBR,
-			buf); err != nil {
+		if _, err := bitioextra.CopyBitsBuffer(hexW, hexBR, buf); err != nil {
 			return err
 		}
 
@@ -336,6 +374,35 @@ func dumpEx(v *decode.Value, buf []byte, cw *columnwriter.Writer, depth int, roo
 	return nil
 }
 
+// size of aligned blocks used to color bytes by entropy
+const entropyDumpBlockSize = 256
+
+// returns a byte color function that colors by entropy of the block the byte is in,
+// assumes it's called once for each byte in order starting at startByte
+func entropyByteColorFn(br bitio.ReaderAtSeeker, startByte int64, colorFn func(e float64) ansi.Code) func(b byte) ansi.Code {
+	l, _ := bitioextra.Len(br)
+	lenBytes := l / 8
+	pos := startByte
+	block := int64(-1)
+	var c ansi.Code
+	return func(b byte) ansi.Code {
+		if n := pos / entropyDumpBlockSize; n != block {
+			block = n
+			c = ansi.None
+			blockStart := n * entropyDumpBlockSize
+			blockLen := mathextra.MinInt64(entropyDumpBlockSize, lenBytes-blockStart)
+			h := &byteHistogram{}
+			if blockBR, err := bitioextra.Range(br, blockStart*8, blockLen*8); err == nil {
+				if _, err := bitioextra.CopyBits(h, blockBR); err == nil {
+					c = colorFn(h.entropy())
+				}
+			}
+		}
+		pos++
+		return c
+	}
+}
+
 func dump(v *decode.Value, w io.Writer, opts Options) error {
 	maxAddrIndentWidth := 0
 	makeWalkFn := func(fn decode.WalkFn) decode.WalkFn {
@@ -356,7 +423,11 @@ func dump(v *decode.Value, w io.Writer, opts Options) error {
 		return nil
 	}))
 
-	cw := columnwriter.New(w, []int{maxAddrIndentWidth, 1, opts.LineBytes*3 - 1, 1, opts.LineBytes, 1, -1})
+	hexWidth := opts.LineBytes*3 - 1
+	if opts.DumpBits {
+		hexWidth = opts.LineBytes*9 - 1
+	}
+	cw := columnwriter.New(w, []int{maxAddrIndentWidth, 1, hexWidth, 1, opts.LineBytes, 1, -1})
 	buf := make([]byte, 32*1024)
 
 	return v.WalkPreOrder(makeWalkFn(func(v *decode.Value, rootV *decode.Value, depth int, rootDepth int) error {
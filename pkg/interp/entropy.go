@@ -0,0 +1,157 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/wader/fq/internal/bitioextra"
+	"github.com/wader/fq/internal/gojqextra"
+)
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"entropy", 0, 1, i.entropy, nil},
+			{"byte_stats", 0, 0, i.byteStats, nil},
+		}
+	})
+}
+
+type byteHistogram struct {
+	counts [256]int64
+	n      int64
+}
+
+func (h *byteHistogram) Write(p []byte) (int, error) {
+	for _, b := range p {
+		h.counts[b]++
+	}
+	h.n += int64(len(p))
+	return len(p), nil
+}
+
+// shannon entropy in bits per byte, 0 to 8
+func (h *byteHistogram) entropy() float64 {
+	if h.n == 0 {
+		return 0
+	}
+	e := 0.0
+	for _, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(h.n)
+		e -= p * math.Log2(p)
+	}
+	// avoid -0
+	return math.Abs(e)
+}
+
+// chi-square compared to uniform distribution of byte values
+func (h *byteHistogram) chiSquare() float64 {
+	if h.n == 0 {
+		return 0
+	}
+	expected := float64(h.n) / 256
+	s := 0.0
+	for _, c := range h.counts {
+		d := float64(c) - expected
+		s += d * d / expected
+	}
+	return s
+}
+
+// calls fn with histogram for each block, last block might be shorter
+func binaryBlocks(v interface{}, blockSize int64, fn func(offset int64, h *byteHistogram)) error {
+	bv, err := toBinary(v)
+	if err != nil {
+		return err
+	}
+	br, err := bv.toReader()
+	if err != nil {
+		return err
+	}
+	l, err := bitioextra.Len(br)
+	if err != nil {
+		return err
+	}
+
+	// use absolute byte offset if possible so it can be used with in_bytes_range etc
+	startByte := bv.r.Start / 8
+	lenBytes := l / 8
+	for pos := int64(0); pos < lenBytes; pos += blockSize {
+		n := blockSize
+		if pos+n > lenBytes {
+			n = lenBytes - pos
+		}
+		blockBR, err := bitioextra.Range(br, pos*8, n*8)
+		if err != nil {
+			return err
+		}
+		h := &byteHistogram{}
+		if _, err := bitioextra.CopyBits(h, blockBR); err != nil {
+			return err
+		}
+		fn(startByte+pos, h)
+	}
+
+	return nil
+}
+
+func (i *Interp) entropy(c interface{}, a []interface{}) interface{} {
+	if len(a) == 0 {
+		h := &byteHistogram{}
+		if err := binaryBlocks(c, math.MaxInt64, func(_ int64, bh *byteHistogram) { h = bh }); err != nil {
+			return err
+		}
+		return h.entropy()
+	}
+
+	blockSize, ok := gojqextra.ToInt(a[0])
+	if !ok {
+		return gojqextra.FuncTypeError{Name: "entropy", V: a[0]}
+	}
+	if blockSize <= 0 {
+		return fmt.Errorf("entropy: block size must be positive, got %d", blockSize)
+	}
+
+	blocks := []interface{}{}
+	if err := binaryBlocks(c, int64(blockSize), func(offset int64, h *byteHistogram) {
+		blocks = append(blocks, map[string]interface{}{
+			"offset":     int(offset),
+			"size":       int(h.n),
+			"entropy":    h.entropy(),
+			"chi_square": h.chiSquare(),
+		})
+	}); err != nil {
+		return err
+	}
+
+	return blocks
+}
+
+func (i *Interp) byteStats(c interface{}, a []interface{}) interface{} {
+	h := &byteHistogram{}
+	if err := binaryBlocks(c, math.MaxInt64, func(_ int64, bh *byteHistogram) { h = bh }); err != nil {
+		return err
+	}
+
+	histogram := make([]interface{}, len(h.counts))
+	sum := int64(0)
+	for b, c := range h.counts {
+		histogram[b] = int(c)
+		sum += int64(b) * c
+	}
+	mean := 0.0
+	if h.n > 0 {
+		mean = float64(sum) / float64(h.n)
+	}
+
+	return map[string]interface{}{
+		"size":       int(h.n),
+		"entropy":    h.entropy(),
+		"chi_square": h.chiSquare(),
+		"mean":       mean,
+		"histogram":  histogram,
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
@@ -47,6 +50,9 @@ func init() {
 			}), nil},
 
 			{"md5", 0, 0, makeHashFn(func() (hash.Hash, error) { return md5.New(), nil }), nil},
+			{"sha256", 0, 0, makeHashFn(func() (hash.Hash, error) { return sha256.New(), nil }), nil},
+
+			{"_fromjson_values", 0, 0, i._fromJSONValues, nil},
 
 			{"query_escape", 0, 0, i.queryEscape, nil},
 			{"query_unescape", 0, 0, i.queryUnescape, nil},
@@ -164,6 +170,27 @@ func makeHashFn(fn func() (hash.Hash, error)) func(c interface{}, a []interface{
 	}
 }
 
+// array of all whitespace separated JSON values in string, used by --slurpfile
+func (i *Interp) _fromJSONValues(c interface{}, a []interface{}) interface{} {
+	s, err := toString(c)
+	if err != nil {
+		return err
+	}
+	vs := []interface{}{}
+	jd := json.NewDecoder(bytes.NewBufferString(s))
+	for {
+		var v interface{}
+		if err := jd.Decode(&v); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		vs = append(vs, v)
+	}
+	return vs
+}
+
 func (i *Interp) queryEscape(c interface{}, a []interface{}) interface{} {
 	s, err := toString(c)
 	if err != nil {
@@ -258,7 +285,7 @@ func (i *Interp) _hexdump(c interface{}, a []interface{}) gojq.Iter {
 	if err != nil {
 		return gojq.NewIter(err)
 	}
-	if err := hexdump(i.evalInstance.output, bv, opts); err != nil {
+	if err := i.pageOutput(opts, func(w io.Writer) error { return hexdump(w, bv, opts) }); err != nil {
 		return gojq.NewIter(err)
 	}
 
@@ -0,0 +1,55 @@
+package interp
+
+import (
+	"bytes"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/wader/fq/internal/termimage"
+)
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"_toimage", 1, 1, i._toImage, nil},
+			{"_stdout_image_protocol", 0, 0, i._stdoutImageProtocol, nil},
+		}
+	})
+}
+
+func (i *Interp) _toImage(c interface{}, a []interface{}) interface{} {
+	var opts struct {
+		Protocol string `mapstructure:"protocol"`
+		Width    int    `mapstructure:"width"`
+		Height   int    `mapstructure:"height"`
+	}
+	if err := mapstructure.Decode(a[0], &opts); err != nil {
+		return err
+	}
+
+	buf, err := toBytes(c)
+	if err != nil {
+		return err
+	}
+
+	b := &bytes.Buffer{}
+	if err := termimage.Encode(b, buf, opts.Protocol, opts.Width, opts.Height); err != nil {
+		return err
+	}
+
+	return b.String()
+}
+
+func (i *Interp) _stdoutImageProtocol(c interface{}, a []interface{}) interface{} {
+	// querying writes to the terminal so don't do it while completing
+	if i.evalInstance.isCompleting {
+		return nil
+	}
+	ip, ok := i.os.Stdout().(ImageProtocoler)
+	if !ok {
+		return nil
+	}
+	if p := ip.ImageProtocol(); p != "" {
+		return p
+	}
+	return nil
+}
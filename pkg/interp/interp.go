@@ -7,6 +7,7 @@ import (
 	"embed"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -66,10 +67,13 @@ func init() {
 			{"_exttype", 0, 0, i._extType, nil},
 			{"_global_state", 0, 1, i.makeStateFn(i.state), nil},
 			{"history", 0, 0, i.history, nil},
+			{"_write_file", 1, 1, i._writeFile, nil},
 			{"_display", 1, 1, nil, i._display},
 			{"_can_display", 0, 0, i._canDisplay, nil},
 			{"_print_color_json", 0, 1, nil, i._printColorJSON},
+			{"_print_output", 0, 0, nil, i._printOutput},
 			{"_is_completing", 0, 1, i._isCompleting, nil},
+			{"_sandbox", 1, 1, i._sandbox, nil},
 		}
 	})
 }
@@ -128,11 +132,43 @@ type Input interface {
 	Terminal
 }
 
+// FileCreator can optionally be implemented by OS to be able to create or truncate
+// files, used by REPL sessions
+type FileCreator interface {
+	Create(name string) (io.WriteCloser, error)
+}
+
+// Pager can optionally be implemented by OS to run an external pager command that
+// reads from the returned writer, Close should wait for the pager to exit
+type Pager interface {
+	Pager(command string) (io.WriteCloser, error)
+}
+
+// RawModer can optionally be implemented by Input to switch terminal into raw mode
+// so that key presses can be read one by one, used by browse
+type RawModer interface {
+	RawMode() (restore func() error, err error)
+}
+
+// InputWaiter can optionally be implemented by Input to wait for input with a timeout,
+// returns true if there is input to read, used by browse to notice terminal resize
+// while waiting for key presses
+type InputWaiter interface {
+	WaitInput(timeout time.Duration) (bool, error)
+}
+
 type Output interface {
 	io.Writer
 	Terminal
 }
 
+// ImageProtocoler can optionally be implemented by Output to query the terminal for
+// image support, returns "kitty", "iterm2", "sixel", "halfblock" or "" if the terminal
+// could not be queried, used by toimage
+type ImageProtocoler interface {
+	ImageProtocol() string
+}
+
 type Platform struct {
 	OS   string
 	Arch string
@@ -294,17 +330,133 @@ func toBytes(v interface{}) ([]byte, error) {
 }
 
 func queryErrorPosition(expr string, v error) pos.Pos {
+	return queryErrorPositionFn(expr, v, func(offset int) int { return offset })
+}
+
+// offsetFn maps error offset to offset in expr
+func queryErrorPositionFn(expr string, v error, offsetFn func(offset int) int) pos.Pos {
 	var offset int
 
 	if tokIf, ok := v.(interface{ Token() (string, int) }); ok { //nolint:errorlint
 		_, offset = tokIf.Token()
 	}
 	if offset >= 0 {
-		return pos.NewFromOffset(expr, offset)
+		return pos.NewFromOffset(expr, offsetFn(offset))
 	}
 	return pos.Pos{}
 }
 
+// parseQuery parses src with $__loc__ replaced, position of a parse error is in src
+func parseQuery(src string, filename string) (*gojq.Query, pos.Pos, error) {
+	s, offsetFn := rewriteLocVariable(src, filename)
+	q, err := gojq.Parse(s)
+	if err != nil {
+		return nil, queryErrorPositionFn(src, err, offsetFn), err
+	}
+	return q, pos.Pos{}, nil
+}
+
+func isQueryIdentByte(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+// rewriteLocVariable replaces $__loc__ with a {file: ..., line: ...} object as gojq
+// does not support it. Strings, string interpolation and comments are skipped.
+// Returned function maps an offset in the rewritten text back to src.
+func rewriteLocVariable(src string, filename string) (string, func(offset int) int) {
+	const loc = "$__loc__"
+	if !strings.Contains(src, loc) {
+		return src, func(offset int) int { return offset }
+	}
+	if filename == "" || filename == "arg" {
+		// expression argument, same name as jq
+		filename = "<stdin>"
+	}
+	filenameJSON, _ := json.Marshal(filename)
+
+	// start and end offset of replacements in rewritten text
+	var replacements [][2]int
+	sb := &strings.Builder{}
+	line := 1
+	inString := false
+	depth := 0
+	// paren depth for each string interpolation
+	var interpolations []int
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		if c == '\n' {
+			line++
+		}
+		if inString {
+			switch {
+			case c == '\\' && i+1 < len(src) && src[i+1] == '(':
+				interpolations = append(interpolations, depth)
+				depth++
+				inString = false
+				sb.WriteString(src[i : i+2])
+				i++
+				continue
+			case c == '\\' && i+1 < len(src):
+				if src[i+1] == '\n' {
+					line++
+				}
+				sb.WriteString(src[i : i+2])
+				i++
+				continue
+			case c == '"':
+				inString = false
+			}
+			sb.WriteByte(c)
+			continue
+		}
+
+		switch c {
+		case '#':
+			n := strings.IndexByte(src[i:], '\n')
+			if n == -1 {
+				n = len(src) - i
+			}
+			sb.WriteString(src[i : i+n])
+			i += n - 1
+			continue
+		case '"':
+			inString = true
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if len(interpolations) > 0 && interpolations[len(interpolations)-1] == depth {
+				interpolations = interpolations[0 : len(interpolations)-1]
+				inString = true
+			}
+		case '$':
+			if strings.HasPrefix(src[i:], loc) &&
+				(i+len(loc) == len(src) || !isQueryIdentByte(src[i+len(loc)])) {
+				start := sb.Len()
+				fmt.Fprintf(sb, `{file:%s,line:%d}`, filenameJSON, line)
+				replacements = append(replacements, [2]int{start, sb.Len()})
+				i += len(loc) - 1
+				continue
+			}
+		}
+		sb.WriteByte(c)
+	}
+
+	return sb.String(), func(offset int) int {
+		delta := 0
+		for _, r := range replacements {
+			if offset < r[0] {
+				break
+			}
+			if offset < r[1] {
+				return r[0] - delta
+			}
+			delta += r[1] - r[0] - len(loc)
+		}
+		return offset - delta
+	}
+}
+
 type Variable struct {
 	Name  string
 	Value interface{}
@@ -341,12 +493,14 @@ type Interp struct {
 	interruptStack *ctxstack.Stack
 	// global state, is ref as Interp is cloned per eval
 	state *interface{}
+	// policies that side effects must be allowed by, is ref as Interp is cloned per eval
+	policies *[]Policy
 
 	// new for each eval, other values are copied by value
 	evalInstance evalInstance
 }
 
-func New(os OS, registry *registry.Registry) (*Interp, error) {
+func New(os OS, registry *registry.Registry, opts ...Option) (*Interp, error) {
 	var err error
 
 	i := &Interp{
@@ -369,6 +523,10 @@ func New(os OS, registry *registry.Registry) (*Interp, error) {
 		}
 	})
 	i.state = new(interface{})
+	i.policies = &[]Policy{}
+	for _, o := range opts {
+		o(i)
+	}
 
 	return i, nil
 }
@@ -430,6 +588,9 @@ func (i *Interp) _readline(c interface{}, a []interface{}) gojq.Iter {
 	if i.evalInstance.isCompleting {
 		return gojq.NewIter()
 	}
+	if err := i.allow(CapabilityStdin, ""); err != nil {
+		return gojq.NewIter(err)
+	}
 
 	var opts struct {
 		Promopt  string  `mapstructure:"prompt"`
@@ -554,7 +715,8 @@ func (i *Interp) _extType(c interface{}, a []interface{}) interface{} {
 
 func (i *Interp) makeStateFn(state *interface{}) func(c interface{}, a []interface{}) interface{} {
 	return func(c interface{}, a []interface{}) interface{} {
-		if len(a) > 0 {
+		// completion should not have side effects
+		if len(a) > 0 && !i.evalInstance.isCompleting {
 			*state = a[0]
 		}
 		return *state
@@ -568,6 +730,9 @@ func (i *Interp) makeStdioFn(name string, t Terminal) func(c interface{}, a []in
 			if i.evalInstance.isCompleting {
 				return gojq.NewIter("")
 			}
+			if err := i.allow(CapabilityStdin, ""); err != nil {
+				return gojq.NewIter(err)
+			}
 
 			r, ok := t.(io.Reader)
 			if !ok {
@@ -602,6 +767,9 @@ func (i *Interp) makeStdioFn(name string, t Terminal) func(c interface{}, a []in
 			if i.evalInstance.isCompleting {
 				return gojq.NewIter()
 			}
+			if err := i.allow(Capability(name), ""); err != nil {
+				return gojq.NewIter(err)
+			}
 
 			w, ok := t.(io.Writer)
 			if !ok {
@@ -616,6 +784,9 @@ func (i *Interp) makeStdioFn(name string, t Terminal) func(c interface{}, a []in
 }
 
 func (i *Interp) history(c interface{}, a []interface{}) interface{} {
+	if err := i.allow(CapabilityHistory, ""); err != nil {
+		return err
+	}
 	hs, err := i.os.History()
 	if err != nil {
 		return err
@@ -627,12 +798,47 @@ func (i *Interp) history(c interface{}, a []interface{}) interface{} {
 	return vs
 }
 
+// write string input to file
+func (i *Interp) _writeFile(c interface{}, a []interface{}) interface{} {
+	s, err := toString(c)
+	if err != nil {
+		return err
+	}
+	name, err := toString(a[0])
+	if err != nil {
+		return err
+	}
+	if i.evalInstance.isCompleting {
+		return nil
+	}
+	if err := i.allow(CapabilityCreate, name); err != nil {
+		return err
+	}
+	fc, ok := i.os.(FileCreator)
+	if !ok {
+		return fmt.Errorf("%s: creating files not supported", name)
+	}
+	f, err := fc.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, s); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (i *Interp) _display(c interface{}, a []interface{}) gojq.Iter {
 	opts := i.Options(a[0])
 
 	switch v := c.(type) {
 	case Display:
-		if err := v.Display(i.evalInstance.output, opts); err != nil {
+		if err := i.pageOutput(opts, func(w io.Writer) error { return v.Display(w, opts) }); err != nil {
 			return gojq.NewIter(err)
 		}
 		return gojq.NewIter()
@@ -653,13 +859,26 @@ func (i *Interp) _printColorJSON(c interface{}, a []interface{}) gojq.Iter {
 	if err != nil {
 		return gojq.NewIter(err)
 	}
-	if err := cj.Marshal(c, i.evalInstance.output); err != nil {
+	if err := i.pageOutput(opts, func(w io.Writer) error { return cj.Marshal(c, w) }); err != nil {
 		return gojq.NewIter(err)
 	}
 
 	return gojq.NewIter()
 }
 
+// write string to eval output instead of stdout, used by display so that output is
+// not a stdout side effect
+func (i *Interp) _printOutput(c interface{}, a []interface{}) gojq.Iter {
+	s, err := toString(c)
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+	if _, err := io.WriteString(i.evalInstance.output, s); err != nil {
+		return gojq.NewIter(err)
+	}
+	return gojq.NewIter()
+}
+
 func (i *Interp) _isCompleting(c interface{}, a []interface{}) interface{} {
 	return i.evalInstance.isCompleting
 }
@@ -669,7 +888,7 @@ type pathResolver struct {
 	open   func(filename string) (io.ReadCloser, string, error)
 }
 
-func (i *Interp) lookupPathResolver(filename string) (pathResolver, error) {
+func (i *Interp) lookupPathResolver(filename string, extraIncludePaths []string) (pathResolver, error) {
 	configDir, err := i.os.ConfigDir()
 	if err != nil {
 		return pathResolver{}, err
@@ -686,6 +905,9 @@ func (i *Interp) lookupPathResolver(filename string) (pathResolver, error) {
 		{
 			"@config/", func(filename string) (io.ReadCloser, string, error) {
 				p := path.Join(configDir, filename)
+				if err := i.allow(CapabilityInclude, p); err != nil {
+					return nil, "", err
+				}
 				f, err := i.os.FS().Open(p)
 				return f, p, err
 			},
@@ -693,17 +915,30 @@ func (i *Interp) lookupPathResolver(filename string) (pathResolver, error) {
 		{
 			"", func(filename string) (io.ReadCloser, string, error) {
 				if path.IsAbs(filename) {
+					if err := i.allow(CapabilityInclude, filename); err != nil {
+						return nil, "", err
+					}
 					f, err := i.os.FS().Open(filename)
 					return f, filename, err
 				}
 
 				// TODO: jq $ORIGIN
-				for _, includePath := range append([]string{"./"}, i.includePaths()...) {
+				var allowErr error
+				includePaths := append(append([]string{}, extraIncludePaths...), "./")
+				for _, includePath := range append(includePaths, i.includePaths()...) {
 					p := path.Join(includePath, filename)
-					if f, err := i.os.FS().Open(path.Join(includePath, filename)); err == nil {
+					// skip paths not allowed but report it if no other path was found
+					if err := i.allow(CapabilityInclude, p); err != nil {
+						allowErr = err
+						continue
+					}
+					if f, err := i.os.FS().Open(p); err == nil {
 						return f, p, nil
 					}
 				}
+				if allowErr != nil {
+					return nil, "", allowErr
+				}
 
 				return nil, "", &fs.PathError{Op: "open", Path: filename, Err: fs.ErrNotExist}
 			},
@@ -721,13 +956,15 @@ type EvalOpts struct {
 	filename     string
 	output       io.Writer
 	isCompleting bool
+	// searched before ./ and global include paths
+	includePaths []string
 }
 
-func (i *Interp) Eval(ctx context.Context, c interface{}, expr string, opts EvalOpts) (gojq.Iter, error) {
-	gq, err := gojq.Parse(expr)
+// compile expr and returns code, interp copy with its own eval instance and variable values to run with
+func (i *Interp) compile(ctx context.Context, expr string, opts EvalOpts) (*gojq.Code, *Interp, []interface{}, error) {
+	gq, p, err := parseQuery(expr, opts.filename)
 	if err != nil {
-		p := queryErrorPosition(expr, err)
-		return nil, compileError{
+		return nil, nil, nil, compileError{
 			err:      err,
 			what:     "parse",
 			filename: opts.filename,
@@ -748,6 +985,10 @@ func (i *Interp) Eval(ctx context.Context, c interface{}, expr string, opts Eval
 		variableNames = append(variableNames, "$"+k)
 		variableValues = append(variableValues, v)
 	}
+	if args := i.lookupState("args"); args != nil {
+		variableNames = append(variableNames, "$ARGS")
+		variableValues = append(variableValues, args)
+	}
 
 	var funcCompilerOpts []gojq.CompilerOption
 	for _, frFn := range functionRegisterFns {
@@ -763,7 +1004,13 @@ func (i *Interp) Eval(ctx context.Context, c interface{}, expr string, opts Eval
 	}
 
 	compilerOpts := append([]gojq.CompilerOption{}, funcCompilerOpts...)
-	compilerOpts = append(compilerOpts, gojq.WithEnvironLoader(ni.os.Environ))
+	compilerOpts = append(compilerOpts, gojq.WithEnvironLoader(func() []string {
+		// $ENV and env are empty if not allowed
+		if err := ni.allow(CapabilityEnviron, ""); err != nil {
+			return nil
+		}
+		return ni.os.Environ()
+	}))
 	compilerOpts = append(compilerOpts, gojq.WithVariables(variableNames))
 	compilerOpts = append(compilerOpts, gojq.WithModuleLoader(loadModule{
 		init: func() ([]*gojq.Query, error) {
@@ -785,7 +1032,7 @@ func (i *Interp) Eval(ctx context.Context, c interface{}, expr string, opts Eval
 			}
 			filename = filename + ".jq"
 
-			pr, err := i.lookupPathResolver(filename)
+			pr, err := i.lookupPathResolver(filename, opts.includePaths)
 			if err != nil {
 				return nil, err
 			}
@@ -816,10 +1063,8 @@ func (i *Interp) Eval(ctx context.Context, c interface{}, expr string, opts Eval
 			if err != nil {
 				return nil, err
 			}
-			s := string(b)
-			q, err := gojq.Parse(s)
+			q, p, err := parseQuery(string(b), absPath)
 			if err != nil {
-				p := queryErrorPosition(s, err)
 				return nil, compileError{
 					err:      err,
 					what:     "parse",
@@ -893,7 +1138,7 @@ func (i *Interp) Eval(ctx context.Context, c interface{}, expr string, opts Eval
 	gc, err := gojq.Compile(gq, compilerOpts...)
 	if err != nil {
 		p := queryErrorPosition(expr, err)
-		return nil, compileError{
+		return nil, nil, nil, compileError{
 			err:      err,
 			what:     "compile",
 			filename: opts.filename,
@@ -901,6 +1146,15 @@ func (i *Interp) Eval(ctx context.Context, c interface{}, expr string, opts Eval
 		}
 	}
 
+	return gc, ni, variableValues, nil
+}
+
+func (i *Interp) Eval(ctx context.Context, c interface{}, expr string, opts EvalOpts) (gojq.Iter, error) {
+	gc, ni, variableValues, err := i.compile(ctx, expr, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	output := opts.output
 	if opts.output == nil {
 		output = ioutil.Discard
@@ -980,17 +1234,29 @@ type Options struct {
 		Ranges [][2]int `mapstructure:"ranges"`
 		Value  string   `mapstructure:"value"`
 	} `mapstructure:"byte_colors"`
+	DumpEntropy   bool `mapstructure:"dump_entropy"`
+	DumpBits      bool `mapstructure:"dump_bits"`
+	EntropyColors []struct {
+		Ranges [][2]int `mapstructure:"ranges"`
+		Value  string   `mapstructure:"value"`
+	} `mapstructure:"entropy_colors"`
 	Unicode      bool   `mapstructure:"unicode"`
 	RawOutput    bool   `mapstructure:"raw_output"`
 	REPL         bool   `mapstructure:"repl"`
 	RawString    bool   `mapstructure:"raw_string"`
 	JoinString   string `mapstructure:"join_string"`
 	Compact      bool   `mapstructure:"compact"`
+	Indent       int    `mapstructure:"indent"`
+	Tab          bool   `mapstructure:"tab"`
+	ASCIIOutput  bool   `mapstructure:"ascii_output"`
 	BitsFormat   string `mapstructure:"bits_format"`
 	LineBytes    int    `mapstructure:"line_bytes"`
 	DisplayBytes int    `mapstructure:"display_bytes"`
 	AddrBase     int    `mapstructure:"addrbase"`
 	SizeBase     int    `mapstructure:"sizebase"`
+	Pager        string `mapstructure:"pager"`
+	// page output even if it fits on screen, used by less
+	ForcePager bool `mapstructure:"force_pager"`
 
 	Decorator    Decorator
 	BitsFormatFn func(br bitio.ReaderAtSeeker) (interface{}, error)
@@ -1066,7 +1332,12 @@ func (i *Interp) lookupState(key string) interface{} {
 }
 
 func (i *Interp) includePaths() []string {
-	pathsAny, ok := i.lookupState("include_paths").([]interface{})
+	v := i.lookupState("include_paths")
+	// no -L used
+	if v == nil {
+		return nil
+	}
+	pathsAny, ok := v.([]interface{})
 	if !ok {
 		panic("include_paths not slice")
 	}
@@ -1102,15 +1373,20 @@ func (i *Interp) Options(v interface{}) Options {
 }
 
 func (i *Interp) NewColorJSON(opts Options) (*colorjson.Encoder, error) {
-	indent := 2
+	indent := opts.Indent
+	if opts.Tab {
+		// one tab per level
+		indent = 1
+	}
 	if opts.Compact {
 		indent = 0
 	}
 
 	return colorjson.NewEncoder(
 		opts.Color,
-		false,
+		opts.Tab,
 		indent,
+		opts.ASCIIOutput,
 		func(v interface{}) interface{} {
 			if v, ok := toValue(func() Options { return opts }, v); ok {
 				return v
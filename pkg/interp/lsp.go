@@ -0,0 +1,646 @@
+package interp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/wader/fq/internal/lsp"
+	"github.com/wader/gojq"
+)
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"_lsp", 1, 1, nil, i._lsp},
+		}
+	})
+}
+
+var lspKeywords = []string{
+	"and", "as", "catch", "def", "elif", "else", "end", "foreach", "if",
+	"import", "include", "label", "or", "reduce", "then", "try",
+}
+
+var lspDefRe = regexp.MustCompile(`\bdef\s+([A-Za-z_][A-Za-z0-9_]*)\s*(?:\(([^)]*)\))?\s*:`)
+var lspIncludeRe = regexp.MustCompile(`\b(include|import)\s+"([^"]*)"(?:\s+as\s+(\$?[A-Za-z_][A-Za-z0-9_]*))?`)
+var lspVariableRe = regexp.MustCompile(`\$[A-Za-z_][A-Za-z0-9_]*`)
+var lspFunctionNotDefinedRe = regexp.MustCompile(`^function not defined: (.*)/\d+$`)
+var lspVariableNotDefinedRe = regexp.MustCompile(`^variable not defined: (.*)$`)
+
+func lspIsWordByte(b byte) bool {
+	return b == '_' || b == '$' || b == ':' ||
+		(b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+// returns start and end offset of word around offset
+func lspWordAt(text string, offset int) (int, int) {
+	start := offset
+	for start > 0 && lspIsWordByte(text[start-1]) {
+		start--
+	}
+	end := offset
+	for end < len(text) && lspIsWordByte(text[end]) {
+		end++
+	}
+	return start, end
+}
+
+type lspDef struct {
+	name      string
+	signature string
+	doc       string
+	// file name or builtin path shown in docs
+	source string
+	// empty if not a file that can be opened
+	uri string
+	rng lsp.Range
+}
+
+// find definitions in jq source, doc is the comment lines just before a definition
+func lspFindDefs(text string, prefix string, source string, uri string) []lspDef {
+	var defs []lspDef
+	for _, m := range lspDefRe.FindAllStringSubmatchIndex(text, -1) {
+		name := text[m[2]:m[3]]
+		signature := "def " + name + ":"
+		if m[4] != -1 {
+			var args []string
+			for _, a := range strings.Split(text[m[4]:m[5]], ";") {
+				args = append(args, strings.TrimSpace(a))
+			}
+			signature = "def " + name + "(" + strings.Join(args, "; ") + "):"
+		}
+
+		var docLines []string
+		lineStart := strings.LastIndexByte(text[0:m[0]], '\n') + 1
+		if strings.TrimSpace(text[lineStart:m[0]]) == "" {
+			lines := strings.Split(text[0:lineStart], "\n")
+			// last element is the empty string after the last newline
+			for l := len(lines) - 2; l >= 0; l-- {
+				line := strings.TrimSpace(lines[l])
+				if !strings.HasPrefix(line, "#") {
+					break
+				}
+				docLines = append([]string{strings.TrimPrefix(strings.TrimPrefix(line, "#"), " ")}, docLines...)
+			}
+		}
+
+		defs = append(defs, lspDef{
+			name:      prefix + name,
+			signature: signature,
+			doc:       strings.Join(docLines, "\n"),
+			source:    source,
+			uri:       uri,
+			rng: lsp.Range{
+				Start: lsp.PositionAt(text, m[2]),
+				End:   lsp.PositionAt(text, m[3]),
+			},
+		})
+	}
+	return defs
+}
+
+func lspDefsMarkdown(name string, defs []lspDef) string {
+	if len(defs) == 0 {
+		return "```jq\n" + name + "\n```\nBuiltin function"
+	}
+
+	var signatures []string
+	var docs []string
+	var sources []string
+	seen := map[string]struct{}{}
+	for _, d := range defs {
+		signatures = append(signatures, d.signature)
+		for _, s := range []struct {
+			s  string
+			ss *[]string
+		}{{d.doc, &docs}, {d.source, &sources}} {
+			if _, ok := seen[s.s]; ok || s.s == "" {
+				continue
+			}
+			seen[s.s] = struct{}{}
+			*s.ss = append(*s.ss, s.s)
+		}
+	}
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "```jq\n%s\n```\n", strings.Join(signatures, "\n"))
+	for _, d := range docs {
+		fmt.Fprintf(sb, "%s\n\n", d)
+	}
+	for _, s := range sources {
+		fmt.Fprintf(sb, "Defined in `%s`\n", s)
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+type lspServer struct {
+	i       *Interp
+	version string
+	// document text by URI
+	docs map[string]string
+	// definitions in builtin and format jq files by name
+	builtinDefs map[string][]lspDef
+	// function names from scope, includes native and gojq builtins
+	scopeNames []string
+}
+
+func newLSPServer(ctx context.Context, i *Interp, version string) (*lspServer, error) {
+	s := &lspServer{
+		i:           i,
+		version:     version,
+		docs:        map[string]string{},
+		builtinDefs: map[string][]lspDef{},
+	}
+
+	addDefs := func(fsys fs.ReadDirFS, source func(name string) string) error {
+		entries, err := fsys.ReadDir(".")
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if path.Ext(e.Name()) != ".jq" {
+				continue
+			}
+			b, err := fs.ReadFile(fsys, e.Name())
+			if err != nil {
+				return err
+			}
+			for _, d := range lspFindDefs(string(b), "", source(e.Name()), "") {
+				s.builtinDefs[d.name] = append(s.builtinDefs[d.name], d)
+			}
+		}
+		return nil
+	}
+
+	if err := addDefs(builtinFS, func(name string) string { return "@builtin/" + name }); err != nil {
+		return nil, err
+	}
+
+	var groupNames []string
+	for n := range i.registry.Groups {
+		groupNames = append(groupNames, n)
+	}
+	sort.Strings(groupNames)
+	seenFormats := map[string]struct{}{}
+	for _, n := range groupNames {
+		g := i.registry.MustGroup(n)
+		if n != "all" {
+			// same as the generated defs in formats.jq
+			doc := fmt.Sprintf("Decode using format group %s", n)
+			if len(g) == 1 && g[0].Name == n {
+				doc = fmt.Sprintf("Decode as %s, %s", n, g[0].Description)
+			}
+			for _, signature := range []string{"def " + n + ":", "def " + n + "($opts):"} {
+				s.builtinDefs[n] = append(s.builtinDefs[n], lspDef{
+					name:      n,
+					signature: signature,
+					doc:       doc,
+					source:    "@builtin/formats.jq",
+				})
+			}
+		}
+
+		for _, f := range g {
+			if _, ok := seenFormats[f.Name]; ok || f.Files == nil {
+				continue
+			}
+			seenFormats[f.Name] = struct{}{}
+			formatName := f.Name
+			if err := addDefs(f.Files, func(name string) string { return "format " + formatName + " " + name }); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	vs, err := i.EvalFuncValues(ctx, nil, "scope", nil, EvalOpts{})
+	if err != nil {
+		return nil, err
+	}
+	if len(vs) != 1 {
+		return nil, fmt.Errorf("scope: expected one value got %d", len(vs))
+	}
+	names, ok := vs[0].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("scope: expected array got %v", vs[0])
+	}
+	for _, n := range names {
+		if n, ok := n.(string); ok {
+			s.scopeNames = append(s.scopeNames, n)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *lspServer) text(uri string) (string, error) {
+	text, ok := s.docs[uri]
+	if !ok {
+		return "", &lsp.ResponseError{Code: lsp.CodeInvalidParams, Message: "document not open: " + uri}
+	}
+	return text, nil
+}
+
+// resolve include/import path to a file path, same search order as module loader
+func (s *lspServer) resolveModule(docPath string, name string) (string, bool) {
+	if strings.HasPrefix(name, "@") {
+		return "", false
+	}
+	filename := strings.TrimSuffix(name, "?") + ".jq"
+	candidates := []string{filename}
+	if !path.IsAbs(filename) {
+		candidates = nil
+		for _, p := range append([]string{filepath.Dir(docPath), "./"}, s.i.includePaths()...) {
+			candidates = append(candidates, path.Join(p, filename))
+		}
+	}
+	for _, c := range candidates {
+		f, err := s.i.os.FS().Open(c)
+		if err != nil {
+			continue
+		}
+		f.Close()
+		if !filepath.IsAbs(c) {
+			if abs, err := filepath.Abs(c); err == nil {
+				c = abs
+			}
+		}
+		return c, true
+	}
+	return "", false
+}
+
+func (s *lspServer) readModule(p string) (string, error) {
+	// prefer content of open document as it might not be saved yet
+	if text, ok := s.docs[lsp.URIFromPath(p)]; ok {
+		return text, nil
+	}
+	f, err := s.i.os.FS().Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// definitions in document and recursively in included and imported modules
+func (s *lspServer) docDefs(uri string, text string) []lspDef {
+	seen := map[string]struct{}{}
+
+	var findFn func(uri string, text string, prefix string, depth int) []lspDef
+	findFn = func(uri string, text string, prefix string, depth int) []lspDef {
+		docPath, err := lsp.PathFromURI(uri)
+		if err != nil {
+			return nil
+		}
+		defs := lspFindDefs(text, prefix, filepath.Base(docPath), uri)
+		if depth > 10 {
+			return defs
+		}
+		for _, m := range lspIncludeRe.FindAllStringSubmatch(text, -1) {
+			kind, name, alias := m[1], m[2], m[3]
+			// data imports bind a variable, no definitions
+			if strings.HasPrefix(alias, "$") {
+				continue
+			}
+			p, ok := s.resolveModule(docPath, name)
+			if !ok {
+				continue
+			}
+			modulePrefix := prefix
+			if kind == "import" {
+				modulePrefix = prefix + alias + "::"
+			}
+			key := modulePrefix + "\x00" + p
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			moduleText, err := s.readModule(p)
+			if err != nil {
+				continue
+			}
+			defs = append(defs, findFn(lsp.URIFromPath(p), moduleText, modulePrefix, depth+1)...)
+		}
+		return defs
+	}
+
+	return findFn(uri, text, "", 0)
+}
+
+func (s *lspServer) diagnostics(ctx context.Context, uri string, text string) []lsp.Diagnostic {
+	docPath, err := lsp.PathFromURI(uri)
+	if err != nil {
+		return []lsp.Diagnostic{}
+	}
+
+	// included files might have changed since last compile
+	for k := range s.i.includeCache {
+		if !strings.HasPrefix(k, "@builtin/") {
+			delete(s.i.includeCache, k)
+		}
+	}
+
+	_, _, _, err = s.i.compile(ctx, text, EvalOpts{
+		filename:     docPath,
+		includePaths: []string{filepath.Dir(docPath)},
+	})
+	if err == nil {
+		return []lsp.Diagnostic{}
+	}
+
+	message := err.Error()
+	start, end := 0, 0
+	var ce compileError
+	if errors.As(err, &ce) {
+		message = ce.err.Error()
+		var moduleErr compileError
+		switch {
+		case errors.As(ce.err, &moduleErr):
+			// error in included module, position is in the other file
+			message = moduleErr.Error()
+		case ce.what == "parse":
+			lineStart := 0
+			for l := 1; l < ce.pos.Line; l++ {
+				lineStart += strings.IndexByte(text[lineStart:], '\n') + 1
+			}
+			start = lineStart + ce.pos.Column
+			end = start
+			if end < len(text) {
+				end++
+			}
+		default:
+			// compile errors have no position, guess by looking for the name
+			var re *regexp.Regexp
+			if sm := lspFunctionNotDefinedRe.FindStringSubmatch(message); sm != nil {
+				re = regexp.MustCompile(`(?:^|[^A-Za-z0-9_$:])(` + regexp.QuoteMeta(sm[1]) + `)(?:[^A-Za-z0-9_:]|$)`)
+			} else if sm := lspVariableNotDefinedRe.FindStringSubmatch(message); sm != nil {
+				re = regexp.MustCompile(`(` + regexp.QuoteMeta(sm[1]) + `)(?:[^A-Za-z0-9_]|$)`)
+			}
+			if re != nil {
+				if m := re.FindStringSubmatchIndex(text); m != nil {
+					start, end = m[2], m[3]
+				}
+			}
+		}
+	}
+
+	return []lsp.Diagnostic{{
+		Range: lsp.Range{
+			Start: lsp.PositionAt(text, start),
+			End:   lsp.PositionAt(text, end),
+		},
+		Severity: lsp.SeverityError,
+		Source:   "fq",
+		Message:  message,
+	}}
+}
+
+func (s *lspServer) publishDiagnostics(ctx context.Context, c *lsp.Conn, uri string) error {
+	return c.Notify("textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: s.diagnostics(ctx, uri, s.docs[uri]),
+	})
+}
+
+// defs for name in document, included modules and builtins
+func (s *lspServer) lookupDefs(uri string, text string, name string) []lspDef {
+	var defs []lspDef
+	for _, d := range s.docDefs(uri, text) {
+		if d.name == name {
+			defs = append(defs, d)
+		}
+	}
+	return append(defs, s.builtinDefs[name]...)
+}
+
+func (s *lspServer) completion(uri string, text string, offset int) []lsp.CompletionItem {
+	start, _ := lspWordAt(text, offset)
+	prefix := text[start:offset]
+	items := map[string]lsp.CompletionItem{}
+
+	add := func(label string, kind int, defs []lspDef) {
+		if !strings.HasPrefix(label, prefix) ||
+			(strings.HasPrefix(label, "_") && !strings.HasPrefix(prefix, "_")) {
+			return
+		}
+		if _, ok := items[label]; ok {
+			return
+		}
+		item := lsp.CompletionItem{Label: label, Kind: kind}
+		if kind == lsp.CompletionItemKindFunction {
+			item.Documentation = lsp.Markdown(lspDefsMarkdown(label, defs))
+			var signatures []string
+			for _, d := range defs {
+				signatures = append(signatures, d.signature)
+			}
+			item.Detail = strings.Join(signatures, " ")
+		}
+		items[label] = item
+	}
+
+	if strings.HasPrefix(prefix, "$") {
+		for _, m := range lspVariableRe.FindAllStringIndex(text, -1) {
+			// skip the variable being completed
+			if m[0] == start {
+				continue
+			}
+			add(text[m[0]:m[1]], lsp.CompletionItemKindVariable, nil)
+		}
+		add("$ENV", lsp.CompletionItemKindVariable, nil)
+		add("$__loc__", lsp.CompletionItemKindVariable, nil)
+	} else {
+		docDefs := map[string][]lspDef{}
+		for _, d := range s.docDefs(uri, text) {
+			docDefs[d.name] = append(docDefs[d.name], d)
+		}
+		for n, defs := range docDefs {
+			add(n, lsp.CompletionItemKindFunction, defs)
+		}
+		for _, n := range s.scopeNames {
+			add(n, lsp.CompletionItemKindFunction, s.builtinDefs[n])
+		}
+		for _, k := range lspKeywords {
+			add(k, lsp.CompletionItemKindKeyword, nil)
+		}
+	}
+
+	var labels []string
+	for l := range items {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	result := []lsp.CompletionItem{}
+	for _, l := range labels {
+		result = append(result, items[l])
+	}
+
+	return result
+}
+
+func (s *lspServer) hover(uri string, text string, offset int) *lsp.Hover {
+	start, end := lspWordAt(text, offset)
+	name := text[start:end]
+	if name == "" || strings.HasPrefix(name, "$") {
+		return nil
+	}
+	defs := s.lookupDefs(uri, text, name)
+	if len(defs) == 0 {
+		found := false
+		for _, n := range s.scopeNames {
+			if n == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+
+	return &lsp.Hover{
+		Contents: lsp.Markdown(lspDefsMarkdown(name, defs)),
+		Range: &lsp.Range{
+			Start: lsp.PositionAt(text, start),
+			End:   lsp.PositionAt(text, end),
+		},
+	}
+}
+
+func (s *lspServer) definition(uri string, text string, offset int) []lsp.Location {
+	start, end := lspWordAt(text, offset)
+	name := text[start:end]
+	locations := []lsp.Location{}
+	for _, d := range s.lookupDefs(uri, text, name) {
+		// builtin definitions are not files
+		if d.uri == "" {
+			continue
+		}
+		locations = append(locations, lsp.Location{URI: d.uri, Range: d.rng})
+	}
+	return locations
+}
+
+func (s *lspServer) Handle(ctx context.Context, c *lsp.Conn, method string, params json.RawMessage) (interface{}, error) {
+	unmarshal := func(v interface{}) error {
+		if err := json.Unmarshal(params, v); err != nil {
+			return &lsp.ResponseError{Code: lsp.CodeInvalidParams, Message: err.Error()}
+		}
+		return nil
+	}
+	positionFn := func(fn func(uri string, text string, offset int) interface{}) (interface{}, error) {
+		var p lsp.TextDocumentPositionParams
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		text, err := s.text(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return fn(p.TextDocument.URI, text, lsp.Offset(text, p.Position)), nil
+	}
+
+	switch method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				// full document sync
+				"textDocumentSync": 1,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{"$"},
+				},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+			},
+			"serverInfo": map[string]interface{}{
+				"name":    "fq",
+				"version": s.version,
+			},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "textDocument/didOpen":
+		var p lsp.DidOpenTextDocumentParams
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		s.docs[p.TextDocument.URI] = p.TextDocument.Text
+		return nil, s.publishDiagnostics(ctx, c, p.TextDocument.URI)
+	case "textDocument/didChange":
+		var p lsp.DidChangeTextDocumentParams
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		if len(p.ContentChanges) == 0 {
+			return nil, nil
+		}
+		s.docs[p.TextDocument.URI] = p.ContentChanges[len(p.ContentChanges)-1].Text
+		return nil, s.publishDiagnostics(ctx, c, p.TextDocument.URI)
+	case "textDocument/didClose":
+		var p lsp.DidCloseTextDocumentParams
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return nil, c.Notify("textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
+			URI:         p.TextDocument.URI,
+			Diagnostics: []lsp.Diagnostic{},
+		})
+	case "textDocument/completion":
+		return positionFn(func(uri string, text string, offset int) interface{} {
+			return s.completion(uri, text, offset)
+		})
+	case "textDocument/hover":
+		return positionFn(func(uri string, text string, offset int) interface{} {
+			if h := s.hover(uri, text, offset); h != nil {
+				return h
+			}
+			return nil
+		})
+	case "textDocument/definition":
+		return positionFn(func(uri string, text string, offset int) interface{} {
+			return s.definition(uri, text, offset)
+		})
+	default:
+		if strings.HasPrefix(method, "$/") {
+			// optional notifications and requests can be ignored
+			return nil, nil
+		}
+		return nil, lsp.MethodNotFoundError(method)
+	}
+}
+
+func (i *Interp) _lsp(c interface{}, a []interface{}) gojq.Iter {
+	var opts struct {
+		Version string `mapstructure:"version"`
+	}
+	_ = mapstructure.Decode(a[0], &opts)
+	if err := i.allow(CapabilityStdin, ""); err != nil {
+		return gojq.NewIter(err)
+	}
+
+	s, err := newLSPServer(i.evalInstance.ctx, i, opts.Version)
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+	conn := lsp.NewConn(i.os.Stdin(), i.evalInstance.output)
+	if err := lsp.Serve(i.evalInstance.ctx, conn, s); err != nil {
+		return gojq.NewIter(err)
+	}
+
+	return gojq.NewIter()
+}
@@ -0,0 +1,18 @@
+package interp_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wader/fq/format/registry"
+	"github.com/wader/fq/pkg/fqtest"
+)
+
+// LSP headers end with CRLF but test files are always LF (see .gitattributes) so
+// LSP cases are in their own files and compared with CRLF replaced by LF
+func TestLSP(t *testing.T) {
+	fqtest.TestPathWithOptions(t, registry.Default, fqtest.Options{
+		Pattern:  "*.lsptest",
+		ActualFn: func(s string) string { return strings.ReplaceAll(s, "\r\n", "\n") },
+	})
+}
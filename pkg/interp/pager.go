@@ -0,0 +1,300 @@
+package interp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/wader/fq/internal/ansi"
+	"github.com/wader/fq/internal/ioextra"
+	"github.com/wader/fq/internal/mathextra"
+)
+
+const builtinPagerName = "builtin"
+
+var errPagerQuit = errors.New("pager quit")
+
+// buffers output until it does not fit on screen and then starts pager and
+// forwards all output to it
+type pagerWriter struct {
+	w        io.Writer
+	maxLines int
+	lines    int
+	buf      bytes.Buffer
+	startFn  func() (io.WriteCloser, error)
+	pager    io.WriteCloser
+	cancelFn func()
+	quit     bool
+	startErr error
+}
+
+func (pw *pagerWriter) Write(p []byte) (int, error) {
+	if pw.pager != nil {
+		n, err := pw.pager.Write(p)
+		if err != nil {
+			// pager has exited, stop rendering
+			pw.quit = true
+			pw.cancelFn()
+		}
+		return n, err
+	}
+
+	pw.buf.Write(p)
+	pw.lines += bytes.Count(p, []byte{'\n'})
+	if pw.lines < pw.maxLines {
+		return len(p), nil
+	}
+
+	pager, err := pw.startFn()
+	if err != nil {
+		pw.startErr = err
+		return 0, err
+	}
+	pw.pager = pager
+	if _, err := pw.Write(pw.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	pw.buf.Reset()
+
+	return len(p), nil
+}
+
+func (pw *pagerWriter) Close() error {
+	if pw.pager == nil {
+		_, err := pw.w.Write(pw.buf.Bytes())
+		return err
+	}
+	return pw.pager.Close()
+}
+
+// pageOutput calls fn with a writer that goes thru a pager if output does not fit on
+// screen and stdout is a terminal
+func (i *Interp) pageOutput(opts Options, fn func(w io.Writer) error) error {
+	stdout := i.os.Stdout()
+	if opts.Pager == "" || !stdout.IsTerminal() {
+		return fn(i.evalInstance.output)
+	}
+	width, height := stdout.Size()
+
+	ctx, cancelFn := context.WithCancel(i.evalInstance.ctx)
+	defer cancelFn()
+
+	maxLines := height
+	if opts.ForcePager {
+		maxLines = 0
+	}
+	pw := &pagerWriter{
+		w:        i.evalInstance.output,
+		maxLines: maxLines,
+		cancelFn: cancelFn,
+		startFn: func() (io.WriteCloser, error) {
+			if opts.Pager == builtinPagerName {
+				if err := i.allow(CapabilityStdin, ""); err != nil {
+					return nil, err
+				}
+				return newBuiltinPager(i.os.Stdin(), i.evalInstance.output, width, height, cancelFn), nil
+			}
+			if err := i.allow(CapabilityExec, opts.Pager); err != nil {
+				return nil, err
+			}
+			p, ok := i.os.(Pager)
+			if !ok {
+				return nil, fmt.Errorf("pager %q: external pager not supported", opts.Pager)
+			}
+			return p.Pager(opts.Pager)
+		},
+	}
+
+	err := fn(ioextra.CtxWriter{Writer: pw, Ctx: ctx})
+	closeErr := pw.Close()
+	switch {
+	case pw.startErr != nil:
+		return pw.startErr
+	case pw.quit, ctx.Err() != nil && i.evalInstance.ctx.Err() == nil:
+		// user quit pager before all output was rendered
+		return nil
+	case err != nil:
+		return err
+	default:
+		return closeErr
+	}
+}
+
+// simple less like pager used if there is no external pager
+type builtinPager struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	stdin    Input
+	w        io.Writer
+	width    int
+	height   int
+	cancelFn func()
+
+	lines   []string
+	partial string
+	top     int
+	started bool
+	done    bool
+	quit    bool
+	// key handler is waiting for more lines
+	waiting  bool
+	keysDone chan struct{}
+}
+
+func newBuiltinPager(stdin Input, w io.Writer, width int, height int, cancelFn func()) *builtinPager {
+	p := &builtinPager{
+		stdin:    stdin,
+		w:        w,
+		width:    mathextra.MaxInt(1, width),
+		height:   mathextra.MaxInt(2, height),
+		cancelFn: cancelFn,
+		keysDone: make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// last row is used for status
+func (p *builtinPager) pageHeight() int { return p.height - 1 }
+
+func (p *builtinPager) draw() {
+	sb := &strings.Builder{}
+	pageH := p.pageHeight()
+	for r := 0; r < pageH; r++ {
+		fmt.Fprintf(sb, "\x1b[%d;1H", r+1)
+		if li := p.top + r; li < len(p.lines) {
+			sb.WriteString(ansi.Truncate(p.lines[li], p.width))
+		}
+		sb.WriteString("\x1b[K")
+	}
+	fmt.Fprintf(sb, "\x1b[%d;1H", pageH+1)
+	status := ":"
+	if p.done && p.top+pageH >= len(p.lines) {
+		status = "(END)"
+	}
+	sb.WriteString(ansi.Inverse.Wrap(status))
+	sb.WriteString("\x1b[K")
+	_, _ = io.WriteString(p.w, sb.String())
+}
+
+// called with lock held
+func (p *builtinPager) start() {
+	p.started = true
+	// alternate screen and hide cursor
+	_, _ = io.WriteString(p.w, "\x1b[?1049h\x1b[?25l")
+	p.draw()
+	go p.keyLoop()
+}
+
+// scroll to line, waits for lines to be rendered if needed
+func (p *builtinPager) scrollTo(top int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pageH := p.pageHeight()
+	p.waiting = true
+	for !p.done && len(p.lines) < top+pageH {
+		p.cond.Wait()
+	}
+	p.waiting = false
+
+	p.top = mathextra.ClampInt(0, mathextra.MaxInt(0, len(p.lines)-pageH), top)
+	p.draw()
+}
+
+func (p *builtinPager) keyLoop() {
+	defer close(p.keysDone)
+	defer func() {
+		p.mu.Lock()
+		p.quit = true
+		_, _ = io.WriteString(p.w, "\x1b[?25h\x1b[?1049l")
+		p.mu.Unlock()
+		p.cancelFn()
+	}()
+
+	if rm, ok := p.stdin.(RawModer); ok && p.stdin.IsTerminal() {
+		restore, err := rm.RawMode()
+		if err != nil {
+			return
+		}
+		defer func() { _ = restore() }()
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := p.stdin.Read(buf)
+		for _, k := range browseKeys(buf[0:n]) {
+			p.mu.Lock()
+			top := p.top
+			pageH := p.pageHeight()
+			p.mu.Unlock()
+
+			switch k {
+			case 'q', 3, 4:
+				return
+			case browseKeyDown, 'j', '\r', '\n':
+				p.scrollTo(top + 1)
+			case browseKeyUp, 'k':
+				p.scrollTo(top - 1)
+			case browseKeyPageDown, ' ', 'f':
+				p.scrollTo(top + pageH)
+			case browseKeyPageUp, 'b':
+				p.scrollTo(top - pageH)
+			case browseKeyHome, 'g':
+				p.scrollTo(0)
+			case browseKeyEnd, 'G':
+				p.scrollTo(int(^uint(0) >> 2))
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *builtinPager) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.quit {
+		return 0, errPagerQuit
+	}
+
+	parts := strings.Split(p.partial+string(b), "\n")
+	p.lines = append(p.lines, parts[0:len(parts)-1]...)
+	p.partial = parts[len(parts)-1]
+	p.cond.Broadcast()
+
+	if !p.started && len(p.lines) >= p.pageHeight() {
+		p.start()
+	}
+
+	return len(b), nil
+}
+
+// Close waits for user to quit the pager
+func (p *builtinPager) Close() error {
+	p.mu.Lock()
+	if p.partial != "" {
+		p.lines = append(p.lines, p.partial)
+		p.partial = ""
+	}
+	p.done = true
+	p.cond.Broadcast()
+	switch {
+	case !p.started:
+		p.start()
+	case !p.quit && !p.waiting && p.top+p.pageHeight() >= len(p.lines):
+		// last page is shown, update status
+		p.draw()
+	}
+	p.mu.Unlock()
+
+	<-p.keysDone
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package interp
+
+import (
+	"bytes"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/wader/fq/internal/ansi"
+	"github.com/wader/fq/internal/gojqextra"
+	"github.com/wader/fq/internal/termplot"
+)
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"_toplot", 1, 1, i._toPlot, nil},
+		}
+	})
+}
+
+func (i *Interp) _toPlot(c interface{}, a []interface{}) interface{} {
+	opts := i.Options(a[0])
+	var plotOpts struct {
+		Type   string `mapstructure:"type"`
+		Width  int    `mapstructure:"width"`
+		Height int    `mapstructure:"height"`
+		Bins   int    `mapstructure:"bins"`
+	}
+	_ = mapstructure.Decode(a[0], &plotOpts)
+
+	vs, ok := gojqextra.ToArray(c)
+	if !ok {
+		return gojqextra.FuncTypeError{Name: "toplot", V: c}
+	}
+	points := make([]termplot.Point, len(vs))
+	for j, v := range vs {
+		// number or [x, y] pair
+		if y, ok := gojqextra.ToFloat(v); ok {
+			points[j] = termplot.Point{X: float64(j), Y: y}
+			continue
+		}
+		if xy, ok := gojqextra.ToArray(v); ok && len(xy) == 2 {
+			x, xOk := gojqextra.ToFloat(xy[0])
+			y, yOk := gojqextra.ToFloat(xy[1])
+			if xOk && yOk {
+				points[j] = termplot.Point{X: x, Y: y}
+				continue
+			}
+		}
+		return gojqextra.FuncTypeError{Name: "toplot", V: v}
+	}
+
+	po := termplot.Options{
+		Type:   plotOpts.Type,
+		Width:  plotOpts.Width,
+		Height: plotOpts.Height,
+		Bins:   plotOpts.Bins,
+	}
+	if opts.Color {
+		po.PlotColor = ansi.FromString(opts.Colors["plot"])
+		po.AxisColor = ansi.FromString(opts.Colors["plotaxis"])
+	}
+
+	b := &bytes.Buffer{}
+	if err := termplot.Plot(b, points, po); err != nil {
+		return err
+	}
+
+	return b.String()
+}
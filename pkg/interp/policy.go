@@ -0,0 +1,133 @@
+package interp
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Capability is a side effect that can be allowed or denied by a Policy
+type Capability string
+
+const (
+	// CapabilityOpen open file for reading, name is path or "" for stdin
+	CapabilityOpen Capability = "open"
+	// CapabilityStdin read stdin outside of input, ex: paste, REPL and browse
+	CapabilityStdin Capability = "stdin"
+	// CapabilityStdout write to stdout outside of output, ex: print
+	CapabilityStdout Capability = "stdout"
+	// CapabilityStderr write to stderr, ex: printerr
+	CapabilityStderr Capability = "stderr"
+	// CapabilityHistory read REPL history
+	CapabilityHistory Capability = "history"
+	// CapabilityInclude include or import module from filesystem, name is path
+	CapabilityInclude Capability = "include"
+	// CapabilityEnviron read environment variables, ex: $ENV and env
+	CapabilityEnviron Capability = "environ"
+	// CapabilityCreate create or truncate file, name is path
+	CapabilityCreate Capability = "create"
+	// CapabilityExec run external command, name is command
+	CapabilityExec Capability = "exec"
+)
+
+// Policy can optionally be implemented by OS or passed to New using WithPolicy
+// to allow or deny side effects. Allow should return an error if denied.
+type Policy interface {
+	Allow(c Capability, name string) error
+}
+
+// PolicyFunc is an adapter to allow use of ordinary functions as Policy
+type PolicyFunc func(c Capability, name string) error
+
+func (fn PolicyFunc) Allow(c Capability, name string) error { return fn(c, name) }
+
+type NotAllowedError struct {
+	Capability Capability
+	Name       string
+}
+
+func (e NotAllowedError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("%s: not allowed", e.Capability)
+	}
+	return fmt.Sprintf("%s %s: not allowed", e.Capability, e.Name)
+}
+
+// Sandbox is a Policy that denies all side effects except opening input files,
+// including modules inside include paths and optionally writing to stderr
+type Sandbox struct {
+	// Inputs are paths that can be opened, "" is stdin
+	Inputs []string `mapstructure:"inputs"`
+	// IncludePaths are directories that modules can be included from
+	IncludePaths []string `mapstructure:"include_paths"`
+	// Stderr allows writes to stderr, the CLI reports errors there anyway
+	Stderr bool `mapstructure:"stderr"`
+}
+
+func (s Sandbox) Allow(c Capability, name string) error {
+	switch c {
+	case CapabilityStderr:
+		if s.Stderr {
+			return nil
+		}
+	case CapabilityOpen:
+		for _, p := range s.Inputs {
+			if p == name || (p != "" && name != "" && filepath.Clean(p) == filepath.Clean(name)) {
+				return nil
+			}
+		}
+	case CapabilityInclude:
+		absName, err := filepath.Abs(name)
+		if err != nil {
+			return err
+		}
+		for _, p := range s.IncludePaths {
+			absP, err := filepath.Abs(p)
+			if err != nil {
+				continue
+			}
+			if absName == absP || strings.HasPrefix(absName, absP+string(filepath.Separator)) {
+				return nil
+			}
+		}
+	}
+	return NotAllowedError{Capability: c, Name: name}
+}
+
+// Option configures an interpreter created by New
+type Option func(i *Interp)
+
+// WithPolicy adds a policy that all side effects must be allowed by, policies can
+// only be added and all policies and OS (if it implements Policy) must allow
+func WithPolicy(p Policy) Option {
+	return func(i *Interp) {
+		*i.policies = append(*i.policies, p)
+	}
+}
+
+// allow checks if a side effect is allowed by OS and all policies
+func (i *Interp) allow(c Capability, name string) error {
+	if p, ok := i.os.(Policy); ok {
+		if err := p.Allow(c, name); err != nil {
+			return err
+		}
+	}
+	for _, p := range *i.policies {
+		if err := p.Allow(c, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enable sandbox policy, can't be undone as policies can only be added
+func (i *Interp) _sandbox(c interface{}, a []interface{}) interface{} {
+	var s Sandbox
+	if err := mapstructure.Decode(a[0], &s); err != nil {
+		return err
+	}
+	WithPolicy(s)(i)
+	return nil
+}
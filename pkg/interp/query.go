@@ -11,6 +11,7 @@ func init() {
 		return []Function{
 			{"_query_fromstring", 0, 0, i.queryFromString, nil},
 			{"_query_tostring", 0, 0, i.queryToString, nil},
+			{"_query_rewrite_loc", 1, 1, i.queryRewriteLoc, nil},
 		}
 	})
 }
@@ -57,3 +58,24 @@ func (i *Interp) queryToString(c interface{}, a []interface{}) interface{} {
 
 	return q.String()
 }
+
+func (i *Interp) queryRewriteLoc(c interface{}, a []interface{}) interface{} {
+	s, err := toString(c)
+	if err != nil {
+		return err
+	}
+	filename, err := toString(a[0])
+	if err != nil {
+		return err
+	}
+	// parse to report errors with position in s
+	if _, p, err := parseQuery(s, filename); err != nil {
+		return compileError{
+			err:  err,
+			what: "parse",
+			pos:  p,
+		}
+	}
+	rs, _ := rewriteLocVariable(s, filename)
+	return rs
+}
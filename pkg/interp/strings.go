@@ -0,0 +1,198 @@
+package interp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/wader/fq/internal/bitioextra"
+	"github.com/wader/gojq"
+)
+
+func init() {
+	functionRegisterFns = append(functionRegisterFns, func(i *Interp) []Function {
+		return []Function{
+			{"_strings", 1, 1, nil, i._strings},
+		}
+	})
+}
+
+type stringsDecoder struct {
+	name     string
+	unitSize int
+	// returns rune and its size in bytes, ok false if not a printable rune
+	decode func(b []byte) (rune, int, bool)
+}
+
+func isStringsRune(r rune) bool {
+	return r == '\t' || unicode.IsPrint(r)
+}
+
+// utf16 and utf32 only match runes below U+0100 as otherwise most binary data would match
+func stringsFixedDecoder(name string, unitSize int, fn func(b []byte) uint32) stringsDecoder {
+	return stringsDecoder{
+		name:     name,
+		unitSize: unitSize,
+		decode: func(b []byte) (rune, int, bool) {
+			if len(b) < unitSize {
+				return 0, 0, false
+			}
+			r := rune(fn(b))
+			return r, unitSize, r < 0x100 && isStringsRune(r)
+		},
+	}
+}
+
+var stringsDecoders = []stringsDecoder{
+	{
+		name:     "ascii",
+		unitSize: 1,
+		decode: func(b []byte) (rune, int, bool) {
+			r := rune(b[0])
+			return r, 1, r == '\t' || (r >= 0x20 && r <= 0x7e)
+		},
+	},
+	{
+		name:     "utf8",
+		unitSize: 1,
+		decode: func(b []byte) (rune, int, bool) {
+			r, size := utf8.DecodeRune(b)
+			if r == utf8.RuneError && size <= 1 {
+				return 0, 1, false
+			}
+			return r, size, isStringsRune(r)
+		},
+	},
+	stringsFixedDecoder("utf16le", 2, func(b []byte) uint32 { return uint32(binary.LittleEndian.Uint16(b)) }),
+	stringsFixedDecoder("utf16be", 2, func(b []byte) uint32 { return uint32(binary.BigEndian.Uint16(b)) }),
+	stringsFixedDecoder("utf32le", 4, binary.LittleEndian.Uint32),
+	stringsFixedDecoder("utf32be", 4, binary.BigEndian.Uint32),
+}
+
+type stringsMatch struct {
+	offset   int
+	size     int
+	encoding int
+	s        string
+}
+
+// find runs of at least minLength printable runes, fixed size encodings are scanned at
+// all alignments
+func findStrings(buf []byte, encodingIndex int, d stringsDecoder, minLength int) []stringsMatch {
+	var ms []stringsMatch
+	for align := 0; align < d.unitSize; align++ {
+		sb := &strings.Builder{}
+		runStart := -1
+		runLen := 0
+		emit := func(end int) {
+			if runStart != -1 && runLen >= minLength {
+				ms = append(ms, stringsMatch{
+					offset:   runStart,
+					size:     end - runStart,
+					encoding: encodingIndex,
+					s:        sb.String(),
+				})
+			}
+			sb.Reset()
+			runStart = -1
+			runLen = 0
+		}
+
+		pos := align
+		for pos < len(buf) {
+			r, size, ok := d.decode(buf[pos:])
+			if !ok {
+				emit(pos)
+				if size == 0 {
+					break
+				}
+				pos += d.unitSize
+				continue
+			}
+			if runStart == -1 {
+				runStart = pos
+			}
+			sb.WriteRune(r)
+			runLen++
+			pos += size
+		}
+		emit(pos)
+	}
+	return ms
+}
+
+func (i *Interp) _strings(c interface{}, a []interface{}) gojq.Iter {
+	var opts struct {
+		MinLength int      `mapstructure:"min_length"`
+		Encodings []string `mapstructure:"encodings"`
+	}
+	if err := mapstructure.Decode(a[0], &opts); err != nil {
+		return gojq.NewIter(err)
+	}
+	if opts.MinLength < 1 {
+		return gojq.NewIter(fmt.Errorf("min_length must be positive"))
+	}
+
+	var decoders []stringsDecoder
+	for _, e := range opts.Encodings {
+		found := false
+		for _, d := range stringsDecoders {
+			if d.name == e {
+				decoders = append(decoders, d)
+				found = true
+				break
+			}
+		}
+		if !found {
+			var names []string
+			for _, d := range stringsDecoders {
+				names = append(names, d.name)
+			}
+			return gojq.NewIter(fmt.Errorf("unknown encoding %q, expected one of: %s", e, strings.Join(names, ", ")))
+		}
+	}
+
+	bv, err := toBinary(c)
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+	br, err := bv.toReader()
+	if err != nil {
+		return gojq.NewIter(err)
+	}
+	bb := &bytes.Buffer{}
+	if _, err := bitioextra.CopyBits(bb, br); err != nil {
+		return gojq.NewIter(err)
+	}
+	buf := bb.Bytes()
+
+	var ms []stringsMatch
+	for ei, d := range decoders {
+		ms = append(ms, findStrings(buf, ei, d, opts.MinLength)...)
+	}
+	sort.SliceStable(ms, func(i, j int) bool {
+		if ms[i].offset == ms[j].offset {
+			return ms[i].encoding < ms[j].encoding
+		}
+		return ms[i].offset < ms[j].offset
+	})
+
+	// use absolute byte offset if possible so it can be used with in_bytes_range etc
+	startByte := int(bv.r.Start / 8)
+	vs := make([]interface{}, len(ms))
+	for j, m := range ms {
+		vs[j] = map[string]interface{}{
+			"offset":   startByte + m.offset,
+			"size":     m.size,
+			"encoding": decoders[m.encoding].name,
+			"string":   m.s,
+		}
+	}
+
+	return gojq.NewIter(vs...)
+}